@@ -3,6 +3,9 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/mongocollectibles/rental-system/models"
@@ -13,8 +16,65 @@ type Config struct {
 	PayMongoSecretKey string
 	PayMongoPublicKey string
 	ServerPort        string
+	BaseURL           string // Public URL used for payment redirect links; empty uses the request host
 	Environment       string
 	Stores            []models.Store
+
+	// Bearer token required on admin API routes; when empty they are only open in development
+	AdminToken string
+
+	// PayMongo HTTP client settings
+	PaymentTimeout    time.Duration
+	PaymentMaxRetries int
+
+	// Longest rental a customer may book, in days
+	MaxRentalDays int
+
+	// VAT charged on rental fees (0.12 = 12%); 0 disables tax
+	VATRate float64
+
+	// Reservation cleanup settings
+	ReservationTimeout time.Duration
+	CleanupInterval    time.Duration
+
+	// Allocation mode: "reserve" holds a unit from checkout, "soft_hold" only holds it
+	// for SoftHoldTTL and commits the allocation on payment success
+	AllocationMode string
+	SoftHoldTTL    time.Duration
+
+	// ETA in days = ETAHandlingDays + one day per ETAKmPerDay km of warehouse-to-store distance
+	ETAKmPerDay     int
+	ETAHandlingDays int
+
+	DynamoDB DynamoDBConfig
+
+	SMTP SMTPConfig
+}
+
+// SMTPConfig holds the mail relay used for customer notifications
+type SMTPConfig struct {
+	Host     string // Empty disables email notifications
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// DefaultDynamoDBTablePrefix is the table name prefix used when none is configured
+const DefaultDynamoDBTablePrefix = "MongoCollectibles"
+
+// DynamoDBConfig holds DynamoDB table naming so environments can share one AWS account
+type DynamoDBConfig struct {
+	TablePrefix string // Tables are named "<prefix>-Collectibles", "<prefix>-Rentals", ...
+}
+
+// TableName returns the full name for a table suffix, e.g. "Rentals" -> "MongoCollectibles-Rentals"
+func (c DynamoDBConfig) TableName(suffix string) string {
+	prefix := c.TablePrefix
+	if prefix == "" {
+		prefix = DefaultDynamoDBTablePrefix
+	}
+	return prefix + "-" + suffix
 }
 
 // LoadConfig loads configuration from environment variables
@@ -24,17 +84,54 @@ func LoadConfig() *Config {
 		log.Println("No .env file found, using system environment variables")
 	}
 
+	serverPort := getEnv("SERVER_PORT", "8080")
+
 	config := &Config{
 		PayMongoSecretKey: getEnv("PAYMONGO_SECRET_KEY", getEnv("TEST_SECRET_KEY", "")),
 		PayMongoPublicKey: getEnv("PAYMONGO_PUBLIC_KEY", getEnv("TEST_PUBLIC_KEY", "")),
-		ServerPort:        getEnv("SERVER_PORT", "8080"),
+		ServerPort:        serverPort,
+		BaseURL:           strings.TrimRight(getEnv("BASE_URL", ""), "/"), // Empty: use the checkout request's host
 		Environment:       getEnv("ENVIRONMENT", "development"),
 		Stores:            initializeStores(),
+
+		AdminToken: getEnv("ADMIN_TOKEN", ""),
+
+		PaymentTimeout:    getEnvDuration("PAYMONGO_TIMEOUT", 10*time.Second),
+		PaymentMaxRetries: getEnvInt("PAYMONGO_MAX_RETRIES", 2),
+
+		MaxRentalDays: getEnvInt("MAX_RENTAL_DAYS", 365),
+		VATRate:       getEnvFloat("VAT_RATE", 0.12),
+
+		ReservationTimeout: getEnvDuration("RESERVATION_TIMEOUT", 2*time.Minute),
+		CleanupInterval:    getEnvDuration("RESERVATION_CLEANUP_INTERVAL", 1*time.Minute),
+
+		AllocationMode: getAllocationMode(),
+		SoftHoldTTL:    getEnvDuration("SOFT_HOLD_TTL", 5*time.Minute),
+
+		ETAKmPerDay:     getEnvInt("ETA_KM_PER_DAY", 50),
+		ETAHandlingDays: getEnvInt("ETA_HANDLING_DAYS", 1),
+
+		DynamoDB: DynamoDBConfig{
+			TablePrefix: getEnv("DYNAMODB_TABLE_PREFIX", DefaultDynamoDBTablePrefix),
+		},
+
+		SMTP: SMTPConfig{
+			Host:     getEnv("SMTP_HOST", ""),
+			Port:     getEnvInt("SMTP_PORT", 587),
+			Username: getEnv("SMTP_USERNAME", ""),
+			Password: getEnv("SMTP_PASSWORD", ""),
+			From:     getEnv("SMTP_FROM", "no-reply@mongocollectibles.com"),
+		},
 	}
 
 	return config
 }
 
+// IsDevelopment reports whether the server runs in the development environment
+func (c *Config) IsDevelopment() bool {
+	return c.Environment == "development"
+}
+
 // getEnv gets an environment variable with a default fallback
 func getEnv(key, defaultValue string) string {
 	value := os.Getenv(key)
@@ -44,29 +141,81 @@ func getEnv(key, defaultValue string) string {
 	return value
 }
 
+// getEnvDuration parses a duration (e.g. "30s", "1h") from an environment variable with a default fallback
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("Invalid duration for %s (%q), using default %v", key, value, defaultValue)
+		return defaultValue
+	}
+	return d
+}
+
+// getEnvInt parses a non-negative integer from an environment variable with a default fallback
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.Printf("Invalid integer for %s (%q), using default %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return n
+}
+
+// getEnvFloat parses a non-negative number from an environment variable with a default fallback
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f < 0 {
+		log.Printf("Invalid number for %s (%q), using default %v", key, value, defaultValue)
+		return defaultValue
+	}
+	return f
+}
+
+// getAllocationMode reads ALLOCATION_MODE, defaulting to "reserve" for unknown values
+func getAllocationMode() string {
+	mode := getEnv("ALLOCATION_MODE", "reserve")
+	if mode != "reserve" && mode != "soft_hold" {
+		log.Printf("Invalid ALLOCATION_MODE %q, using default \"reserve\"", mode)
+		return "reserve"
+	}
+	return mode
+}
+
 // initializeStores creates the default store locations
 func initializeStores() []models.Store {
 	return []models.Store{
 		{
-			ID:      "store-a",
-			Name:    "MongoCollectibles Store A",
-			Address: "123 Main Street, Manila",
-			// Latitude:  14.5995,
-			// Longitude: 120.9842,
+			ID:        "store-a",
+			Name:      "MongoCollectibles Store A",
+			Address:   "123 Main Street, Manila",
+			Latitude:  14.5995,
+			Longitude: 120.9842,
 		},
 		{
-			ID:      "store-b",
-			Name:    "MongoCollectibles Store B",
-			Address: "456 Quezon Avenue, Quezon City",
-			// Latitude:  14.6760,
-			// Longitude: 121.0437,
+			ID:        "store-b",
+			Name:      "MongoCollectibles Store B",
+			Address:   "456 Quezon Avenue, Quezon City",
+			Latitude:  14.6760,
+			Longitude: 121.0437,
 		},
 		{
-			ID:      "store-c",
-			Name:    "MongoCollectibles Store C",
-			Address: "789 Makati Boulevard, Makati",
-			// Latitude:  14.5547,
-			// Longitude: 121.0244,
+			ID:        "store-c",
+			Name:      "MongoCollectibles Store C",
+			Address:   "789 Makati Boulevard, Makati",
+			Latitude:  14.5547,
+			Longitude: 121.0244,
 		},
 	}
 }
@@ -90,3 +239,17 @@ func (c *Config) GetStoreByID(storeID string) *models.Store {
 	}
 	return nil
 }
+
+// IsValidStore reports whether storeID is one of the configured stores
+func (c *Config) IsValidStore(storeID string) bool {
+	return c.GetStoreByID(storeID) != nil
+}
+
+// StoreIDs returns the IDs of all configured stores
+func (c *Config) StoreIDs() []string {
+	ids := make([]string, 0, len(c.Stores))
+	for _, store := range c.Stores {
+		ids = append(ids, store.ID)
+	}
+	return ids
+}
@@ -2,31 +2,77 @@ package data
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/mongocollectibles/rental-system/config"
 	"github.com/mongocollectibles/rental-system/models"
 )
 
-// DynamoDBRepository implements Repository interface using DynamoDB
+// dynamoAPI is the subset of the DynamoDB client used by the repository
+type dynamoAPI interface {
+	Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error)
+}
+
+const (
+	// batchWriteLimit is the maximum number of requests DynamoDB accepts per BatchWriteItem call
+	batchWriteLimit = 25
+	// batchWriteMaxRetries bounds how many times unprocessed items are resubmitted
+	batchWriteMaxRetries = 5
+)
+
+// pingTimeout bounds the readiness check against DynamoDB
+const pingTimeout = 2 * time.Second
+
+// batchWriteBaseDelay is the initial backoff before resubmitting unprocessed items (doubles per retry)
+var batchWriteBaseDelay = 50 * time.Millisecond
+
+// DynamoDBRepository implements Repository interface using DynamoDB.
+// It also implements services.ReservationStore.
 type DynamoDBRepository struct {
-	client            *dynamodb.Client
+	client            dynamoAPI
 	collectiblesTable string
 	rentalsTable      string
 	warehousesTable   string
+	idempotencyTable  string
+	reservationsTable string
+	webhooksTable     string
+	waitlistTable     string
+	unitsTable        string
 }
 
 // NewDynamoDBRepository creates a new DynamoDB repository
-func NewDynamoDBRepository(cfg aws.Config) *DynamoDBRepository {
+func NewDynamoDBRepository(cfg aws.Config, dbCfg config.DynamoDBConfig) *DynamoDBRepository {
+	return NewDynamoDBRepositoryWithClient(dynamodb.NewFromConfig(cfg), dbCfg)
+}
+
+// NewDynamoDBRepositoryWithClient creates a repository around an existing client.
+// Tests use this to substitute a fake for the live DynamoDB API.
+func NewDynamoDBRepositoryWithClient(client dynamoAPI, dbCfg config.DynamoDBConfig) *DynamoDBRepository {
 	return &DynamoDBRepository{
-		client:            dynamodb.NewFromConfig(cfg),
-		collectiblesTable: "MongoCollectibles-Collectibles",
-		rentalsTable:      "MongoCollectibles-Rentals",
-		warehousesTable:   "MongoCollectibles-Warehouses",
+		client:            client,
+		collectiblesTable: dbCfg.TableName("Collectibles"),
+		rentalsTable:      dbCfg.TableName("Rentals"),
+		warehousesTable:   dbCfg.TableName("Warehouses"),
+		idempotencyTable:  dbCfg.TableName("IdempotencyKeys"),
+		reservationsTable: dbCfg.TableName("Reservations"),
+		webhooksTable:     dbCfg.TableName("WebhookEvents"),
+		waitlistTable:     dbCfg.TableName("Waitlist"),
+		unitsTable:        dbCfg.TableName("Units"),
 	}
 }
 
@@ -86,6 +132,53 @@ func (r *DynamoDBRepository) AddCollectible(collectible *models.Collectible) err
 	return nil
 }
 
+// UpdateCollectible replaces an existing collectible. The put is conditional so an
+// unknown ID is reported as not found instead of creating a new item.
+func (r *DynamoDBRepository) UpdateCollectible(collectible *models.Collectible) error {
+	item, err := attributevalue.MarshalMap(collectible)
+	if err != nil {
+		return fmt.Errorf("failed to marshal collectible: %w", err)
+	}
+
+	_, err = r.client.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName:           aws.String(r.collectiblesTable),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_exists(id)"),
+	})
+	if err != nil {
+		var conditionFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			return fmt.Errorf("collectible not found")
+		}
+		return fmt.Errorf("failed to put collectible: %w", err)
+	}
+	return nil
+}
+
+// ArchiveCollectible retires a collectible from the catalog. It stays retrievable
+// by ID so past rentals still resolve.
+func (r *DynamoDBRepository) ArchiveCollectible(id string) error {
+	_, err := r.client.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		TableName: aws.String(r.collectiblesTable),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+		UpdateExpression:    aws.String("SET archived = :archived"),
+		ConditionExpression: aws.String("attribute_exists(id)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":archived": &types.AttributeValueMemberBOOL{Value: true},
+		},
+	})
+	if err != nil {
+		var conditionFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			return fmt.Errorf("collectible not found")
+		}
+		return fmt.Errorf("failed to archive collectible: %w", err)
+	}
+	return nil
+}
+
 // GetWarehouses returns warehouses for a collectible
 func (r *DynamoDBRepository) GetWarehouses(collectibleID string) ([]models.Warehouse, error) {
 	out, err := r.client.Query(context.TODO(), &dynamodb.QueryInput{
@@ -119,15 +212,35 @@ func (r *DynamoDBRepository) AddWarehouse(collectibleID string, warehouse models
 	item["warehouse_id"] = item["id"]
 
 	_, err = r.client.PutItem(context.TODO(), &dynamodb.PutItemInput{
-		TableName: aws.String(r.warehousesTable),
-		Item:      item,
+		TableName:           aws.String(r.warehousesTable),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(warehouse_id)"),
 	})
 	if err != nil {
+		var conditionFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			return ErrWarehouseExists
+		}
 		return fmt.Errorf("failed to put warehouse: %w", err)
 	}
 	return nil
 }
 
+// DeleteWarehouse removes a collectible's warehouse row
+func (r *DynamoDBRepository) DeleteWarehouse(collectibleID string, warehouseID string) error {
+	_, err := r.client.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+		TableName: aws.String(r.warehousesTable),
+		Key: map[string]types.AttributeValue{
+			"collectible_id": &types.AttributeValueMemberS{Value: collectibleID},
+			"warehouse_id":   &types.AttributeValueMemberS{Value: warehouseID},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete warehouse: %w", err)
+	}
+	return nil
+}
+
 func (r *DynamoDBRepository) GetAllWarehouses() (map[string][]models.Warehouse, error) {
 	out, err := r.client.Scan(context.TODO(), &dynamodb.ScanInput{
 		TableName: aws.String(r.warehousesTable),
@@ -161,11 +274,15 @@ func (r *DynamoDBRepository) CreateRental(rental *models.Rental) error {
 	}
 
 	_, err = r.client.PutItem(context.TODO(), &dynamodb.PutItemInput{
-		TableName: aws.String(r.rentalsTable),
-		Item:      item,
-		// ConditionExpression: aws.String("attribute_not_exists(id)"), // Ensure uniqueness
+		TableName:           aws.String(r.rentalsTable),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(id)"), // Ensure uniqueness
 	})
 	if err != nil {
+		var conditionFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			return ErrRentalExists
+		}
 		return fmt.Errorf("failed to create rental: %w", err)
 	}
 	return nil
@@ -193,10 +310,65 @@ func (r *DynamoDBRepository) GetRentalByID(id string) (*models.Rental, error) {
 	return &rental, nil
 }
 
+// GetRentalByPaymentID returns the rental paid through the given checkout session,
+// using the PaymentIDIndex GSI
+func (r *DynamoDBRepository) GetRentalByPaymentID(paymentID string) (*models.Rental, error) {
+	out, err := r.client.Query(context.TODO(), &dynamodb.QueryInput{
+		TableName:              aws.String(r.rentalsTable),
+		IndexName:              aws.String("PaymentIDIndex"),
+		KeyConditionExpression: aws.String("payment_id = :pid"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pid": &types.AttributeValueMemberS{Value: paymentID},
+		},
+		Limit: aws.Int32(1),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rental by payment ID: %w", err)
+	}
+	if len(out.Items) == 0 {
+		return nil, fmt.Errorf("rental not found")
+	}
+
+	var rental models.Rental
+	if err := attributevalue.UnmarshalMap(out.Items[0], &rental); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal rental: %w", err)
+	}
+	return &rental, nil
+}
+
 // UpdateRental updates an existing rental
 func (r *DynamoDBRepository) UpdateRental(rental *models.Rental) error {
-	// For simplicity, just PutItem (overwrite)
-	return r.CreateRental(rental)
+	if rental.CustomerEmail == "" {
+		rental.CustomerEmail = rental.Customer.Email
+	}
+
+	// Only overwrite the version that was read; items written before versioning have none
+	expected := rental.Version
+	rental.Version++
+	item, err := attributevalue.MarshalMap(rental)
+	if err != nil {
+		rental.Version = expected
+		return fmt.Errorf("failed to marshal rental: %w", err)
+	}
+
+	_, err = r.client.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName:                aws.String(r.rentalsTable),
+		Item:                     item,
+		ConditionExpression:      aws.String("attribute_exists(id) AND (#version = :expected OR attribute_not_exists(#version))"),
+		ExpressionAttributeNames: map[string]string{"#version": "version"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":expected": &types.AttributeValueMemberN{Value: strconv.Itoa(expected)},
+		},
+	})
+	if err != nil {
+		rental.Version = expected
+		var conditionFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			return ErrRentalVersionConflict
+		}
+		return fmt.Errorf("failed to update rental: %w", err)
+	}
+	return nil
 }
 
 // GetAllRentals scans all rentals
@@ -242,44 +414,512 @@ func (r *DynamoDBRepository) GetRentalsByCustomerAndCollectible(email string, co
 	return rentals, nil
 }
 
+// GetRentalsByCustomerEmail queries the CustomerEmailIndex GSI for all of a customer's rentals, newest first
+func (r *DynamoDBRepository) GetRentalsByCustomerEmail(email string) ([]*models.Rental, error) {
+	var rentals []*models.Rental
+	var startKey map[string]types.AttributeValue
+	for {
+		out, err := r.client.Query(context.TODO(), &dynamodb.QueryInput{
+			TableName:              aws.String(r.rentalsTable),
+			IndexName:              aws.String("CustomerEmailIndex"),
+			KeyConditionExpression: aws.String("customer_email = :email"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":email": &types.AttributeValueMemberS{Value: email},
+			},
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to query rentals by customer: %w", err)
+		}
+
+		var page []*models.Rental
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			return nil, err
+		}
+		rentals = append(rentals, page...)
+
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		startKey = out.LastEvaluatedKey
+	}
+
+	sortRentalsNewestFirst(rentals)
+	return rentals, nil
+}
+
+// GetRentalsByDateRange returns rentals created between from and to inclusive, newest first.
+// created_at is stored as an RFC3339 string with varying precision and offsets, so it can't
+// be compared reliably in a filter expression; the scan is filtered here instead.
+func (r *DynamoDBRepository) GetRentalsByDateRange(from, to time.Time) ([]*models.Rental, error) {
+	var rentals []*models.Rental
+	var startKey map[string]types.AttributeValue
+	for {
+		out, err := r.client.Scan(context.TODO(), &dynamodb.ScanInput{
+			TableName:         aws.String(r.rentalsTable),
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan rentals: %w", err)
+		}
+
+		var page []*models.Rental
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal rentals: %w", err)
+		}
+		for _, rental := range page {
+			if createdBetween(rental, from, to) {
+				rentals = append(rentals, rental)
+			}
+		}
+
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		startKey = out.LastEvaluatedKey
+	}
+
+	sortRentalsNewestFirst(rentals)
+	return rentals, nil
+}
+
 // DeleteAllRentals clears all rental records in DynamoDB
 func (r *DynamoDBRepository) DeleteAllRentals() error {
-	// 1. Scan all rentals to get keys
-	out, err := r.client.Scan(context.TODO(), &dynamodb.ScanInput{
-		TableName:            aws.String(r.rentalsTable),
-		ProjectionExpression: aws.String("id"), // Only fetch keys
+	// 1. Scan all rentals to get keys (paginated)
+	var keys []map[string]types.AttributeValue
+	var startKey map[string]types.AttributeValue
+	for {
+		out, err := r.client.Scan(context.TODO(), &dynamodb.ScanInput{
+			TableName:            aws.String(r.rentalsTable),
+			ProjectionExpression: aws.String("id"), // Only fetch keys
+			ExclusiveStartKey:    startKey,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to scan for deletion: %w", err)
+		}
+		keys = append(keys, out.Items...)
+
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		startKey = out.LastEvaluatedKey
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	log.Printf("Deleting %d rentals...", len(keys))
+
+	// 2. Delete in batches of 25 (BatchWriteItem limit)
+	for start := 0; start < len(keys); start += batchWriteLimit {
+		end := start + batchWriteLimit
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		requests := make([]types.WriteRequest, 0, end-start)
+		for _, key := range keys[start:end] {
+			requests = append(requests, types.WriteRequest{
+				DeleteRequest: &types.DeleteRequest{Key: key},
+			})
+		}
+
+		if err := r.batchWrite(r.rentalsTable, requests); err != nil {
+			return fmt.Errorf("failed to delete rentals: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// batchWrite submits write requests for a table, resubmitting unprocessed items with exponential backoff
+func (r *DynamoDBRepository) batchWrite(table string, requests []types.WriteRequest) error {
+	pending := map[string][]types.WriteRequest{table: requests}
+	delay := batchWriteBaseDelay
+
+	for attempt := 0; ; attempt++ {
+		out, err := r.client.BatchWriteItem(context.TODO(), &dynamodb.BatchWriteItemInput{
+			RequestItems: pending,
+		})
+		if err != nil {
+			return err
+		}
+
+		if len(out.UnprocessedItems[table]) == 0 {
+			return nil
+		}
+		if attempt >= batchWriteMaxRetries {
+			return fmt.Errorf("%d items still unprocessed after %d retries", len(out.UnprocessedItems[table]), batchWriteMaxRetries)
+		}
+
+		log.Printf("Retrying %d unprocessed items in %v", len(out.UnprocessedItems[table]), delay)
+		time.Sleep(delay)
+		delay *= 2
+		pending = out.UnprocessedItems
+	}
+}
+
+// SaveIdempotencyKey claims a key for a rental using a conditional put
+func (r *DynamoDBRepository) SaveIdempotencyKey(key string, rentalID string) error {
+	now := time.Now()
+	_, err := r.client.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String(r.idempotencyTable),
+		Item: map[string]types.AttributeValue{
+			"idempotency_key": &types.AttributeValueMemberS{Value: key},
+			"rental_id":       &types.AttributeValueMemberS{Value: rentalID},
+			"expires_at":      &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(idempotencyKeyTTL).Unix(), 10)},
+		},
+		// An expired key the table's TTL hasn't deleted yet may be claimed again
+		ConditionExpression: aws.String("attribute_not_exists(idempotency_key) OR expires_at < :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)},
+		},
 	})
 	if err != nil {
-		return fmt.Errorf("failed to scan for deletion: %w", err)
+		var conditionFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			return ErrIdempotencyKeyExists
+		}
+		return fmt.Errorf("failed to save idempotency key: %w", err)
 	}
+	return nil
+}
 
-	if len(out.Items) == 0 {
-		return nil
+// GetRentalIDByIdempotencyKey returns the rental ID a key was claimed for
+func (r *DynamoDBRepository) GetRentalIDByIdempotencyKey(key string) (string, error) {
+	out, err := r.client.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String(r.idempotencyTable),
+		Key: map[string]types.AttributeValue{
+			"idempotency_key": &types.AttributeValueMemberS{Value: key},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get idempotency key: %w", err)
+	}
+	if out.Item == nil {
+		return "", fmt.Errorf("idempotency key not found")
 	}
 
-	log.Printf("Deleting %d rentals...", len(out.Items))
+	var record struct {
+		RentalID  string `dynamodbav:"rental_id"`
+		ExpiresAt int64  `dynamodbav:"expires_at"`
+	}
+	if err := attributevalue.UnmarshalMap(out.Item, &record); err != nil {
+		return "", fmt.Errorf("failed to unmarshal idempotency key: %w", err)
+	}
+	// Keys saved before expiry was recorded have no expires_at and never expire
+	if record.ExpiresAt != 0 && record.ExpiresAt < time.Now().Unix() {
+		return "", fmt.Errorf("idempotency key not found")
+	}
+	return record.RentalID, nil
+}
 
-	// 2. Delete item by item (BatchWriteItem is more efficient but limit 25 items, loop needed. PutItem loop is simpler for now)
-	for _, item := range out.Items {
-		var key struct {
-			ID string `dynamodbav:"id"`
+// SaveWebhookEvent inserts or replaces a webhook event record
+func (r *DynamoDBRepository) SaveWebhookEvent(event *models.WebhookEvent) error {
+	item, err := attributevalue.MarshalMap(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook event: %w", err)
+	}
+
+	_, err = r.client.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String(r.webhooksTable),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save webhook event: %w", err)
+	}
+	return nil
+}
+
+// GetRecentWebhookEvents returns up to limit webhook events, most recently received first.
+// The log is small and short-lived, so a paginated scan sorted in memory is enough.
+func (r *DynamoDBRepository) GetRecentWebhookEvents(limit int) ([]*models.WebhookEvent, error) {
+	var events []*models.WebhookEvent
+	var startKey map[string]types.AttributeValue
+	for {
+		out, err := r.client.Scan(context.TODO(), &dynamodb.ScanInput{
+			TableName:         aws.String(r.webhooksTable),
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook events: %w", err)
 		}
-		if err := attributevalue.UnmarshalMap(item, &key); err != nil {
-			log.Printf("Failed to unmarshal key: %v", err)
-			continue
+
+		var page []*models.WebhookEvent
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal webhook events: %w", err)
 		}
+		events = append(events, page...)
 
-		_, err := r.client.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
-			TableName: aws.String(r.rentalsTable),
-			Key: map[string]types.AttributeValue{
-				"id": &types.AttributeValueMemberS{Value: key.ID},
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		startKey = out.LastEvaluatedKey
+	}
+	return newestWebhookEvents(events, limit), nil
+}
+
+// AddWaitlistEntry adds a customer to a collectible's waitlist
+func (r *DynamoDBRepository) AddWaitlistEntry(entry *models.WaitlistEntry) error {
+	item, err := attributevalue.MarshalMap(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal waitlist entry: %w", err)
+	}
+
+	_, err = r.client.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName:           aws.String(r.waitlistTable),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(id)"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add waitlist entry: %w", err)
+	}
+	return nil
+}
+
+// GetWaitlistByCollectible queries the CollectibleIDIndex GSI for a collectible's
+// waitlist entries, oldest first
+func (r *DynamoDBRepository) GetWaitlistByCollectible(collectibleID string) ([]*models.WaitlistEntry, error) {
+	var entries []*models.WaitlistEntry
+	var startKey map[string]types.AttributeValue
+	for {
+		out, err := r.client.Query(context.TODO(), &dynamodb.QueryInput{
+			TableName:              aws.String(r.waitlistTable),
+			IndexName:              aws.String("CollectibleIDIndex"),
+			KeyConditionExpression: aws.String("collectible_id = :cid"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":cid": &types.AttributeValueMemberS{Value: collectibleID},
 			},
+			ExclusiveStartKey: startKey,
 		})
 		if err != nil {
-			log.Printf("Failed to delete rental %s: %v", key.ID, err)
-			// Continue deleting others even if one fails
+			return nil, fmt.Errorf("failed to query waitlist: %w", err)
 		}
+
+		var page []*models.WaitlistEntry
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal waitlist entries: %w", err)
+		}
+		entries = append(entries, page...)
+
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		startKey = out.LastEvaluatedKey
+	}
+
+	sortWaitlistOldestFirst(entries)
+	return entries, nil
+}
+
+// UpdateWaitlistEntry overwrites an existing waitlist entry
+func (r *DynamoDBRepository) UpdateWaitlistEntry(entry *models.WaitlistEntry) error {
+	item, err := attributevalue.MarshalMap(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal waitlist entry: %w", err)
 	}
 
+	_, err = r.client.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName:           aws.String(r.waitlistTable),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_exists(id)"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update waitlist entry: %w", err)
+	}
+	return nil
+}
+
+// DeleteIdempotencyKey releases a key so the request can be retried
+func (r *DynamoDBRepository) DeleteIdempotencyKey(key string) error {
+	_, err := r.client.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+		TableName: aws.String(r.idempotencyTable),
+		Key: map[string]types.AttributeValue{
+			"idempotency_key": &types.AttributeValueMemberS{Value: key},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete idempotency key: %w", err)
+	}
+	return nil
+}
+
+// Ping checks connectivity with a cheap single-item scan of the collectibles table
+func (r *DynamoDBRepository) Ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+
+	_, err := r.client.Scan(ctx, &dynamodb.ScanInput{
+		TableName:            aws.String(r.collectiblesTable),
+		Limit:                aws.Int32(1),
+		ProjectionExpression: aws.String("id"),
+	})
+	if err != nil {
+		return fmt.Errorf("dynamodb unreachable: %w", err)
+	}
+	return nil
+}
+
+// SaveReservation records a unit hold. The put is conditional so two instances
+// cannot hold the same unit for different rentals.
+func (r *DynamoDBRepository) SaveReservation(unitID string, rentalID string, reservedAt time.Time) error {
+	reservation := models.Reservation{UnitID: unitID, RentalID: rentalID}
+	if !reservedAt.IsZero() {
+		reservation.ReservedAt = &reservedAt
+	}
+
+	item, err := attributevalue.MarshalMap(reservation)
+	if err != nil {
+		return fmt.Errorf("failed to marshal reservation: %w", err)
+	}
+
+	_, err = r.client.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName:           aws.String(r.reservationsTable),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(unit_id) OR rental_id = :rid"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":rid": &types.AttributeValueMemberS{Value: rentalID},
+		},
+	})
+	if err != nil {
+		var conditionFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			return ErrUnitReserved
+		}
+		return fmt.Errorf("failed to save reservation: %w", err)
+	}
+	return nil
+}
+
+// DeleteReservation removes the hold on a unit
+func (r *DynamoDBRepository) DeleteReservation(unitID string) error {
+	_, err := r.client.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+		TableName: aws.String(r.reservationsTable),
+		Key: map[string]types.AttributeValue{
+			"unit_id": &types.AttributeValueMemberS{Value: unitID},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete reservation: %w", err)
+	}
+	return nil
+}
+
+// LoadReservations returns all persisted unit holds (paginated scan)
+func (r *DynamoDBRepository) LoadReservations() ([]models.Reservation, error) {
+	var reservations []models.Reservation
+	var startKey map[string]types.AttributeValue
+	for {
+		out, err := r.client.Scan(context.TODO(), &dynamodb.ScanInput{
+			TableName:         aws.String(r.reservationsTable),
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan reservations: %w", err)
+		}
+
+		var page []models.Reservation
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			return nil, err
+		}
+		reservations = append(reservations, page...)
+
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		startKey = out.LastEvaluatedKey
+	}
+	return reservations, nil
+}
+
+// GetAllUnits returns every persisted inventory unit (paginated scan)
+func (r *DynamoDBRepository) GetAllUnits() ([]*models.CollectibleUnit, error) {
+	var units []*models.CollectibleUnit
+	var startKey map[string]types.AttributeValue
+	for {
+		out, err := r.client.Scan(context.TODO(), &dynamodb.ScanInput{
+			TableName:         aws.String(r.unitsTable),
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan units: %w", err)
+		}
+
+		var page []*models.CollectibleUnit
+		if err := attributevalue.UnmarshalListOfMaps(out.Items, &page); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal units: %w", err)
+		}
+		units = append(units, page...)
+
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		startKey = out.LastEvaluatedKey
+	}
+	return units, nil
+}
+
+// SaveUnit stores an inventory unit, replacing any unit with the same ID
+func (r *DynamoDBRepository) SaveUnit(unit *models.CollectibleUnit) error {
+	item, err := attributevalue.MarshalMap(unit)
+	if err != nil {
+		return fmt.Errorf("failed to marshal unit: %w", err)
+	}
+
+	_, err = r.client.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String(r.unitsTable),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put unit: %w", err)
+	}
+	return nil
+}
+
+// UpdateUnitAvailability records a unit's availability and hold fields without
+// rewriting the rest of the item. The unit must already exist.
+func (r *DynamoDBRepository) UpdateUnitAvailability(unit *models.CollectibleUnit) error {
+	set := []string{"is_available = :available"}
+	var remove []string
+	values := map[string]types.AttributeValue{
+		":available": &types.AttributeValueMemberBOOL{Value: unit.IsAvailable},
+	}
+
+	if unit.ReservationID != "" {
+		set = append(set, "reservation_id = :rid")
+		values[":rid"] = &types.AttributeValueMemberS{Value: unit.ReservationID}
+	} else {
+		remove = append(remove, "reservation_id")
+	}
+	if unit.ReservedAt != nil {
+		reservedAt, err := attributevalue.Marshal(*unit.ReservedAt)
+		if err != nil {
+			return fmt.Errorf("failed to marshal reserved_at: %w", err)
+		}
+		set = append(set, "reserved_at = :reserved_at")
+		values[":reserved_at"] = reservedAt
+	} else {
+		remove = append(remove, "reserved_at")
+	}
+
+	update := "SET " + strings.Join(set, ", ")
+	if len(remove) > 0 {
+		update += " REMOVE " + strings.Join(remove, ", ")
+	}
+
+	_, err := r.client.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		TableName: aws.String(r.unitsTable),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: unit.ID},
+		},
+		UpdateExpression:          aws.String(update),
+		ConditionExpression:       aws.String("attribute_exists(id)"),
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update unit availability: %w", err)
+	}
 	return nil
 }
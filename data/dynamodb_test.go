@@ -0,0 +1,590 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/mongocollectibles/rental-system/config"
+	"github.com/mongocollectibles/rental-system/models"
+)
+
+// fakeDynamo is an in-process stand-in for the DynamoDB client.
+// Each hook is optional; unset hooks return empty outputs.
+type fakeDynamo struct {
+	scanFn       func(*dynamodb.ScanInput) (*dynamodb.ScanOutput, error)
+	getItemFn    func(*dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error)
+	putItemFn    func(*dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error)
+	queryFn      func(*dynamodb.QueryInput) (*dynamodb.QueryOutput, error)
+	deleteItemFn func(*dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error)
+	batchWriteFn func(*dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error)
+	updateItemFn func(*dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error)
+}
+
+func (f *fakeDynamo) Scan(_ context.Context, in *dynamodb.ScanInput, _ ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	if f.scanFn == nil {
+		return &dynamodb.ScanOutput{}, nil
+	}
+	return f.scanFn(in)
+}
+
+func (f *fakeDynamo) GetItem(_ context.Context, in *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	if f.getItemFn == nil {
+		return &dynamodb.GetItemOutput{}, nil
+	}
+	return f.getItemFn(in)
+}
+
+func (f *fakeDynamo) PutItem(_ context.Context, in *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	if f.putItemFn == nil {
+		return &dynamodb.PutItemOutput{}, nil
+	}
+	return f.putItemFn(in)
+}
+
+func (f *fakeDynamo) Query(_ context.Context, in *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	if f.queryFn == nil {
+		return &dynamodb.QueryOutput{}, nil
+	}
+	return f.queryFn(in)
+}
+
+func (f *fakeDynamo) DeleteItem(_ context.Context, in *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	if f.deleteItemFn == nil {
+		return &dynamodb.DeleteItemOutput{}, nil
+	}
+	return f.deleteItemFn(in)
+}
+
+func (f *fakeDynamo) BatchWriteItem(_ context.Context, in *dynamodb.BatchWriteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	if f.batchWriteFn == nil {
+		return &dynamodb.BatchWriteItemOutput{}, nil
+	}
+	return f.batchWriteFn(in)
+}
+
+func (f *fakeDynamo) UpdateItem(_ context.Context, in *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	if f.updateItemFn == nil {
+		return &dynamodb.UpdateItemOutput{}, nil
+	}
+	return f.updateItemFn(in)
+}
+
+// rentalKeys builds n projection-only rental items
+func rentalKeys(n int) []map[string]types.AttributeValue {
+	items := make([]map[string]types.AttributeValue, n)
+	for i := range items {
+		items[i] = map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: fmt.Sprintf("rental-%d", i)},
+		}
+	}
+	return items
+}
+
+const rentalsTable = "MongoCollectibles-Rentals"
+
+func TestDynamoDBRepository_DeleteAllRentals(t *testing.T) {
+	batchWriteBaseDelay = 0
+
+	t.Run("Deletes in batches of 25 across scan pages", func(t *testing.T) {
+		keys := rentalKeys(60)
+		var batchSizes []int
+
+		fake := &fakeDynamo{
+			scanFn: func(in *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+				// Two pages: 40 then 20
+				if in.ExclusiveStartKey == nil {
+					return &dynamodb.ScanOutput{Items: keys[:40], LastEvaluatedKey: keys[39]}, nil
+				}
+				return &dynamodb.ScanOutput{Items: keys[40:]}, nil
+			},
+			batchWriteFn: func(in *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+				batchSizes = append(batchSizes, len(in.RequestItems[rentalsTable]))
+				return &dynamodb.BatchWriteItemOutput{}, nil
+			},
+		}
+		repo := NewDynamoDBRepositoryWithClient(fake, config.DynamoDBConfig{})
+
+		if err := repo.DeleteAllRentals(); err != nil {
+			t.Fatalf("DeleteAllRentals failed: %v", err)
+		}
+
+		want := []int{25, 25, 10}
+		if fmt.Sprint(batchSizes) != fmt.Sprint(want) {
+			t.Errorf("Expected batch sizes %v, got %v", want, batchSizes)
+		}
+	})
+
+	t.Run("Retries unprocessed items", func(t *testing.T) {
+		keys := rentalKeys(3)
+		var calls []int
+
+		fake := &fakeDynamo{
+			scanFn: func(*dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+				return &dynamodb.ScanOutput{Items: keys}, nil
+			},
+			batchWriteFn: func(in *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+				reqs := in.RequestItems[rentalsTable]
+				calls = append(calls, len(reqs))
+				// First call leaves two items unprocessed
+				if len(calls) == 1 {
+					return &dynamodb.BatchWriteItemOutput{
+						UnprocessedItems: map[string][]types.WriteRequest{rentalsTable: reqs[1:]},
+					}, nil
+				}
+				return &dynamodb.BatchWriteItemOutput{}, nil
+			},
+		}
+		repo := NewDynamoDBRepositoryWithClient(fake, config.DynamoDBConfig{})
+
+		if err := repo.DeleteAllRentals(); err != nil {
+			t.Fatalf("DeleteAllRentals failed: %v", err)
+		}
+		if fmt.Sprint(calls) != fmt.Sprint([]int{3, 2}) {
+			t.Errorf("Expected resubmission of 2 unprocessed items, got calls %v", calls)
+		}
+	})
+
+	t.Run("Gives up after max retries", func(t *testing.T) {
+		fake := &fakeDynamo{
+			scanFn: func(*dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+				return &dynamodb.ScanOutput{Items: rentalKeys(1)}, nil
+			},
+			batchWriteFn: func(in *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+				return &dynamodb.BatchWriteItemOutput{UnprocessedItems: in.RequestItems}, nil
+			},
+		}
+		repo := NewDynamoDBRepositoryWithClient(fake, config.DynamoDBConfig{})
+
+		if err := repo.DeleteAllRentals(); err == nil {
+			t.Error("Expected error when items remain unprocessed")
+		}
+	})
+}
+
+func TestDynamoDBRepository_GetRentalsByCustomerAndCollectible(t *testing.T) {
+	t.Run("Queries the email GSI filtered by collectible", func(t *testing.T) {
+		stored, err := attributevalue.MarshalMap(models.Rental{
+			ID:            "rental-1",
+			CollectibleID: "col-001",
+			CustomerEmail: "juan@example.com",
+			PaymentStatus: models.PaymentPending,
+		})
+		if err != nil {
+			t.Fatalf("MarshalMap failed: %v", err)
+		}
+
+		var got *dynamodb.QueryInput
+		fake := &fakeDynamo{
+			queryFn: func(in *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+				got = in
+				return &dynamodb.QueryOutput{Items: []map[string]types.AttributeValue{stored}}, nil
+			},
+		}
+		repo := NewDynamoDBRepositoryWithClient(fake, config.DynamoDBConfig{})
+
+		rentals, err := repo.GetRentalsByCustomerAndCollectible("juan@example.com", "col-001")
+		if err != nil {
+			t.Fatalf("GetRentalsByCustomerAndCollectible failed: %v", err)
+		}
+
+		if *got.TableName != rentalsTable || *got.IndexName != "CustomerEmailIndex" {
+			t.Errorf("Expected query on %s/CustomerEmailIndex, got %s/%s", rentalsTable, *got.TableName, *got.IndexName)
+		}
+		if *got.KeyConditionExpression != "customer_email = :email" || *got.FilterExpression != "collectible_id = :cid" {
+			t.Errorf("Unexpected expressions: key=%q filter=%q", *got.KeyConditionExpression, *got.FilterExpression)
+		}
+		email := got.ExpressionAttributeValues[":email"].(*types.AttributeValueMemberS).Value
+		cid := got.ExpressionAttributeValues[":cid"].(*types.AttributeValueMemberS).Value
+		if email != "juan@example.com" || cid != "col-001" {
+			t.Errorf("Unexpected expression values: email=%q cid=%q", email, cid)
+		}
+
+		if len(rentals) != 1 || rentals[0].ID != "rental-1" || rentals[0].PaymentStatus != models.PaymentPending {
+			t.Errorf("Unexpected rentals: %+v", rentals)
+		}
+	})
+
+	t.Run("Propagates query errors", func(t *testing.T) {
+		fake := &fakeDynamo{
+			queryFn: func(*dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+				return nil, errors.New("throttled")
+			},
+		}
+		repo := NewDynamoDBRepositoryWithClient(fake, config.DynamoDBConfig{})
+
+		if _, err := repo.GetRentalsByCustomerAndCollectible("juan@example.com", "col-001"); err == nil {
+			t.Error("Expected error to be returned")
+		}
+	})
+}
+
+func TestNewDynamoDBRepositoryWithClient_TablePrefix(t *testing.T) {
+	repo := NewDynamoDBRepositoryWithClient(&fakeDynamo{}, config.DynamoDBConfig{TablePrefix: "Staging"})
+
+	if repo.collectiblesTable != "Staging-Collectibles" || repo.rentalsTable != "Staging-Rentals" || repo.warehousesTable != "Staging-Warehouses" {
+		t.Errorf("Expected Staging-* tables, got %s, %s, %s", repo.collectiblesTable, repo.rentalsTable, repo.warehousesTable)
+	}
+}
+
+func TestDynamoDBRepository_Reservations(t *testing.T) {
+	t.Run("Conditional save maps to ErrUnitReserved", func(t *testing.T) {
+		fake := &fakeDynamo{
+			putItemFn: func(in *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+				if aws.ToString(in.ConditionExpression) == "" {
+					t.Error("Expected a conditional put")
+				}
+				return nil, &types.ConditionalCheckFailedException{}
+			},
+		}
+		repo := NewDynamoDBRepositoryWithClient(fake, config.DynamoDBConfig{})
+
+		if err := repo.SaveReservation("wh-1", "rental-1", time.Now()); err != ErrUnitReserved {
+			t.Errorf("Expected ErrUnitReserved, got %v", err)
+		}
+	})
+
+	t.Run("Confirmed reservations round-trip without a timestamp", func(t *testing.T) {
+		var saved map[string]types.AttributeValue
+		fake := &fakeDynamo{
+			putItemFn: func(in *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+				saved = in.Item
+				return &dynamodb.PutItemOutput{}, nil
+			},
+			scanFn: func(*dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+				return &dynamodb.ScanOutput{Items: []map[string]types.AttributeValue{saved}}, nil
+			},
+		}
+		repo := NewDynamoDBRepositoryWithClient(fake, config.DynamoDBConfig{})
+
+		if err := repo.SaveReservation("wh-1", "rental-1", time.Time{}); err != nil {
+			t.Fatalf("SaveReservation failed: %v", err)
+		}
+		reservations, err := repo.LoadReservations()
+		if err != nil {
+			t.Fatalf("LoadReservations failed: %v", err)
+		}
+		if len(reservations) != 1 || reservations[0].RentalID != "rental-1" || reservations[0].ReservedAt != nil {
+			t.Errorf("Unexpected reservations: %+v", reservations)
+		}
+	})
+}
+
+func TestDynamoDBRepository_UpdateUnitAvailability(t *testing.T) {
+	var got *dynamodb.UpdateItemInput
+	fake := &fakeDynamo{
+		updateItemFn: func(in *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+			got = in
+			return &dynamodb.UpdateItemOutput{}, nil
+		},
+	}
+	repo := NewDynamoDBRepositoryWithClient(fake, config.DynamoDBConfig{})
+
+	reservedAt := time.Now()
+	if err := repo.UpdateUnitAvailability(&models.CollectibleUnit{ID: "u-1", ReservationID: "rental-1", ReservedAt: &reservedAt}); err != nil {
+		t.Fatalf("UpdateUnitAvailability failed: %v", err)
+	}
+	if aws.ToString(got.TableName) != "MongoCollectibles-Units" || aws.ToString(got.ConditionExpression) != "attribute_exists(id)" {
+		t.Errorf("Expected a conditional update on the units table, got %+v", got)
+	}
+	if want := "SET is_available = :available, reservation_id = :rid, reserved_at = :reserved_at"; aws.ToString(got.UpdateExpression) != want {
+		t.Errorf("UpdateExpression = %q, want %q", aws.ToString(got.UpdateExpression), want)
+	}
+
+	// Releasing a unit drops its hold attributes
+	if err := repo.UpdateUnitAvailability(&models.CollectibleUnit{ID: "u-1", IsAvailable: true}); err != nil {
+		t.Fatalf("UpdateUnitAvailability failed: %v", err)
+	}
+	if want := "SET is_available = :available REMOVE reservation_id, reserved_at"; aws.ToString(got.UpdateExpression) != want {
+		t.Errorf("UpdateExpression = %q, want %q", aws.ToString(got.UpdateExpression), want)
+	}
+}
+
+func TestDynamoDBRepository_ArchiveCollectible(t *testing.T) {
+	t.Run("Sets the archived flag on an existing item", func(t *testing.T) {
+		var got *dynamodb.UpdateItemInput
+		fake := &fakeDynamo{
+			updateItemFn: func(in *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+				got = in
+				return &dynamodb.UpdateItemOutput{}, nil
+			},
+		}
+		repo := NewDynamoDBRepositoryWithClient(fake, config.DynamoDBConfig{})
+
+		if err := repo.ArchiveCollectible("col-001"); err != nil {
+			t.Fatalf("ArchiveCollectible failed: %v", err)
+		}
+		if aws.ToString(got.TableName) != "MongoCollectibles-Collectibles" || aws.ToString(got.ConditionExpression) != "attribute_exists(id)" {
+			t.Errorf("Expected a conditional update on the collectibles table, got %+v", got)
+		}
+		if want := "SET archived = :archived"; aws.ToString(got.UpdateExpression) != want {
+			t.Errorf("UpdateExpression = %q, want %q", aws.ToString(got.UpdateExpression), want)
+		}
+	})
+
+	t.Run("Unknown ID is not found", func(t *testing.T) {
+		fake := &fakeDynamo{
+			updateItemFn: func(*dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+				return nil, &types.ConditionalCheckFailedException{}
+			},
+		}
+		repo := NewDynamoDBRepositoryWithClient(fake, config.DynamoDBConfig{})
+
+		if err := repo.ArchiveCollectible("col-missing"); err == nil || err.Error() != "collectible not found" {
+			t.Errorf("Expected collectible not found, got %v", err)
+		}
+	})
+}
+
+func TestDynamoDBRepository_UpdateCollectible(t *testing.T) {
+	var got *dynamodb.PutItemInput
+	fake := &fakeDynamo{
+		putItemFn: func(in *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+			got = in
+			if in.Item["id"].(*types.AttributeValueMemberS).Value == "col-missing" {
+				return nil, &types.ConditionalCheckFailedException{}
+			}
+			return &dynamodb.PutItemOutput{}, nil
+		},
+	}
+	repo := NewDynamoDBRepositoryWithClient(fake, config.DynamoDBConfig{})
+
+	if err := repo.UpdateCollectible(&models.Collectible{ID: "col-001", Name: "Batman Figure"}); err != nil {
+		t.Fatalf("UpdateCollectible failed: %v", err)
+	}
+	if aws.ToString(got.ConditionExpression) != "attribute_exists(id)" {
+		t.Errorf("Expected attribute_exists(id) condition, got %q", aws.ToString(got.ConditionExpression))
+	}
+
+	if err := repo.UpdateCollectible(&models.Collectible{ID: "col-missing"}); err == nil || err.Error() != "collectible not found" {
+		t.Errorf("Expected collectible not found, got %v", err)
+	}
+}
+
+func TestDynamoDBRepository_CreateRental(t *testing.T) {
+	t.Run("Put is conditional on a new ID", func(t *testing.T) {
+		var got *dynamodb.PutItemInput
+		fake := &fakeDynamo{
+			putItemFn: func(in *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+				got = in
+				return &dynamodb.PutItemOutput{}, nil
+			},
+		}
+		repo := NewDynamoDBRepositoryWithClient(fake, config.DynamoDBConfig{})
+
+		if err := repo.CreateRental(&models.Rental{ID: "rental-1"}); err != nil {
+			t.Fatalf("CreateRental failed: %v", err)
+		}
+		if aws.ToString(got.ConditionExpression) != "attribute_not_exists(id)" {
+			t.Errorf("Expected attribute_not_exists(id) condition, got %q", aws.ToString(got.ConditionExpression))
+		}
+	})
+
+	t.Run("Existing ID maps to ErrRentalExists", func(t *testing.T) {
+		fake := &fakeDynamo{
+			putItemFn: func(*dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+				return nil, &types.ConditionalCheckFailedException{}
+			},
+		}
+		repo := NewDynamoDBRepositoryWithClient(fake, config.DynamoDBConfig{})
+
+		if err := repo.CreateRental(&models.Rental{ID: "rental-1"}); !errors.Is(err, ErrRentalExists) {
+			t.Errorf("Expected ErrRentalExists, got %v", err)
+		}
+	})
+}
+
+func TestDynamoDBRepository_Warehouses(t *testing.T) {
+	t.Run("Existing warehouse maps to ErrWarehouseExists", func(t *testing.T) {
+		var got *dynamodb.PutItemInput
+		fake := &fakeDynamo{
+			putItemFn: func(in *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+				got = in
+				return nil, &types.ConditionalCheckFailedException{}
+			},
+		}
+		repo := NewDynamoDBRepositoryWithClient(fake, config.DynamoDBConfig{})
+
+		if err := repo.AddWarehouse("col-001", models.Warehouse{ID: "wh-1"}); !errors.Is(err, ErrWarehouseExists) {
+			t.Errorf("Expected ErrWarehouseExists, got %v", err)
+		}
+		if aws.ToString(got.ConditionExpression) != "attribute_not_exists(warehouse_id)" {
+			t.Errorf("Expected attribute_not_exists(warehouse_id) condition, got %q", aws.ToString(got.ConditionExpression))
+		}
+	})
+
+	t.Run("Delete uses the collectible and warehouse key", func(t *testing.T) {
+		var got *dynamodb.DeleteItemInput
+		fake := &fakeDynamo{
+			deleteItemFn: func(in *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+				got = in
+				return &dynamodb.DeleteItemOutput{}, nil
+			},
+		}
+		repo := NewDynamoDBRepositoryWithClient(fake, config.DynamoDBConfig{})
+
+		if err := repo.DeleteWarehouse("col-001", "wh-1"); err != nil {
+			t.Fatalf("DeleteWarehouse failed: %v", err)
+		}
+		collectibleID, _ := got.Key["collectible_id"].(*types.AttributeValueMemberS)
+		warehouseID, _ := got.Key["warehouse_id"].(*types.AttributeValueMemberS)
+		if collectibleID == nil || collectibleID.Value != "col-001" || warehouseID == nil || warehouseID.Value != "wh-1" {
+			t.Errorf("Unexpected delete key: %+v", got.Key)
+		}
+	})
+}
+
+func TestDynamoDBRepository_UpdateRental(t *testing.T) {
+	t.Run("Write is conditional on the version read", func(t *testing.T) {
+		var got *dynamodb.PutItemInput
+		fake := &fakeDynamo{
+			putItemFn: func(in *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+				got = in
+				return &dynamodb.PutItemOutput{}, nil
+			},
+		}
+		repo := NewDynamoDBRepositoryWithClient(fake, config.DynamoDBConfig{})
+
+		rental := &models.Rental{ID: "rental-1", Version: 4}
+		if err := repo.UpdateRental(rental); err != nil {
+			t.Fatalf("UpdateRental failed: %v", err)
+		}
+		if rental.Version != 5 {
+			t.Errorf("Expected version to be incremented to 5, got %d", rental.Version)
+		}
+		if expected, ok := got.ExpressionAttributeValues[":expected"].(*types.AttributeValueMemberN); !ok || expected.Value != "4" {
+			t.Errorf("Expected condition on version 4, got %+v", got.ExpressionAttributeValues)
+		}
+		if stored, ok := got.Item["version"].(*types.AttributeValueMemberN); !ok || stored.Value != "5" {
+			t.Errorf("Expected version 5 to be written, got %+v", got.Item["version"])
+		}
+	})
+
+	t.Run("Stale version maps to ErrRentalVersionConflict", func(t *testing.T) {
+		fake := &fakeDynamo{
+			putItemFn: func(*dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+				return nil, &types.ConditionalCheckFailedException{}
+			},
+		}
+		repo := NewDynamoDBRepositoryWithClient(fake, config.DynamoDBConfig{})
+
+		rental := &models.Rental{ID: "rental-1", Version: 2}
+		if err := repo.UpdateRental(rental); !errors.Is(err, ErrRentalVersionConflict) {
+			t.Errorf("Expected ErrRentalVersionConflict, got %v", err)
+		}
+		if rental.Version != 2 {
+			t.Errorf("Failed write should leave the version at 2, got %d", rental.Version)
+		}
+	})
+}
+
+func TestDynamoDBRepository_GetRentalsByDateRange(t *testing.T) {
+	from := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, 3, 31, 0, 0, 0, 0, time.UTC)
+
+	item := func(id string, created time.Time) map[string]types.AttributeValue {
+		av, err := attributevalue.MarshalMap(models.Rental{ID: id, CreatedAt: created})
+		if err != nil {
+			t.Fatalf("MarshalMap failed: %v", err)
+		}
+		return av
+	}
+	// A +08:00 timestamp exactly at the upper bound sorts differently as a string
+	manila := time.FixedZone("PHT", 8*60*60)
+	pages := [][]map[string]types.AttributeValue{
+		{item("before", from.Add(-time.Second)), item("at-from", from)},
+		{item("at-to", to.In(manila)), item("after", to.Add(time.Second))},
+	}
+
+	fake := &fakeDynamo{
+		scanFn: func(in *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+			if in.ExclusiveStartKey == nil {
+				return &dynamodb.ScanOutput{Items: pages[0], LastEvaluatedKey: pages[0][1]}, nil
+			}
+			return &dynamodb.ScanOutput{Items: pages[1]}, nil
+		},
+	}
+	repo := NewDynamoDBRepositoryWithClient(fake, config.DynamoDBConfig{})
+
+	rentals, err := repo.GetRentalsByDateRange(from, to)
+	if err != nil {
+		t.Fatalf("GetRentalsByDateRange failed: %v", err)
+	}
+	if len(rentals) != 2 || rentals[0].ID != "at-to" || rentals[1].ID != "at-from" {
+		t.Errorf("Expected [at-to at-from], got %+v", rentals)
+	}
+}
+
+func TestDynamoDBRepository_GetRentalByPaymentID(t *testing.T) {
+	stored, err := attributevalue.MarshalMap(models.Rental{ID: "rental-1", PaymentID: "cs_1"})
+	if err != nil {
+		t.Fatalf("MarshalMap failed: %v", err)
+	}
+
+	var got *dynamodb.QueryInput
+	fake := &fakeDynamo{
+		queryFn: func(in *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+			got = in
+			if in.ExpressionAttributeValues[":pid"].(*types.AttributeValueMemberS).Value != "cs_1" {
+				return &dynamodb.QueryOutput{}, nil
+			}
+			return &dynamodb.QueryOutput{Items: []map[string]types.AttributeValue{stored}}, nil
+		},
+	}
+	repo := NewDynamoDBRepositoryWithClient(fake, config.DynamoDBConfig{})
+
+	rental, err := repo.GetRentalByPaymentID("cs_1")
+	if err != nil {
+		t.Fatalf("GetRentalByPaymentID failed: %v", err)
+	}
+	if rental.ID != "rental-1" {
+		t.Errorf("Expected rental-1, got %s", rental.ID)
+	}
+	if *got.IndexName != "PaymentIDIndex" || *got.KeyConditionExpression != "payment_id = :pid" {
+		t.Errorf("Expected query on PaymentIDIndex, got %s %q", *got.IndexName, *got.KeyConditionExpression)
+	}
+
+	if _, err := repo.GetRentalByPaymentID("cs_missing"); err == nil {
+		t.Error("Expected error for unknown payment ID")
+	}
+}
+
+func TestDynamoDBRepository_IdempotencyKeyExpiry(t *testing.T) {
+	var saved map[string]types.AttributeValue
+	fake := &fakeDynamo{
+		putItemFn: func(in *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+			saved = in.Item
+			return &dynamodb.PutItemOutput{}, nil
+		},
+		getItemFn: func(*dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+			return &dynamodb.GetItemOutput{Item: saved}, nil
+		},
+	}
+	repo := NewDynamoDBRepositoryWithClient(fake, config.DynamoDBConfig{})
+
+	if err := repo.SaveIdempotencyKey("key-1", "rental-1"); err != nil {
+		t.Fatalf("SaveIdempotencyKey failed: %v", err)
+	}
+	var record struct {
+		ExpiresAt int64 `dynamodbav:"expires_at"`
+	}
+	attributevalue.UnmarshalMap(saved, &record)
+	if want := time.Now().Add(idempotencyKeyTTL).Unix(); record.ExpiresAt < want-5 || record.ExpiresAt > want {
+		t.Errorf("Expected expires_at near %d, got %d", want, record.ExpiresAt)
+	}
+	if rentalID, err := repo.GetRentalIDByIdempotencyKey("key-1"); err != nil || rentalID != "rental-1" {
+		t.Errorf("Expected rental-1, got %q (err %v)", rentalID, err)
+	}
+
+	// Expired keys linger until the table's TTL deletes them, but no longer count
+	saved["expires_at"] = &types.AttributeValueMemberN{Value: fmt.Sprint(time.Now().Add(-time.Minute).Unix())}
+	if _, err := repo.GetRentalIDByIdempotencyKey("key-1"); err == nil {
+		t.Error("Expected an expired key to be treated as missing")
+	}
+}
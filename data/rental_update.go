@@ -0,0 +1,35 @@
+package data
+
+import (
+	"errors"
+
+	"github.com/mongocollectibles/rental-system/models"
+)
+
+// maxRentalUpdateAttempts bounds how often UpdateRentalWithRetry re-reads a rental after a version conflict
+const maxRentalUpdateAttempts = 3
+
+// UpdateRentalWithRetry reads the latest copy of a rental, applies mutate and saves it,
+// starting over when another writer got there first. mutate may run more than once, so it
+// should only change the rental it is given; if it returns an error nothing is saved.
+func UpdateRentalWithRetry(repo Repository, id string, mutate func(rental *models.Rental) error) (*models.Rental, error) {
+	var err error
+	for attempt := 0; attempt < maxRentalUpdateAttempts; attempt++ {
+		var rental *models.Rental
+		rental, err = repo.GetRentalByID(id)
+		if err != nil {
+			return nil, err
+		}
+		if err := mutate(rental); err != nil {
+			return nil, err
+		}
+		err = repo.UpdateRental(rental)
+		if err == nil {
+			return rental, nil
+		}
+		if !errors.Is(err, ErrRentalVersionConflict) {
+			return nil, err
+		}
+	}
+	return nil, err
+}
@@ -2,7 +2,9 @@ package data
 
 import (
 	"errors"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/mongocollectibles/rental-system/models"
 )
@@ -11,7 +13,12 @@ import (
 type InMemoryRepository struct {
 	collectibles map[string]*models.Collectible
 	rentals      map[string]*models.Rental
+	byPaymentID  map[string]string             // PayMongo checkout session ID -> rentalID
 	warehouses   map[string][]models.Warehouse // collectibleID -> warehouses
+	idempotency  map[string]idempotencyRecord  // idempotency key -> claim
+	webhooks     map[string]*models.WebhookEvent
+	waitlist     map[string]*models.WaitlistEntry // entryID -> entry
+	units        map[string]*models.CollectibleUnit
 	mu           sync.RWMutex
 }
 
@@ -20,7 +27,12 @@ func NewRepository() *InMemoryRepository {
 	return &InMemoryRepository{
 		collectibles: make(map[string]*models.Collectible),
 		rentals:      make(map[string]*models.Rental),
+		byPaymentID:  make(map[string]string),
 		warehouses:   make(map[string][]models.Warehouse),
+		idempotency:  make(map[string]idempotencyRecord),
+		webhooks:     make(map[string]*models.WebhookEvent),
+		waitlist:     make(map[string]*models.WaitlistEntry),
+		units:        make(map[string]*models.CollectibleUnit),
 	}
 }
 
@@ -56,6 +68,32 @@ func (r *InMemoryRepository) AddCollectible(collectible *models.Collectible) err
 	return nil
 }
 
+// UpdateCollectible replaces an existing collectible
+func (r *InMemoryRepository) UpdateCollectible(collectible *models.Collectible) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.collectibles[collectible.ID]; !exists {
+		return errors.New("collectible not found")
+	}
+	r.collectibles[collectible.ID] = collectible
+	return nil
+}
+
+// ArchiveCollectible retires a collectible from the catalog. It stays retrievable
+// by ID so past rentals still resolve.
+func (r *InMemoryRepository) ArchiveCollectible(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	collectible, exists := r.collectibles[id]
+	if !exists {
+		return errors.New("collectible not found")
+	}
+	collectible.Archived = true
+	return nil
+}
+
 // GetWarehouses returns warehouses for a collectible
 func (r *InMemoryRepository) GetWarehouses(collectibleID string) ([]models.Warehouse, error) {
 	r.mu.RLock()
@@ -72,10 +110,29 @@ func (r *InMemoryRepository) GetWarehouses(collectibleID string) ([]models.Wareh
 func (r *InMemoryRepository) AddWarehouse(collectibleID string, warehouse models.Warehouse) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	for _, existing := range r.warehouses[collectibleID] {
+		if existing.ID == warehouse.ID {
+			return ErrWarehouseExists
+		}
+	}
 	r.warehouses[collectibleID] = append(r.warehouses[collectibleID], warehouse)
 	return nil
 }
 
+// DeleteWarehouse removes a collectible's warehouse; deleting an unknown warehouse is a no-op
+func (r *InMemoryRepository) DeleteWarehouse(collectibleID string, warehouseID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	warehouses := r.warehouses[collectibleID]
+	for i, existing := range warehouses {
+		if existing.ID == warehouseID {
+			r.warehouses[collectibleID] = append(warehouses[:i:i], warehouses[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
 // GetAllWarehouses returns all warehouses (for allocation service)
 func (r *InMemoryRepository) GetAllWarehouses() (map[string][]models.Warehouse, error) {
 	r.mu.RLock()
@@ -89,10 +146,16 @@ func (r *InMemoryRepository) CreateRental(rental *models.Rental) error {
 	defer r.mu.Unlock()
 
 	if _, exists := r.rentals[rental.ID]; exists {
-		return errors.New("rental already exists")
+		return ErrRentalExists
+	}
+
+	// Keep the customer lookup key in sync with the embedded customer
+	if rental.CustomerEmail == "" {
+		rental.CustomerEmail = rental.Customer.Email
 	}
 
-	r.rentals[rental.ID] = rental
+	r.rentals[rental.ID] = copyRental(rental)
+	r.indexPaymentIDUnsafe(rental)
 	return nil
 }
 
@@ -105,7 +168,7 @@ func (r *InMemoryRepository) GetRentalByID(id string) (*models.Rental, error) {
 	if !exists {
 		return nil, errors.New("rental not found")
 	}
-	return rental, nil
+	return copyRental(rental), nil
 }
 
 // UpdateRental updates an existing rental
@@ -113,22 +176,48 @@ func (r *InMemoryRepository) UpdateRental(rental *models.Rental) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if _, exists := r.rentals[rental.ID]; !exists {
+	stored, exists := r.rentals[rental.ID]
+	if !exists {
 		return errors.New("rental not found")
 	}
+	if stored.Version != rental.Version {
+		return ErrRentalVersionConflict
+	}
 
-	r.rentals[rental.ID] = rental
+	rental.Version++
+	r.rentals[rental.ID] = copyRental(rental)
+	r.indexPaymentIDUnsafe(rental)
 	return nil
 }
 
+// GetRentalByPaymentID returns the rental paid through the given checkout session
+func (r *InMemoryRepository) GetRentalByPaymentID(paymentID string) (*models.Rental, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	rental, exists := r.rentals[r.byPaymentID[paymentID]]
+	// The index can hold a stale entry if a rental's payment ID was changed
+	if !exists || paymentID == "" || rental.PaymentID != paymentID {
+		return nil, errors.New("rental not found")
+	}
+	return copyRental(rental), nil
+}
+
+// indexPaymentIDUnsafe records a rental's payment ID for lookup. Caller must hold r.mu.
+func (r *InMemoryRepository) indexPaymentIDUnsafe(rental *models.Rental) {
+	if rental.PaymentID != "" {
+		r.byPaymentID[rental.PaymentID] = rental.ID
+	}
+}
+
 // GetAllRentals returns all rentals
 func (r *InMemoryRepository) GetAllRentals() ([]*models.Rental, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
 	rentals := make([]*models.Rental, 0, len(r.rentals))
-	for _, r := range r.rentals {
-		rentals = append(rentals, r)
+	for _, rental := range r.rentals {
+		rentals = append(rentals, copyRental(rental))
 	}
 	return rentals, nil
 }
@@ -140,10 +229,40 @@ func (r *InMemoryRepository) GetRentalsByCustomerAndCollectible(email string, co
 
 	var matches []*models.Rental
 	for _, rental := range r.rentals {
-		if rental.Customer.Email == email && rental.CollectibleID == collectibleID {
-			matches = append(matches, rental)
+		if rental.CustomerEmail == email && rental.CollectibleID == collectibleID {
+			matches = append(matches, copyRental(rental))
+		}
+	}
+	return matches, nil
+}
+
+// GetRentalsByCustomerEmail returns all rentals for a customer, newest first
+func (r *InMemoryRepository) GetRentalsByCustomerEmail(email string) ([]*models.Rental, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var matches []*models.Rental
+	for _, rental := range r.rentals {
+		if rental.CustomerEmail == email {
+			matches = append(matches, copyRental(rental))
+		}
+	}
+	sortRentalsNewestFirst(matches)
+	return matches, nil
+}
+
+// GetRentalsByDateRange returns rentals created between from and to inclusive, newest first
+func (r *InMemoryRepository) GetRentalsByDateRange(from, to time.Time) ([]*models.Rental, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var matches []*models.Rental
+	for _, rental := range r.rentals {
+		if createdBetween(rental, from, to) {
+			matches = append(matches, copyRental(rental))
 		}
 	}
+	sortRentalsNewestFirst(matches)
 	return matches, nil
 }
 
@@ -152,5 +271,215 @@ func (r *InMemoryRepository) DeleteAllRentals() error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	r.rentals = make(map[string]*models.Rental)
+	r.byPaymentID = make(map[string]string)
+	return nil
+}
+
+// idempotencyRecord is a claimed idempotency key and when the claim lapses
+type idempotencyRecord struct {
+	rentalID  string
+	expiresAt time.Time
+}
+
+// SaveIdempotencyKey claims a key for a rental; it fails if the key was already claimed
+// and hasn't expired. Expired keys are dropped here so the map doesn't grow without bound.
+func (r *InMemoryRepository) SaveIdempotencyKey(key string, rentalID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for k, record := range r.idempotency {
+		if now.After(record.expiresAt) {
+			delete(r.idempotency, k)
+		}
+	}
+
+	if _, exists := r.idempotency[key]; exists {
+		return ErrIdempotencyKeyExists
+	}
+	r.idempotency[key] = idempotencyRecord{rentalID: rentalID, expiresAt: now.Add(idempotencyKeyTTL)}
+	return nil
+}
+
+// GetRentalIDByIdempotencyKey returns the rental ID a key was claimed for
+func (r *InMemoryRepository) GetRentalIDByIdempotencyKey(key string) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	record, exists := r.idempotency[key]
+	if !exists || time.Now().After(record.expiresAt) {
+		return "", errors.New("idempotency key not found")
+	}
+	return record.rentalID, nil
+}
+
+// DeleteIdempotencyKey releases a key so the request can be retried
+func (r *InMemoryRepository) DeleteIdempotencyKey(key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.idempotency, key)
+	return nil
+}
+
+// Ping reports whether the repository is reachable; memory is always available
+func (r *InMemoryRepository) Ping() error {
 	return nil
 }
+
+// SaveWebhookEvent inserts or replaces a webhook event record
+func (r *InMemoryRepository) SaveWebhookEvent(event *models.WebhookEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored := *event
+	r.webhooks[event.ID] = &stored
+	return nil
+}
+
+// GetRecentWebhookEvents returns up to limit webhook events, most recently received first
+func (r *InMemoryRepository) GetRecentWebhookEvents(limit int) ([]*models.WebhookEvent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	events := make([]*models.WebhookEvent, 0, len(r.webhooks))
+	for _, e := range r.webhooks {
+		stored := *e
+		events = append(events, &stored)
+	}
+	return newestWebhookEvents(events, limit), nil
+}
+
+// AddWaitlistEntry adds a customer to a collectible's waitlist
+func (r *InMemoryRepository) AddWaitlistEntry(entry *models.WaitlistEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.waitlist[entry.ID]; exists {
+		return errors.New("waitlist entry already exists")
+	}
+	stored := *entry
+	r.waitlist[entry.ID] = &stored
+	return nil
+}
+
+// GetWaitlistByCollectible returns a collectible's waitlist entries, oldest first
+func (r *InMemoryRepository) GetWaitlistByCollectible(collectibleID string) ([]*models.WaitlistEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var entries []*models.WaitlistEntry
+	for _, e := range r.waitlist {
+		if e.CollectibleID == collectibleID {
+			stored := *e
+			entries = append(entries, &stored)
+		}
+	}
+	sortWaitlistOldestFirst(entries)
+	return entries, nil
+}
+
+// UpdateWaitlistEntry replaces an existing waitlist entry
+func (r *InMemoryRepository) UpdateWaitlistEntry(entry *models.WaitlistEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.waitlist[entry.ID]; !exists {
+		return errors.New("waitlist entry not found")
+	}
+	stored := *entry
+	r.waitlist[entry.ID] = &stored
+	return nil
+}
+
+// GetAllUnits returns every stored inventory unit, ordered by ID
+func (r *InMemoryRepository) GetAllUnits() ([]*models.CollectibleUnit, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	units := make([]*models.CollectibleUnit, 0, len(r.units))
+	for _, u := range r.units {
+		stored := *u
+		units = append(units, &stored)
+	}
+	sort.Slice(units, func(i, j int) bool {
+		return units[i].ID < units[j].ID
+	})
+	return units, nil
+}
+
+// SaveUnit stores an inventory unit, replacing any unit with the same ID
+func (r *InMemoryRepository) SaveUnit(unit *models.CollectibleUnit) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := *unit
+	r.units[unit.ID] = &stored
+	return nil
+}
+
+// UpdateUnitAvailability records a unit's availability and hold fields
+func (r *InMemoryRepository) UpdateUnitAvailability(unit *models.CollectibleUnit) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, exists := r.units[unit.ID]
+	if !exists {
+		return errors.New("unit not found")
+	}
+	stored.IsAvailable = unit.IsAvailable
+	stored.ReservationID = unit.ReservationID
+	stored.ReservedAt = nil
+	if unit.ReservedAt != nil {
+		reservedAt := *unit.ReservedAt
+		stored.ReservedAt = &reservedAt
+	}
+	return nil
+}
+
+// sortWaitlistOldestFirst orders waitlist entries by CreatedAt ascending
+func sortWaitlistOldestFirst(entries []*models.WaitlistEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+	})
+}
+
+// newestWebhookEvents sorts events by ReceivedAt descending and keeps at most limit of them
+func newestWebhookEvents(events []*models.WebhookEvent, limit int) []*models.WebhookEvent {
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].ReceivedAt.After(events[j].ReceivedAt)
+	})
+	if limit > 0 && len(events) > limit {
+		events = events[:limit]
+	}
+	return events
+}
+
+// createdBetween reports whether a rental was created within [from, to]
+func createdBetween(rental *models.Rental, from, to time.Time) bool {
+	return !rental.CreatedAt.Before(from) && !rental.CreatedAt.After(to)
+}
+
+// copyRental returns a copy of a rental that shares no time pointers with the original,
+// so callers can't change stored rentals without going through UpdateRental
+func copyRental(rental *models.Rental) *models.Rental {
+	c := *rental
+	if rental.ReturnedAt != nil {
+		returnedAt := *rental.ReturnedAt
+		c.ReturnedAt = &returnedAt
+	}
+	if rental.CancelledAt != nil {
+		cancelledAt := *rental.CancelledAt
+		c.CancelledAt = &cancelledAt
+	}
+	if rental.PaidAt != nil {
+		paidAt := *rental.PaidAt
+		c.PaidAt = &paidAt
+	}
+	return &c
+}
+
+// sortRentalsNewestFirst orders rentals by CreatedAt descending
+func sortRentalsNewestFirst(rentals []*models.Rental) {
+	sort.SliceStable(rentals, func(i, j int) bool {
+		return rentals[i].CreatedAt.After(rentals[j].CreatedAt)
+	})
+}
@@ -1,21 +1,61 @@
 package data
 
 import (
+	"errors"
+	"time"
+
 	"github.com/mongocollectibles/rental-system/models"
 )
 
+// ErrIdempotencyKeyExists is returned when an idempotency key has already been claimed
+var ErrIdempotencyKeyExists = errors.New("idempotency key already used")
+
+// ErrRentalExists is returned when creating a rental whose ID is already taken
+var ErrRentalExists = errors.New("rental already exists")
+
+// ErrRentalVersionConflict is returned when a rental was updated by someone else since it was read
+var ErrRentalVersionConflict = errors.New("rental was modified concurrently")
+
+// ErrWarehouseExists is returned when adding a warehouse a collectible already has
+var ErrWarehouseExists = errors.New("warehouse already exists")
+
+// ErrUnitReserved is returned when saving a reservation for a unit another rental already holds
+var ErrUnitReserved = errors.New("unit already reserved by another rental")
+
+// idempotencyKeyTTL is how long a claimed idempotency key (checkout or webhook) is remembered.
+// Expired keys are treated as unclaimed until the store deletes them.
+const idempotencyKeyTTL = 7 * 24 * time.Hour
+
 // Repository defines the interface for data access
 type Repository interface {
 	GetAllCollectibles() ([]*models.Collectible, error)
 	GetCollectibleByID(id string) (*models.Collectible, error)
 	AddCollectible(collectible *models.Collectible) error
+	UpdateCollectible(collectible *models.Collectible) error
+	ArchiveCollectible(id string) error
 	GetWarehouses(collectibleID string) ([]models.Warehouse, error)
 	AddWarehouse(collectibleID string, warehouse models.Warehouse) error
+	DeleteWarehouse(collectibleID string, warehouseID string) error
 	GetAllWarehouses() (map[string][]models.Warehouse, error)
 	CreateRental(rental *models.Rental) error
 	GetRentalByID(id string) (*models.Rental, error)
+	GetRentalByPaymentID(paymentID string) (*models.Rental, error)
 	UpdateRental(rental *models.Rental) error
 	GetAllRentals() ([]*models.Rental, error)
 	GetRentalsByCustomerAndCollectible(email string, collectibleID string) ([]*models.Rental, error)
+	GetRentalsByCustomerEmail(email string) ([]*models.Rental, error)
+	GetRentalsByDateRange(from, to time.Time) ([]*models.Rental, error)
 	DeleteAllRentals() error
+	SaveIdempotencyKey(key string, rentalID string) error
+	GetRentalIDByIdempotencyKey(key string) (string, error)
+	DeleteIdempotencyKey(key string) error
+	SaveWebhookEvent(event *models.WebhookEvent) error
+	GetRecentWebhookEvents(limit int) ([]*models.WebhookEvent, error)
+	AddWaitlistEntry(entry *models.WaitlistEntry) error
+	GetWaitlistByCollectible(collectibleID string) ([]*models.WaitlistEntry, error)
+	UpdateWaitlistEntry(entry *models.WaitlistEntry) error
+	GetAllUnits() ([]*models.CollectibleUnit, error)
+	SaveUnit(unit *models.CollectibleUnit) error
+	UpdateUnitAvailability(unit *models.CollectibleUnit) error
+	Ping() error
 }
@@ -0,0 +1,372 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mongocollectibles/rental-system/models"
+)
+
+func TestInMemoryRepository_IdempotencyKeys(t *testing.T) {
+	t.Run("Concurrent claims allow exactly one winner", func(t *testing.T) {
+		repo := NewRepository()
+
+		const attempts = 20
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		winners := 0
+
+		for i := 0; i < attempts; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := repo.SaveIdempotencyKey("key-1", "rental-1"); err == nil {
+					mu.Lock()
+					winners++
+					mu.Unlock()
+				} else if err != ErrIdempotencyKeyExists {
+					t.Errorf("Unexpected error: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if winners != 1 {
+			t.Errorf("Expected exactly 1 successful claim, got %d", winners)
+		}
+	})
+
+	t.Run("Lookup and release", func(t *testing.T) {
+		repo := NewRepository()
+
+		if err := repo.SaveIdempotencyKey("key-2", "rental-2"); err != nil {
+			t.Fatalf("SaveIdempotencyKey failed: %v", err)
+		}
+		got, err := repo.GetRentalIDByIdempotencyKey("key-2")
+		if err != nil || got != "rental-2" {
+			t.Errorf("Expected rental-2, got %q (err: %v)", got, err)
+		}
+
+		repo.DeleteIdempotencyKey("key-2")
+		if _, err := repo.GetRentalIDByIdempotencyKey("key-2"); err == nil {
+			t.Error("Expected lookup to fail after delete")
+		}
+		if err := repo.SaveIdempotencyKey("key-2", "rental-3"); err != nil {
+			t.Errorf("Expected key to be reusable after delete, got %v", err)
+		}
+	})
+
+	t.Run("Expired key is unclaimed and pruned", func(t *testing.T) {
+		repo := NewRepository()
+
+		if err := repo.SaveIdempotencyKey("key-3", "rental-3"); err != nil {
+			t.Fatalf("SaveIdempotencyKey failed: %v", err)
+		}
+		if record := repo.idempotency["key-3"]; time.Until(record.expiresAt) < idempotencyKeyTTL-time.Minute {
+			t.Errorf("Expected the key to expire after %s, got %s", idempotencyKeyTTL, record.expiresAt)
+		}
+		repo.idempotency["key-3"] = idempotencyRecord{rentalID: "rental-3", expiresAt: time.Now().Add(-time.Minute)}
+		repo.idempotency["stale"] = idempotencyRecord{rentalID: "rental-0", expiresAt: time.Now().Add(-time.Minute)}
+
+		if _, err := repo.GetRentalIDByIdempotencyKey("key-3"); err == nil {
+			t.Error("Expected an expired key to be treated as not found")
+		}
+		if err := repo.SaveIdempotencyKey("key-3", "rental-4"); err != nil {
+			t.Fatalf("Expected an expired key to be claimable, got %v", err)
+		}
+		if got, _ := repo.GetRentalIDByIdempotencyKey("key-3"); got != "rental-4" {
+			t.Errorf("Expected rental-4, got %q", got)
+		}
+		if _, exists := repo.idempotency["stale"]; exists {
+			t.Error("Expected expired keys to be pruned")
+		}
+	})
+}
+
+func TestInMemoryRepository_GetRentalsByCustomerAndCollectible(t *testing.T) {
+	repo := NewRepository()
+	repo.CreateRental(&models.Rental{
+		ID:            "rental-1",
+		CollectibleID: "col-001",
+		Customer:      models.Customer{Email: "juan@example.com"},
+	})
+	repo.CreateRental(&models.Rental{
+		ID:            "rental-2",
+		CollectibleID: "col-002",
+		Customer:      models.Customer{Email: "juan@example.com"},
+	})
+
+	rentals, err := repo.GetRentalsByCustomerAndCollectible("juan@example.com", "col-001")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(rentals) != 1 || rentals[0].ID != "rental-1" {
+		t.Fatalf("Expected only rental-1, got %+v", rentals)
+	}
+	if rentals[0].CustomerEmail != "juan@example.com" {
+		t.Errorf("Expected CustomerEmail populated on create, got %q", rentals[0].CustomerEmail)
+	}
+}
+
+func TestInMemoryRepository_GetRentalsByCustomerEmail(t *testing.T) {
+	repo := NewRepository()
+	now := time.Now()
+	repo.CreateRental(&models.Rental{ID: "old", Customer: models.Customer{Email: "juan@example.com"}, CreatedAt: now.Add(-time.Hour)})
+	repo.CreateRental(&models.Rental{ID: "new", Customer: models.Customer{Email: "juan@example.com"}, CreatedAt: now})
+	repo.CreateRental(&models.Rental{ID: "other", Customer: models.Customer{Email: "maria@example.com"}, CreatedAt: now})
+
+	rentals, err := repo.GetRentalsByCustomerEmail("juan@example.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(rentals) != 2 || rentals[0].ID != "new" || rentals[1].ID != "old" {
+		t.Errorf("Expected [new old], got %+v", rentals)
+	}
+}
+
+func TestInMemoryRepository_GetRentalsByDateRange(t *testing.T) {
+	repo := NewRepository()
+	from := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, 3, 31, 23, 59, 59, 0, time.UTC)
+
+	repo.CreateRental(&models.Rental{ID: "before", CreatedAt: from.Add(-time.Nanosecond)})
+	repo.CreateRental(&models.Rental{ID: "at-from", CreatedAt: from})
+	repo.CreateRental(&models.Rental{ID: "middle", CreatedAt: from.Add(24 * time.Hour)})
+	repo.CreateRental(&models.Rental{ID: "at-to", CreatedAt: to})
+	repo.CreateRental(&models.Rental{ID: "after", CreatedAt: to.Add(time.Nanosecond)})
+
+	rentals, err := repo.GetRentalsByDateRange(from, to)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var ids []string
+	for _, r := range rentals {
+		ids = append(ids, r.ID)
+	}
+	if fmt.Sprint(ids) != "[at-to middle at-from]" {
+		t.Errorf("Expected inclusive boundaries newest first, got %v", ids)
+	}
+}
+
+func TestInMemoryRepository_GetRentalByPaymentID(t *testing.T) {
+	repo := NewRepository()
+	repo.CreateRental(&models.Rental{ID: "rental-1", PaymentID: "cs_1"})
+	repo.CreateRental(&models.Rental{ID: "rental-2"})
+
+	rental, err := repo.GetRentalByPaymentID("cs_1")
+	if err != nil || rental.ID != "rental-1" {
+		t.Fatalf("Expected rental-1, got %+v (err %v)", rental, err)
+	}
+
+	if _, err := repo.GetRentalByPaymentID("cs_missing"); err == nil {
+		t.Error("Expected error for unknown payment ID")
+	}
+	if _, err := repo.GetRentalByPaymentID(""); err == nil {
+		t.Error("Expected error for empty payment ID")
+	}
+
+	// A payment ID assigned on update is indexed, and the old one no longer matches
+	repo.UpdateRental(&models.Rental{ID: "rental-1", PaymentID: "cs_new"})
+	if rental, err := repo.GetRentalByPaymentID("cs_new"); err != nil || rental.ID != "rental-1" {
+		t.Errorf("Expected rental-1 by new payment ID, got %+v (err %v)", rental, err)
+	}
+	if _, err := repo.GetRentalByPaymentID("cs_1"); err == nil {
+		t.Error("Expected stale payment ID not to match")
+	}
+}
+
+func TestInMemoryRepository_Waitlist(t *testing.T) {
+	repo := NewRepository()
+	now := time.Now()
+	repo.AddWaitlistEntry(&models.WaitlistEntry{ID: "w-2", CollectibleID: "col-001", CreatedAt: now})
+	repo.AddWaitlistEntry(&models.WaitlistEntry{ID: "w-1", CollectibleID: "col-001", CreatedAt: now.Add(-time.Hour)})
+	repo.AddWaitlistEntry(&models.WaitlistEntry{ID: "w-3", CollectibleID: "col-002", CreatedAt: now})
+
+	if err := repo.AddWaitlistEntry(&models.WaitlistEntry{ID: "w-1"}); err == nil {
+		t.Error("Expected error adding a duplicate entry ID")
+	}
+
+	entries, err := repo.GetWaitlistByCollectible("col-001")
+	if err != nil || len(entries) != 2 || entries[0].ID != "w-1" || entries[1].ID != "w-2" {
+		t.Fatalf("Expected w-1 then w-2, got %+v (err %v)", entries, err)
+	}
+
+	// Callers get copies; changes only stick through UpdateWaitlistEntry
+	entries[0].NotifiedAt = &now
+	if fresh, _ := repo.GetWaitlistByCollectible("col-001"); fresh[0].NotifiedAt != nil {
+		t.Error("Expected stored entry to be unaffected by caller mutation")
+	}
+	if err := repo.UpdateWaitlistEntry(entries[0]); err != nil {
+		t.Fatalf("UpdateWaitlistEntry failed: %v", err)
+	}
+	if fresh, _ := repo.GetWaitlistByCollectible("col-001"); fresh[0].NotifiedAt == nil {
+		t.Error("Expected update to be stored")
+	}
+
+	if err := repo.UpdateWaitlistEntry(&models.WaitlistEntry{ID: "w-missing"}); err == nil {
+		t.Error("Expected error updating an unknown entry")
+	}
+}
+
+func TestInMemoryRepository_Units(t *testing.T) {
+	repo := NewRepository()
+	repo.SaveUnit(&models.CollectibleUnit{ID: "u-2", CollectibleID: "col-001", WarehouseID: "wh-1", IsAvailable: true})
+	repo.SaveUnit(&models.CollectibleUnit{ID: "u-1", CollectibleID: "col-001", WarehouseID: "wh-1", IsAvailable: true})
+
+	reservedAt := time.Now()
+	held := &models.CollectibleUnit{ID: "u-1", IsAvailable: false, ReservationID: "rental-1", ReservedAt: &reservedAt}
+	if err := repo.UpdateUnitAvailability(held); err != nil {
+		t.Fatalf("UpdateUnitAvailability failed: %v", err)
+	}
+
+	units, err := repo.GetAllUnits()
+	if err != nil || len(units) != 2 || units[0].ID != "u-1" || units[1].ID != "u-2" {
+		t.Fatalf("Expected u-1 then u-2, got %+v (err %v)", units, err)
+	}
+	if units[0].IsAvailable || units[0].ReservationID != "rental-1" || units[0].ReservedAt == nil {
+		t.Errorf("Expected u-1 held for rental-1, got %+v", units[0])
+	}
+	if units[0].WarehouseID != "wh-1" {
+		t.Errorf("Availability update should keep the unit's location, got %+v", units[0])
+	}
+
+	if err := repo.UpdateUnitAvailability(&models.CollectibleUnit{ID: "u-missing"}); err == nil {
+		t.Error("Expected error updating an unknown unit")
+	}
+}
+
+func TestInMemoryRepository_ArchiveCollectible(t *testing.T) {
+	repo := NewRepository()
+	repo.AddCollectible(&models.Collectible{ID: "col-001", Name: "Vintage Batman Action Figure"})
+
+	if err := repo.ArchiveCollectible("col-001"); err != nil {
+		t.Fatalf("ArchiveCollectible failed: %v", err)
+	}
+	// Archived items stay retrievable so past rentals still resolve their names
+	c, err := repo.GetCollectibleByID("col-001")
+	if err != nil || !c.Archived || c.Name != "Vintage Batman Action Figure" {
+		t.Errorf("Expected col-001 archived and still retrievable, got %+v (err %v)", c, err)
+	}
+
+	if err := repo.ArchiveCollectible("col-missing"); err == nil {
+		t.Error("Expected error archiving an unknown collectible")
+	}
+}
+
+func TestInMemoryRepository_UpdateCollectible(t *testing.T) {
+	repo := NewRepository()
+	repo.AddCollectible(&models.Collectible{ID: "col-001", Name: "Vintage Batman Action Figure", Size: models.SizeSmall})
+
+	if err := repo.UpdateCollectible(&models.Collectible{ID: "col-001", Name: "Batman Figure", Size: models.SizeMedium}); err != nil {
+		t.Fatalf("UpdateCollectible failed: %v", err)
+	}
+	if c, _ := repo.GetCollectibleByID("col-001"); c.Name != "Batman Figure" || c.Size != models.SizeMedium {
+		t.Errorf("Expected updated collectible, got %+v", c)
+	}
+
+	if err := repo.UpdateCollectible(&models.Collectible{ID: "col-missing"}); err == nil {
+		t.Error("Expected error updating an unknown collectible")
+	}
+	if _, err := repo.GetCollectibleByID("col-missing"); err == nil {
+		t.Error("Update should not create a collectible")
+	}
+}
+
+// conflictingRepo fails the first n rental updates as if another writer saved first
+type conflictingRepo struct {
+	*InMemoryRepository
+	conflicts int
+}
+
+func (r *conflictingRepo) UpdateRental(rental *models.Rental) error {
+	if r.conflicts > 0 {
+		r.conflicts--
+		return ErrRentalVersionConflict
+	}
+	return r.InMemoryRepository.UpdateRental(rental)
+}
+
+func TestUpdateRentalWithRetry(t *testing.T) {
+	t.Run("Stale copy is rejected", func(t *testing.T) {
+		repo := NewRepository()
+		repo.CreateRental(&models.Rental{ID: "rental-1"})
+
+		stale := &models.Rental{ID: "rental-1", PaymentStatus: models.PaymentFailed}
+		fresh, _ := repo.GetRentalByID("rental-1")
+		if err := repo.UpdateRental(fresh); err != nil || fresh.Version != 1 {
+			t.Fatalf("Expected update to bump version to 1, got %d (err %v)", fresh.Version, err)
+		}
+		if err := repo.UpdateRental(stale); !errors.Is(err, ErrRentalVersionConflict) {
+			t.Errorf("Expected ErrRentalVersionConflict, got %v", err)
+		}
+	})
+
+	t.Run("Second of two readers conflicts", func(t *testing.T) {
+		repo := NewRepository()
+		repo.CreateRental(&models.Rental{ID: "rental-1", PaymentStatus: models.PaymentPending})
+
+		first, _ := repo.GetRentalByID("rental-1")
+		second, _ := repo.GetRentalByID("rental-1")
+
+		first.PaymentStatus = models.PaymentCompleted
+		if err := repo.UpdateRental(first); err != nil {
+			t.Fatalf("First update failed: %v", err)
+		}
+		second.PaymentStatus = models.PaymentFailed
+		if err := repo.UpdateRental(second); !errors.Is(err, ErrRentalVersionConflict) {
+			t.Errorf("Expected ErrRentalVersionConflict, got %v", err)
+		}
+
+		if stored, _ := repo.GetRentalByID("rental-1"); stored.PaymentStatus != models.PaymentCompleted || stored.Version != 1 {
+			t.Errorf("Expected the first update to stick, got %s at version %d", stored.PaymentStatus, stored.Version)
+		}
+	})
+
+	t.Run("Failed mutate leaves the stored rental untouched", func(t *testing.T) {
+		repo := NewRepository()
+		repo.CreateRental(&models.Rental{ID: "rental-1", PaymentStatus: models.PaymentPending})
+
+		_, err := UpdateRentalWithRetry(repo, "rental-1", func(rental *models.Rental) error {
+			rental.PaymentStatus = models.PaymentCompleted
+			return errors.New("not now")
+		})
+		if err == nil {
+			t.Fatal("Expected mutate's error")
+		}
+		if stored, _ := repo.GetRentalByID("rental-1"); stored.PaymentStatus != models.PaymentPending {
+			t.Errorf("Expected pending rental to be untouched, got %s", stored.PaymentStatus)
+		}
+	})
+
+	t.Run("Retries after a conflict", func(t *testing.T) {
+		repo := &conflictingRepo{InMemoryRepository: NewRepository(), conflicts: 2}
+		repo.CreateRental(&models.Rental{ID: "rental-1", PaymentStatus: models.PaymentPending})
+
+		calls := 0
+		rental, err := UpdateRentalWithRetry(repo, "rental-1", func(rental *models.Rental) error {
+			calls++
+			rental.PaymentStatus = models.PaymentCompleted
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("UpdateRentalWithRetry failed: %v", err)
+		}
+		if calls != 3 || rental.PaymentStatus != models.PaymentCompleted {
+			t.Errorf("Expected 3 attempts ending in completed, got %d attempts, %s", calls, rental.PaymentStatus)
+		}
+	})
+
+	t.Run("Gives up after repeated conflicts", func(t *testing.T) {
+		repo := &conflictingRepo{InMemoryRepository: NewRepository(), conflicts: maxRentalUpdateAttempts}
+		repo.CreateRental(&models.Rental{ID: "rental-1"})
+
+		_, err := UpdateRentalWithRetry(repo, "rental-1", func(*models.Rental) error { return nil })
+		if !errors.Is(err, ErrRentalVersionConflict) {
+			t.Errorf("Expected ErrRentalVersionConflict, got %v", err)
+		}
+	})
+}
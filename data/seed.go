@@ -62,51 +62,28 @@ func SeedData(repo Repository) {
 		repo.AddCollectible(c)
 	}
 
-	// Standard definition for 4 regional warehouses
+	// Standard definition for 4 regional warehouses; store distances are
+	// computed from coordinates at startup
 	regions := []struct {
 		IDSuffix  string
 		Name      string
-		Distances map[string]int
+		Latitude  float64
+		Longitude float64
 	}{
-		{
-			IDSuffix: "-north",
-			Name:     "Warehouse North (QC)",
-			Distances: map[string]int{
-				"store-a": 5,  // Manila
-				"store-b": 1,  // QC (Close)
-				"store-c": 10, // Makati (Far)
-			},
-		},
-		{
-			IDSuffix: "-south",
-			Name:     "Warehouse South (Alabang)",
-			Distances: map[string]int{
-				"store-a": 8,  // Manila
-				"store-b": 12, // QC (Far)
-				"store-c": 1,  // Makati (Close)
-			},
-		},
-		{
-			IDSuffix: "-east",
-			Name:     "Warehouse East (Pasig)",
-			Distances: map[string]int{
-				"store-a": 6, // Manila
-				"store-b": 4, // QC
-				"store-c": 3, // Makati (Med)
-			},
-		},
-		{
-			IDSuffix: "-west",
-			Name:     "Warehouse West (Port Area)",
-			Distances: map[string]int{
-				"store-a": 1, // Manila (Close)
-				"store-b": 6, // QC
-				"store-c": 6, // Makati
-			},
-		},
+		{IDSuffix: "-north", Name: "Warehouse North (QC)", Latitude: 14.7000, Longitude: 121.0300},
+		{IDSuffix: "-south", Name: "Warehouse South (Alabang)", Latitude: 14.4200, Longitude: 121.0400},
+		{IDSuffix: "-east", Name: "Warehouse East (Pasig)", Latitude: 14.5760, Longitude: 121.0850},
+		{IDSuffix: "-west", Name: "Warehouse West (Port Area)", Latitude: 14.5880, Longitude: 120.9670},
+	}
+
+	// Smaller pieces are stocked in more copies than bulky ones
+	copiesPerWarehouse := map[models.Size]int{
+		models.SizeSmall:  3,
+		models.SizeMedium: 2,
+		models.SizeLarge:  1,
 	}
 
-	// Loop through all collectibles and assign one unit in each warehouse
+	// Loop through all collectibles and stock copies in each warehouse
 	for _, c := range collectibles {
 		for _, r := range regions {
 			repo.AddWarehouse(c.ID, models.Warehouse{
@@ -114,7 +91,9 @@ func SeedData(repo Repository) {
 				Name:          r.Name,
 				CollectibleID: c.ID,
 				Available:     true,
-				Distances:     r.Distances,
+				Quantity:      copiesPerWarehouse[c.Size],
+				Latitude:      r.Latitude,
+				Longitude:     r.Longitude,
 			})
 		}
 	}
@@ -1,10 +1,23 @@
 package handlers
 
 import (
+	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/mongocollectibles/rental-system/config"
 	"github.com/mongocollectibles/rental-system/data"
+	"github.com/mongocollectibles/rental-system/models"
 	"github.com/mongocollectibles/rental-system/services"
 )
 
@@ -12,25 +25,99 @@ import (
 type AdminHandler struct {
 	repo              data.Repository
 	allocationManager *services.AllocationManager
+	config            *config.Config
 }
 
 // NewAdminHandler creates a new admin handler
-func NewAdminHandler(repo data.Repository, allocationManager *services.AllocationManager) *AdminHandler {
+func NewAdminHandler(repo data.Repository, allocationManager *services.AllocationManager, cfg *config.Config) *AdminHandler {
 	return &AdminHandler{
 		repo:              repo,
 		allocationManager: allocationManager,
+		config:            cfg,
 	}
 }
 
+// CollectibleStockStats is the available vs reserved unit count of one collectible
+type CollectibleStockStats struct {
+	Available int `json:"available"`
+	Reserved  int `json:"reserved"`
+}
+
+// DashboardStats holds the computed aggregates shown on the admin dashboard
+type DashboardStats struct {
+	TotalUnits             int                              `json:"total_units"`
+	Collectibles           map[string]CollectibleStockStats `json:"collectibles"`
+	RentalsByPaymentStatus map[models.PaymentStatus]int     `json:"rentals_by_payment_status"`
+	Revenue                float64                          `json:"revenue"` // Sum of TotalFee over completed payments
+}
+
+// buildDashboardStats aggregates unit counts from the allocation manager and rental totals
+func buildDashboardStats(am *services.AllocationManager, rentals []*models.Rental) DashboardStats {
+	stats := DashboardStats{
+		Collectibles:           make(map[string]CollectibleStockStats),
+		RentalsByPaymentStatus: make(map[models.PaymentStatus]int),
+	}
+
+	available := am.CountAvailable()
+	reserved := am.CountReserved()
+	for collectibleID, n := range available {
+		stats.Collectibles[collectibleID] = CollectibleStockStats{Available: n, Reserved: reserved[collectibleID]}
+		stats.TotalUnits += n + reserved[collectibleID]
+	}
+
+	for _, rental := range rentals {
+		stats.RentalsByPaymentStatus[rental.PaymentStatus]++
+		if rental.PaymentStatus == models.PaymentCompleted {
+			stats.Revenue += rental.TotalFee
+		}
+	}
+	return stats
+}
+
+// defaultDashboardWindow is how far back the dashboard looks when no from is given
+const defaultDashboardWindow = 30 * 24 * time.Hour
+
+// parseDateRange reads the optional RFC3339 from/to query params.
+// to defaults to now and from to defaultDashboardWindow before to.
+func parseDateRange(r *http.Request) (time.Time, time.Time, error) {
+	to := time.Now()
+	if v := r.URL.Query().Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid to: expected RFC3339, got %q", v)
+		}
+		to = t
+	}
+
+	from := to.Add(-defaultDashboardWindow)
+	if v := r.URL.Query().Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid from: expected RFC3339, got %q", v)
+		}
+		from = t
+	}
+
+	if from.After(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("from must not be after to")
+	}
+	return from, to, nil
+}
+
 // GetDashboardData aggregates all data for the dashboard
 func (h *AdminHandler) GetDashboardData(w http.ResponseWriter, r *http.Request) {
 	// 1. Get Inventory State
 	inventory := h.allocationManager.GetAllInventory()
 
-	// 2. Get Orders (Rentals)
-	rentals, err := h.repo.GetAllRentals()
+	// 2. Get Orders (Rentals) within the requested window
+	from, to, err := parseDateRange(r)
 	if err != nil {
-		http.Error(w, "Failed to fetch rentals", http.StatusInternalServerError)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	rentals, err := h.repo.GetRentalsByDateRange(from, to)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to fetch rentals")
 		return
 	}
 
@@ -46,8 +133,382 @@ func (h *AdminHandler) GetDashboardData(w http.ResponseWriter, r *http.Request)
 		"inventory":    inventory,
 		"rentals":      rentals,
 		"collectibles": collectibleNames,
+		"stats":        buildDashboardStats(h.allocationManager, rentals),
+		"from":         from,
+		"to":           to,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
+
+// ReleaseUnitRequest identifies a stuck reservation to release
+type ReleaseUnitRequest struct {
+	UnitID string `json:"unit_id"`
+	Force  bool   `json:"force"` // Also release a unit confirmed for a paid rental
+}
+
+// ReleaseUnit manually returns a reserved unit to inventory, e.g. after a checkout
+// crashed between allocation and rental creation. Units confirmed for a paid rental
+// are out with a customer, so releasing one requires force.
+func (h *AdminHandler) ReleaseUnit(w http.ResponseWriter, r *http.Request) {
+	var req ReleaseUnitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
+		return
+	}
+	if req.UnitID == "" {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "unit_id is required")
+		return
+	}
+
+	unit, ok := h.allocationManager.GetUnit(req.UnitID)
+	if !ok {
+		writeError(w, http.StatusNotFound, ErrCodeUnitNotFound, "Unit not found")
+		return
+	}
+	// A reserved unit without a hold timestamp has been confirmed for a paid rental
+	confirmed := !unit.IsAvailable && unit.ReservedAt == nil
+	if confirmed && !req.Force {
+		writeError(w, http.StatusConflict, ErrCodeUnitRented, "Unit is rented out to rental "+unit.RentalID+"; set force to release it anyway")
+		return
+	}
+	if err := h.allocationManager.ReleaseUnit(req.UnitID); err != nil {
+		writeError(w, http.StatusNotFound, ErrCodeUnitNotFound, "Unit is not reserved")
+		return
+	}
+	if confirmed {
+		log.Printf("[Admin] Warning: Force-released Unit %s confirmed for Rental %s", unit.UnitID, unit.RentalID)
+	}
+	log.Printf("[Admin] Manually released Unit %s (Collectible %s, Rental %s)", unit.UnitID, unit.CollectibleID, unit.RentalID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"data": map[string]interface{}{
+			"unit_id":        unit.UnitID,
+			"collectible_id": unit.CollectibleID,
+			"warehouse_id":   unit.WarehouseID,
+			"available":      h.allocationManager.GetTotalStock(unit.CollectibleID),
+		},
+	})
+}
+
+// CollectibleRequest is the admin payload for creating or updating a collectible
+type CollectibleRequest struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Size        models.Size `json:"size"`
+	ImageURL    string      `json:"image_url"`
+}
+
+// validateCollectibleRequest trims and normalizes req in place and reports the
+// first invalid field. Image URLs may be absolute http(s) or site-relative paths.
+func validateCollectibleRequest(req *CollectibleRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	req.Description = strings.TrimSpace(req.Description)
+	req.Size = models.Size(strings.ToUpper(strings.TrimSpace(string(req.Size))))
+	req.ImageURL = strings.TrimSpace(req.ImageURL)
+
+	if req.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	switch req.Size {
+	case models.SizeSmall, models.SizeMedium, models.SizeLarge:
+	default:
+		return fmt.Errorf("size must be one of S, M, L")
+	}
+	if req.ImageURL != "" {
+		u, err := url.Parse(req.ImageURL)
+		absolute := err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+		relative := err == nil && u.Scheme == "" && u.Host == "" && strings.HasPrefix(u.Path, "/")
+		if !absolute && !relative {
+			return fmt.Errorf("image_url must be an http(s) URL or a path starting with /")
+		}
+	}
+	return nil
+}
+
+// CreateCollectible adds a collectible to the catalog. It has no stock until
+// units are added for it.
+func (h *AdminHandler) CreateCollectible(w http.ResponseWriter, r *http.Request) {
+	var req CollectibleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
+		return
+	}
+	if err := validateCollectibleRequest(&req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	collectible := &models.Collectible{
+		ID:          "col-" + uuid.New().String(),
+		Name:        req.Name,
+		Description: req.Description,
+		Size:        req.Size,
+		ImageURL:    req.ImageURL,
+		Available:   true,
+		DailyRate:   req.Size.GetDailyRate(),
+	}
+	if err := h.repo.AddCollectible(collectible); err != nil {
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to create collectible")
+		return
+	}
+	log.Printf("[Admin] Created Collectible %s (%s)", collectible.ID, collectible.Name)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"data":    collectible,
+	})
+}
+
+// UpdateCollectible replaces a collectible's catalog details. Its ID and archived
+// flag are kept; rentals already placed keep the price they were quoted.
+func (h *AdminHandler) UpdateCollectible(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var req CollectibleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
+		return
+	}
+	if err := validateCollectibleRequest(&req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	existing, err := h.repo.GetCollectibleByID(id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, ErrCodeCollectibleNotFound, "Collectible not found")
+		return
+	}
+	updated := *existing
+	updated.Name = req.Name
+	updated.Description = req.Description
+	updated.Size = req.Size
+	updated.ImageURL = req.ImageURL
+	updated.DailyRate = req.Size.GetDailyRate()
+	if err := h.repo.UpdateCollectible(&updated); err != nil {
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to update collectible")
+		return
+	}
+	log.Printf("[Admin] Updated Collectible %s", id)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"data":    &updated,
+	})
+}
+
+// ArchiveCollectible retires a collectible from the catalog. Its rentals and
+// inventory are untouched, but it can no longer be quoted or checked out.
+func (h *AdminHandler) ArchiveCollectible(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	if _, err := h.repo.GetCollectibleByID(id); err != nil {
+		writeError(w, http.StatusNotFound, ErrCodeCollectibleNotFound, "Collectible not found")
+		return
+	}
+	if err := h.repo.ArchiveCollectible(id); err != nil {
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to archive collectible")
+		return
+	}
+	log.Printf("[Admin] Archived Collectible %s", id)
+
+	collectible, err := h.repo.GetCollectibleByID(id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to fetch collectible")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"data":    collectible,
+	})
+}
+
+// RegisterWarehouse stocks a collectible at a new warehouse. The warehouse's store
+// distances (computed from its coordinates, with any distances in the body as
+// overrides) must cover every configured store. Its units are persisted and can be
+// allocated straight away, without a restart.
+func (h *AdminHandler) RegisterWarehouse(w http.ResponseWriter, r *http.Request) {
+	collectibleID := mux.Vars(r)["id"]
+
+	var wh models.Warehouse
+	if err := json.NewDecoder(r.Body).Decode(&wh); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
+		return
+	}
+	wh.ID = strings.TrimSpace(wh.ID)
+	wh.Name = strings.TrimSpace(wh.Name)
+	if wh.ID == "" || wh.Name == "" {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "id and name are required")
+		return
+	}
+	if wh.Quantity < 0 {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "quantity must not be negative")
+		return
+	}
+	distances := services.BuildDistanceMapFromCoords(wh.Latitude, wh.Longitude, h.config.Stores, wh.Distances)
+	if err := services.ValidateDistanceMap(distances, h.config.Stores); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid distances: "+strings.ReplaceAll(err.Error(), "\n", "; "))
+		return
+	}
+
+	if _, err := h.repo.GetCollectibleByID(collectibleID); err != nil {
+		writeError(w, http.StatusNotFound, ErrCodeCollectibleNotFound, "Collectible not found")
+		return
+	}
+	if h.allocationManager.HasWarehouse(wh.ID) {
+		writeError(w, http.StatusConflict, ErrCodeWarehouseExists, "Warehouse already exists")
+		return
+	}
+
+	// New stock starts out available
+	wh.CollectibleID = collectibleID
+	wh.Available = true
+	units, nodes := services.BuildInventory(map[string][]models.Warehouse{collectibleID: {wh}}, h.config.Stores)
+
+	if err := h.repo.AddWarehouse(collectibleID, wh); err != nil {
+		if errors.Is(err, data.ErrWarehouseExists) {
+			writeError(w, http.StatusConflict, ErrCodeWarehouseExists, "Warehouse already exists")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to save warehouse")
+		return
+	}
+	// A concurrent registration may have claimed the warehouse or unit IDs in memory since the
+	// check above; drop the saved row so a restart doesn't load a warehouse reported as failed
+	if err := h.allocationManager.AddWarehouse(nodes[0], units); err != nil {
+		if err := h.repo.DeleteWarehouse(collectibleID, wh.ID); err != nil {
+			log.Printf("[Admin] Warning: Failed to remove Warehouse %s after a failed registration: %v", wh.ID, err)
+		}
+		writeError(w, http.StatusConflict, ErrCodeWarehouseExists, "Warehouse already exists")
+		return
+	}
+	for _, unit := range units {
+		if err := h.repo.SaveUnit(unit); err != nil {
+			log.Printf("[Admin] Warning: Failed to persist Unit %s: %v", unit.ID, err)
+		}
+	}
+	log.Printf("[Admin] Registered Warehouse %s for Collectible %s with %d unit(s)", wh.ID, collectibleID, len(units))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"data": map[string]interface{}{
+			"warehouse": wh,
+			"distances": nodes[0].Distances,
+			"units":     len(units),
+			"available": h.allocationManager.GetTotalStock(collectibleID),
+		},
+	})
+}
+
+// GetReservations lists currently reserved units with their rental IDs and reserved-at times
+func (h *AdminHandler) GetReservations(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"data":    h.allocationManager.GetReservedUnits(),
+	})
+}
+
+// rentalCSVHeader is the column order of the rentals CSV export
+var rentalCSVHeader = []string{
+	"id", "collectible", "customer_email", "store_id", "warehouse_id",
+	"duration", "total_fee", "payment_status", "created_at",
+}
+
+// ExportRentalsCSV streams all rentals, oldest first, as a CSV download.
+// An optional ?status= limits the export to one payment status.
+func (h *AdminHandler) ExportRentalsCSV(w http.ResponseWriter, r *http.Request) {
+	status := models.PaymentStatus(r.URL.Query().Get("status"))
+	switch status {
+	case "", models.PaymentPending, models.PaymentCompleted, models.PaymentFailed, models.PaymentRefunded:
+	default:
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Unknown payment status: "+string(status))
+		return
+	}
+
+	rentals, err := h.repo.GetAllRentals()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to fetch rentals")
+		return
+	}
+	sort.Slice(rentals, func(i, j int) bool {
+		return rentals[i].CreatedAt.Before(rentals[j].CreatedAt)
+	})
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="rentals.csv"`)
+
+	cw := csv.NewWriter(w)
+	cw.Write(rentalCSVHeader)
+	for _, rental := range rentals {
+		if status != "" && rental.PaymentStatus != status {
+			continue
+		}
+
+		email := rental.CustomerEmail
+		if email == "" {
+			email = rental.Customer.Email
+		}
+		cw.Write([]string{
+			rental.ID,
+			rental.CollectibleName,
+			email,
+			rental.StoreID,
+			rental.WarehouseID,
+			strconv.Itoa(rental.Duration),
+			strconv.FormatFloat(rental.TotalFee, 'f', 2, 64),
+			string(rental.PaymentStatus),
+			rental.CreatedAt.Format(time.RFC3339),
+		})
+		// Flush each row so large exports stream instead of buffering
+		cw.Flush()
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		log.Printf("[Admin] CSV export interrupted: %v", err)
+	}
+}
+
+// Webhook event listing limits for GetWebhookEvents
+const (
+	defaultWebhookEventLimit = 50
+	maxWebhookEventLimit     = 500
+)
+
+// GetWebhookEvents lists the most recent PayMongo webhook events, newest first.
+// An optional ?limit= caps the count (default 50, max 500).
+func (h *AdminHandler) GetWebhookEvents(w http.ResponseWriter, r *http.Request) {
+	limit := defaultWebhookEventLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "limit must be a positive integer")
+			return
+		}
+		limit = min(n, maxWebhookEventLimit)
+	}
+
+	events, err := h.repo.GetRecentWebhookEvents(limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to fetch webhook events")
+		return
+	}
+	if events == nil {
+		events = []*models.WebhookEvent{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"data":    events,
+	})
+}
@@ -0,0 +1,549 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mongocollectibles/rental-system/data"
+	"github.com/mongocollectibles/rental-system/models"
+	"github.com/mongocollectibles/rental-system/services"
+)
+
+// newTestAdminHandler builds an admin handler over the same fixtures as newTestRentalsHandler
+func newTestAdminHandler(t *testing.T) (*AdminHandler, data.Repository, *services.AllocationManager) {
+	t.Helper()
+
+	rentals, repo, am := newTestRentalsHandler(t)
+	return NewAdminHandler(repo, am, rentals.config), repo, am
+}
+
+func TestAdminReleaseUnit(t *testing.T) {
+	h, _, am := newTestAdminHandler(t)
+
+	release := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/inventory/release", bytes.NewBufferString(body))
+		rec := httptest.NewRecorder()
+		h.ReleaseUnit(rec, req)
+		return rec
+	}
+
+	t.Run("Releases a reserved unit", func(t *testing.T) {
+		unit, _, err := am.Allocate("col-001", "store-a", "rental-1")
+		if err != nil {
+			t.Fatalf("Allocate failed: %v", err)
+		}
+
+		rec := release(`{"unit_id":"` + unit.ID + `"}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		var data struct {
+			Available int `json:"available"`
+		}
+		decodeData(t, rec, &data)
+		if data.Available != 2 {
+			t.Errorf("Expected 2 available after release, got %d", data.Available)
+		}
+	})
+
+	t.Run("Unit of a paid rental needs force", func(t *testing.T) {
+		unit, _, err := am.Allocate("col-001", "store-a", "rental-paid")
+		if err != nil {
+			t.Fatalf("Allocate failed: %v", err)
+		}
+		if _, _, err := am.ConfirmAllocation("rental-paid", "col-001", "store-a"); err != nil {
+			t.Fatalf("ConfirmAllocation failed: %v", err)
+		}
+
+		rec := release(`{"unit_id":"` + unit.ID + `"}`)
+		if rec.Code != http.StatusConflict {
+			t.Fatalf("Expected 409, got %d", rec.Code)
+		}
+		assertErrorCode(t, rec, ErrCodeUnitRented)
+		if unit.IsAvailable {
+			t.Fatal("Expected the rented unit to stay out")
+		}
+
+		if rec := release(`{"unit_id":"` + unit.ID + `","force":true}`); rec.Code != http.StatusOK {
+			t.Fatalf("Expected forced release to succeed, got %d", rec.Code)
+		}
+		if !unit.IsAvailable {
+			t.Error("Expected the unit back in stock after a forced release")
+		}
+	})
+
+	t.Run("Unit that is not reserved returns 404", func(t *testing.T) {
+		rec := release(`{"unit_id":"wh-1"}`)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("Expected 404, got %d", rec.Code)
+		}
+		assertErrorCode(t, rec, ErrCodeUnitNotFound)
+	})
+
+	t.Run("Unknown unit returns 404", func(t *testing.T) {
+		rec := release(`{"unit_id":"missing"}`)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("Expected 404, got %d", rec.Code)
+		}
+		assertErrorCode(t, rec, ErrCodeUnitNotFound)
+	})
+
+	t.Run("Missing fields are rejected", func(t *testing.T) {
+		rec := release(`{"collectible_id":"col-001"}`)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400, got %d", rec.Code)
+		}
+		assertErrorCode(t, rec, ErrCodeInvalidRequest)
+	})
+}
+
+func TestAdminCreateCollectible(t *testing.T) {
+	h, repo, _ := newTestAdminHandler(t)
+
+	create := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/collectibles", bytes.NewBufferString(body))
+		rec := httptest.NewRecorder()
+		h.CreateCollectible(rec, req)
+		return rec
+	}
+
+	t.Run("Creates a collectible", func(t *testing.T) {
+		rec := create(`{"name":"  Gundam Model  ","description":"1/60 kit","size":"m","image_url":"/images/gundam.jpg"}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var c models.Collectible
+		decodeData(t, rec, &c)
+		if !strings.HasPrefix(c.ID, "col-") || c.Name != "Gundam Model" || c.Size != models.SizeMedium || c.DailyRate != 5000 {
+			t.Errorf("Unexpected collectible: %+v", c)
+		}
+		if stored, err := repo.GetCollectibleByID(c.ID); err != nil || stored.Name != "Gundam Model" {
+			t.Errorf("Expected collectible to be stored, got %+v (err %v)", stored, err)
+		}
+	})
+
+	t.Run("Absolute image URL is accepted", func(t *testing.T) {
+		if rec := create(`{"name":"Card Set","size":"S","image_url":"https://cdn.example.com/cards.jpg"}`); rec.Code != http.StatusOK {
+			t.Errorf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"Missing name", `{"name":"  ","size":"S"}`},
+		{"Missing size", `{"name":"Card Set"}`},
+		{"Unknown size", `{"name":"Card Set","size":"XL"}`},
+		{"Size spelled out", `{"name":"Card Set","size":"small"}`},
+		{"Non-string size", `{"name":"Card Set","size":1}`},
+		{"Relative image path", `{"name":"Card Set","size":"S","image_url":"images/cards.jpg"}`},
+		{"Non-http image URL", `{"name":"Card Set","size":"S","image_url":"javascript:alert(1)"}`},
+		{"Image URL without host", `{"name":"Card Set","size":"S","image_url":"https:///cards.jpg"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+" is rejected", func(t *testing.T) {
+			rec := create(tt.body)
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("Expected 400, got %d", rec.Code)
+			}
+			assertErrorCode(t, rec, ErrCodeInvalidRequest)
+		})
+	}
+}
+
+func TestAdminUpdateCollectible(t *testing.T) {
+	h, repo, _ := newTestAdminHandler(t)
+	repo.ArchiveCollectible("col-001")
+
+	update := func(id, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/admin/collectibles/"+id, bytes.NewBufferString(body))
+		req = mux.SetURLVars(req, map[string]string{"id": id})
+		rec := httptest.NewRecorder()
+		h.UpdateCollectible(rec, req)
+		return rec
+	}
+
+	rec := update("col-001", `{"name":"Batman Figure","description":"Mint","size":"L","image_url":"/images/batman.jpg"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var c models.Collectible
+	decodeData(t, rec, &c)
+	if c.ID != "col-001" || c.Name != "Batman Figure" || c.Size != models.SizeLarge || c.DailyRate != 10000 {
+		t.Errorf("Unexpected collectible: %+v", c)
+	}
+	if !c.Archived {
+		t.Error("Expected update to keep the archived flag")
+	}
+	if stored, _ := repo.GetCollectibleByID("col-001"); stored.Name != "Batman Figure" {
+		t.Errorf("Expected update to be stored, got %+v", stored)
+	}
+
+	t.Run("Bad size is rejected", func(t *testing.T) {
+		rec := update("col-001", `{"name":"Batman Figure","size":"XXL"}`)
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("Expected 400, got %d", rec.Code)
+		}
+		assertErrorCode(t, rec, ErrCodeInvalidRequest)
+		if stored, _ := repo.GetCollectibleByID("col-001"); stored.Size != models.SizeLarge {
+			t.Errorf("Rejected update should not change the size, got %s", stored.Size)
+		}
+	})
+
+	t.Run("Unknown collectible returns 404", func(t *testing.T) {
+		rec := update("col-missing", `{"name":"Batman Figure","size":"S"}`)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("Expected 404, got %d", rec.Code)
+		}
+		assertErrorCode(t, rec, ErrCodeCollectibleNotFound)
+	})
+}
+
+func TestAdminRegisterWarehouse(t *testing.T) {
+	h, repo, am := newTestAdminHandler(t)
+	h.config.Stores = append(h.config.Stores, models.Store{ID: "store-c", Name: "Store C"})
+
+	register := func(id, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/collectibles/"+id+"/warehouses", bytes.NewBufferString(body))
+		req = mux.SetURLVars(req, map[string]string{"id": id})
+		rec := httptest.NewRecorder()
+		h.RegisterWarehouse(rec, req)
+		return rec
+	}
+
+	rec := register("col-001", `{"id":"wh-3","name":"Warehouse C","quantity":2,"distances":{"store-a":1,"store-b":4,"store-c":2}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var data struct {
+		Units     int `json:"units"`
+		Available int `json:"available"`
+	}
+	decodeData(t, rec, &data)
+	if data.Units != 2 || data.Available != 4 {
+		t.Errorf("Expected 2 new units and 4 available, got %+v", data)
+	}
+
+	// Usable without a restart: wh-3 is now the nearest warehouse to store-a
+	if unit, dist, err := am.Allocate("col-001", "store-a", "rental-1"); err != nil || unit.WarehouseID != "wh-3" || dist != 1 {
+		t.Errorf("Expected a unit from wh-3 at distance 1, got %+v, %d (err %v)", unit, dist, err)
+	}
+	if warehouses, _ := repo.GetWarehouses("col-001"); len(warehouses) != 1 || warehouses[0].ID != "wh-3" || !warehouses[0].Available {
+		t.Errorf("Expected wh-3 persisted as available, got %+v", warehouses)
+	}
+	if units, _ := repo.GetAllUnits(); len(units) != 2 {
+		t.Errorf("Expected 2 persisted units, got %+v", units)
+	}
+
+	tests := []struct {
+		name string
+		id   string
+		body string
+		code int
+	}{
+		{"Missing store", "col-001", `{"id":"wh-4","name":"Warehouse D","distances":{"store-a":1,"store-b":4}}`, http.StatusBadRequest},
+		{"Negative distance", "col-001", `{"id":"wh-4","name":"Warehouse D","distances":{"store-a":1,"store-b":-4,"store-c":2}}`, http.StatusBadRequest},
+		{"Unknown store", "col-001", `{"id":"wh-4","name":"Warehouse D","distances":{"store-a":1,"store-b":4,"store-c":2,"store-z":9}}`, http.StatusBadRequest},
+		{"Missing ID", "col-001", `{"name":"Warehouse D","distances":{"store-a":1,"store-b":4,"store-c":2}}`, http.StatusBadRequest},
+		{"Unknown collectible", "col-missing", `{"id":"wh-4","name":"Warehouse D","distances":{"store-a":1,"store-b":4,"store-c":2}}`, http.StatusNotFound},
+		{"Existing warehouse", "col-001", `{"id":"wh-1","name":"Warehouse A","distances":{"store-a":1,"store-b":4,"store-c":2}}`, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+" is rejected", func(t *testing.T) {
+			if rec := register(tt.id, tt.body); rec.Code != tt.code {
+				t.Errorf("Expected %d, got %d: %s", tt.code, rec.Code, rec.Body.String())
+			}
+			if am.HasWarehouse("wh-4") {
+				t.Error("Rejected warehouse should not be added")
+			}
+		})
+	}
+
+	t.Run("Taken unit ID leaves nothing persisted", func(t *testing.T) {
+		// Warehouse "wh" stocks units "wh" and "wh-2"; a unit "wh-2" already exists
+		rec := register("col-001", `{"id":"wh","name":"Warehouse W","quantity":2,"distances":{"store-a":1,"store-b":4,"store-c":2}}`)
+		if rec.Code != http.StatusConflict {
+			t.Fatalf("Expected 409, got %d: %s", rec.Code, rec.Body.String())
+		}
+		assertErrorCode(t, rec, ErrCodeWarehouseExists)
+		if am.HasWarehouse("wh") {
+			t.Error("Rejected warehouse should not be added")
+		}
+		if warehouses, _ := repo.GetWarehouses("col-001"); len(warehouses) != 1 || warehouses[0].ID != "wh-3" {
+			t.Errorf("Expected only wh-3 to stay persisted, got %+v", warehouses)
+		}
+		if units, _ := repo.GetAllUnits(); len(units) != 2 {
+			t.Errorf("Expected no units persisted for the rejected warehouse, got %+v", units)
+		}
+	})
+}
+
+func TestAdminArchiveCollectible(t *testing.T) {
+	rentals, repo, am := newTestRentalsHandler(t)
+	h := NewAdminHandler(repo, am, rentals.config)
+
+	archive := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/collectibles/"+id+"/archive", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": id})
+		rec := httptest.NewRecorder()
+		h.ArchiveCollectible(rec, req)
+		return rec
+	}
+
+	rec := archive("col-001")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var c models.Collectible
+	decodeData(t, rec, &c)
+	if c.ID != "col-001" || !c.Archived {
+		t.Errorf("Expected col-001 archived, got %+v", c)
+	}
+
+	t.Run("Archived collectible can no longer be checked out", func(t *testing.T) {
+		body, _ := json.Marshal(models.CheckoutRequest{CollectibleID: "col-001", StoreID: "store-a", Duration: 7})
+		req := httptest.NewRequest(http.MethodPost, "/api/rentals/checkout", bytes.NewReader(body))
+		rec := httptest.NewRecorder()
+		rentals.Checkout(rec, req)
+		if rec.Code != http.StatusConflict {
+			t.Fatalf("Expected 409, got %d", rec.Code)
+		}
+		assertErrorCode(t, rec, ErrCodeCollectibleArchived)
+		if am.GetTotalStock("col-001") != 2 {
+			t.Error("Expected no unit to be allocated for an archived collectible")
+		}
+	})
+
+	t.Run("Unknown collectible returns 404", func(t *testing.T) {
+		rec := archive("col-missing")
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("Expected 404, got %d", rec.Code)
+		}
+		assertErrorCode(t, rec, ErrCodeCollectibleNotFound)
+	})
+}
+
+func TestAdminGetReservations(t *testing.T) {
+	h, _, am := newTestAdminHandler(t)
+
+	if _, _, err := am.Allocate("col-001", "store-b", "rental-1"); err != nil {
+		t.Fatalf("Allocate failed: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	h.GetReservations(rec, httptest.NewRequest(http.MethodGet, "/admin/reservations", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+
+	var reserved []services.InventorySnapshot
+	decodeData(t, rec, &reserved)
+	if len(reserved) != 1 {
+		t.Fatalf("Expected 1 reservation, got %+v", reserved)
+	}
+	if reserved[0].WarehouseID != "wh-2" || reserved[0].RentalID != "rental-1" {
+		t.Errorf("Unexpected reservation: %+v", reserved[0])
+	}
+}
+
+func TestBuildDashboardStats(t *testing.T) {
+	_, _, am := newTestRentalsHandler(t)
+	if _, _, err := am.Allocate("col-001", "store-a", "rental-1"); err != nil {
+		t.Fatalf("Allocate failed: %v", err)
+	}
+
+	rentals := []*models.Rental{
+		{ID: "r1", PaymentStatus: models.PaymentCompleted, TotalFee: 7000},
+		{ID: "r2", PaymentStatus: models.PaymentCompleted, TotalFee: 3000},
+		{ID: "r3", PaymentStatus: models.PaymentPending, TotalFee: 5000},
+		{ID: "r4", PaymentStatus: models.PaymentRefunded, TotalFee: 9000},
+	}
+
+	stats := buildDashboardStats(am, rentals)
+
+	if stats.TotalUnits != 2 {
+		t.Errorf("Expected 2 total units, got %d", stats.TotalUnits)
+	}
+	if got := stats.Collectibles["col-001"]; got.Available != 1 || got.Reserved != 1 {
+		t.Errorf("Expected 1 available / 1 reserved, got %+v", got)
+	}
+	if stats.RentalsByPaymentStatus[models.PaymentCompleted] != 2 || stats.RentalsByPaymentStatus[models.PaymentPending] != 1 {
+		t.Errorf("Unexpected payment status counts: %v", stats.RentalsByPaymentStatus)
+	}
+	if stats.Revenue != 10000 {
+		t.Errorf("Expected revenue 10000 from completed rentals only, got %v", stats.Revenue)
+	}
+}
+
+func TestAdminExportRentalsCSV(t *testing.T) {
+	h, repo, _ := newTestAdminHandler(t)
+
+	created := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	repo.CreateRental(&models.Rental{
+		ID: "r2", CollectibleName: "Vintage Batman Action Figure", StoreID: "store-a", WarehouseID: "wh-1",
+		Customer: models.Customer{Email: "b@example.com"}, Duration: 7, TotalFee: 7000,
+		PaymentStatus: models.PaymentPending, CreatedAt: created.Add(time.Hour),
+	})
+	repo.CreateRental(&models.Rental{
+		ID: "r1", CollectibleName: "Vintage Batman, Deluxe", StoreID: "store-b", WarehouseID: "wh-2",
+		Customer: models.Customer{Email: "a@example.com"}, Duration: 3, TotalFee: 6000,
+		PaymentStatus: models.PaymentCompleted, CreatedAt: created,
+	})
+
+	export := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ExportRentalsCSV(rec, httptest.NewRequest(http.MethodGet, "/admin/rentals/export.csv"+query, nil))
+		return rec
+	}
+
+	t.Run("Exports all rentals oldest first", func(t *testing.T) {
+		rec := export("")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", rec.Code)
+		}
+		if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+			t.Errorf("Expected text/csv content type, got %q", ct)
+		}
+		if cd := rec.Header().Get("Content-Disposition"); !strings.Contains(cd, "rentals.csv") {
+			t.Errorf("Expected attachment filename, got %q", cd)
+		}
+
+		rows, err := csv.NewReader(rec.Body).ReadAll()
+		if err != nil {
+			t.Fatalf("Invalid CSV: %v", err)
+		}
+		if len(rows) != 3 {
+			t.Fatalf("Expected header + 2 rows, got %d", len(rows))
+		}
+		want := []string{"r1", "Vintage Batman, Deluxe", "a@example.com", "store-b", "wh-2", "3", "6000.00", "completed", "2025-01-02T03:04:05Z"}
+		for i := range want {
+			if rows[1][i] != want[i] {
+				t.Errorf("Column %s: expected %q, got %q", rows[0][i], want[i], rows[1][i])
+			}
+		}
+		if rows[2][0] != "r2" {
+			t.Errorf("Expected r2 second, got %s", rows[2][0])
+		}
+	})
+
+	t.Run("Filters by payment status", func(t *testing.T) {
+		rows, err := csv.NewReader(export("?status=pending").Body).ReadAll()
+		if err != nil {
+			t.Fatalf("Invalid CSV: %v", err)
+		}
+		if len(rows) != 2 || rows[1][0] != "r2" {
+			t.Errorf("Expected only r2, got %v", rows)
+		}
+	})
+
+	t.Run("Unknown status is rejected", func(t *testing.T) {
+		rec := export("?status=bogus")
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400, got %d", rec.Code)
+		}
+		assertErrorCode(t, rec, ErrCodeInvalidRequest)
+	})
+}
+
+func TestAdminGetDashboardData_DateRange(t *testing.T) {
+	h, repo, _ := newTestAdminHandler(t)
+
+	now := time.Now()
+	repo.CreateRental(&models.Rental{ID: "recent", CreatedAt: now.Add(-24 * time.Hour)})
+	repo.CreateRental(&models.Rental{ID: "stale", CreatedAt: now.Add(-60 * 24 * time.Hour)})
+
+	dashboard := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.GetDashboardData(rec, httptest.NewRequest(http.MethodGet, "/admin/dashboard/api"+query, nil))
+		return rec
+	}
+	rentalIDs := func(rec *httptest.ResponseRecorder) []string {
+		var body struct {
+			Rentals []models.Rental `json:"rentals"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatalf("Failed to decode dashboard: %v", err)
+		}
+		var ids []string
+		for _, r := range body.Rentals {
+			ids = append(ids, r.ID)
+		}
+		return ids
+	}
+
+	t.Run("Defaults to the last 30 days", func(t *testing.T) {
+		rec := dashboard("")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", rec.Code)
+		}
+		if ids := rentalIDs(rec); len(ids) != 1 || ids[0] != "recent" {
+			t.Errorf("Expected only the recent rental, got %v", ids)
+		}
+	})
+
+	t.Run("Explicit range includes older rentals", func(t *testing.T) {
+		from := now.Add(-90 * 24 * time.Hour).UTC().Format(time.RFC3339)
+		rec := dashboard("?from=" + from)
+		if ids := rentalIDs(rec); len(ids) != 2 {
+			t.Errorf("Expected both rentals, got %v", ids)
+		}
+	})
+
+	t.Run("from after to is rejected", func(t *testing.T) {
+		rec := dashboard("?from=2025-02-01T00:00:00Z&to=2025-01-01T00:00:00Z")
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400, got %d", rec.Code)
+		}
+		assertErrorCode(t, rec, ErrCodeInvalidRequest)
+	})
+
+	t.Run("Malformed timestamp is rejected", func(t *testing.T) {
+		rec := dashboard("?to=yesterday")
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400, got %d", rec.Code)
+		}
+	})
+}
+
+func TestAdminGetWebhookEvents(t *testing.T) {
+	h, repo, _ := newTestAdminHandler(t)
+
+	now := time.Now()
+	repo.SaveWebhookEvent(&models.WebhookEvent{ID: "evt_old", ReceivedAt: now.Add(-time.Minute)})
+	repo.SaveWebhookEvent(&models.WebhookEvent{ID: "evt_new", ReceivedAt: now})
+
+	list := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.GetWebhookEvents(rec, httptest.NewRequest(http.MethodGet, "/admin/webhooks"+query, nil))
+		return rec
+	}
+
+	t.Run("Lists newest first up to limit", func(t *testing.T) {
+		rec := list("?limit=1")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", rec.Code)
+		}
+		var events []models.WebhookEvent
+		decodeData(t, rec, &events)
+		if len(events) != 1 || events[0].ID != "evt_new" {
+			t.Errorf("Expected [evt_new], got %+v", events)
+		}
+	})
+
+	t.Run("Invalid limit is rejected", func(t *testing.T) {
+		rec := list("?limit=0")
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400, got %d", rec.Code)
+		}
+		assertErrorCode(t, rec, ErrCodeInvalidRequest)
+	})
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/mongocollectibles/rental-system/config"
+)
+
+// RequireAdmin returns middleware that only lets requests carrying
+// "Authorization: Bearer <ADMIN_TOKEN>" through. A missing token is rejected
+// with 401 and a wrong one with 403. If no admin token is configured the
+// routes stay open in development and are closed everywhere else.
+func RequireAdmin(cfg *config.Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !authorizeAdmin(w, cfg, r) {
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// authorizeAdmin applies the RequireAdmin rules to a single request, writing the
+// 401/403 response and returning false when the caller is not an admin
+func authorizeAdmin(w http.ResponseWriter, cfg *config.Config, r *http.Request) bool {
+	if cfg.AdminToken == "" {
+		if cfg.IsDevelopment() {
+			return true
+		}
+		writeError(w, http.StatusForbidden, ErrCodeForbidden, "Admin access is not configured")
+		return false
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		writeError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "Admin token required")
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(cfg.AdminToken)) != 1 {
+		writeError(w, http.StatusForbidden, ErrCodeForbidden, "Not an admin token")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mongocollectibles/rental-system/config"
+)
+
+func TestRequireAdmin(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	serve := func(cfg *config.Config, authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/admin/dashboard/api", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		RequireAdmin(cfg)(ok).ServeHTTP(rec, req)
+		return rec
+	}
+
+	cfg := &config.Config{Environment: "production", AdminToken: "s3cret"}
+
+	t.Run("Admin token is accepted", func(t *testing.T) {
+		if rec := serve(cfg, "Bearer s3cret"); rec.Code != http.StatusOK {
+			t.Errorf("Expected 200, got %d", rec.Code)
+		}
+	})
+
+	t.Run("Non-admin token is rejected", func(t *testing.T) {
+		rec := serve(cfg, "Bearer customer-token")
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("Expected 403, got %d", rec.Code)
+		}
+		assertErrorCode(t, rec, ErrCodeForbidden)
+	})
+
+	t.Run("Missing token is rejected", func(t *testing.T) {
+		rec := serve(cfg, "")
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected 401, got %d", rec.Code)
+		}
+		assertErrorCode(t, rec, ErrCodeUnauthorized)
+	})
+
+	t.Run("Unconfigured token is open only in development", func(t *testing.T) {
+		if rec := serve(&config.Config{Environment: "development"}, ""); rec.Code != http.StatusOK {
+			t.Errorf("Expected 200 in development, got %d", rec.Code)
+		}
+		if rec := serve(&config.Config{Environment: "production"}, "Bearer anything"); rec.Code != http.StatusForbidden {
+			t.Errorf("Expected 403 in production, got %d", rec.Code)
+		}
+	})
+}
@@ -1,11 +1,19 @@
 package handlers
 
 import (
+	"cmp"
 	"encoding/json"
+	"log"
 	"net/http"
+	"net/mail"
 	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	"github.com/mongocollectibles/rental-system/config"
 	"github.com/mongocollectibles/rental-system/data"
 	"github.com/mongocollectibles/rental-system/models"
 	"github.com/mongocollectibles/rental-system/services"
@@ -15,68 +23,283 @@ import (
 type CollectiblesHandler struct {
 	repo              data.Repository
 	allocationManager *services.AllocationManager
+	config            *config.Config
 }
 
 // NewCollectiblesHandler creates a new collectibles handler
-func NewCollectiblesHandler(repo data.Repository, allocationManager *services.AllocationManager) *CollectiblesHandler {
+func NewCollectiblesHandler(repo data.Repository, allocationManager *services.AllocationManager, cfg *config.Config) *CollectiblesHandler {
 	return &CollectiblesHandler{
 		repo:              repo,
 		allocationManager: allocationManager,
+		config:            cfg,
 	}
 }
 
-// GetAllCollectibles returns all available collectibles
-func (h *CollectiblesHandler) GetAllCollectibles(w http.ResponseWriter, r *http.Request) {
-	collectibles, err := h.repo.GetAllCollectibles()
+// JoinWaitlist adds a customer to a collectible's waitlist so they are emailed when a
+// unit is released. Joining again while still waiting returns the existing entry.
+func (h *CollectiblesHandler) JoinWaitlist(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var req models.WaitlistRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
+		return
+	}
+	addr, err := mail.ParseAddress(strings.TrimSpace(req.Email))
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Failed to fetch collectibles",
-		})
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "A valid email is required")
+		return
+	}
+	if !validateStore(w, h.config, req.StoreID) {
 		return
 	}
 
-	// Ensure empty slice instead of nil for JSON
-	if collectibles == nil {
-		collectibles = []*models.Collectible{}
+	collectible, err := h.repo.GetCollectibleByID(id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, ErrCodeCollectibleNotFound, "Collectible not found")
+		return
+	}
+	if collectible.Archived {
+		writeError(w, http.StatusConflict, ErrCodeCollectibleArchived, "Collectible is no longer available for rent")
+		return
 	}
 
-	// Sort collectibles by Name to ensure consistent order
-	sort.Slice(collectibles, func(i, j int) bool {
-		return collectibles[i].Name < collectibles[j].Name
+	entries, err := h.repo.GetWaitlistByCollectible(id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to fetch waitlist")
+		return
+	}
+	entry := findPendingWaitlistEntry(entries, addr.Address)
+	if entry == nil {
+		entry = &models.WaitlistEntry{
+			ID:              uuid.New().String(),
+			CollectibleID:   id,
+			CollectibleName: collectible.Name,
+			StoreID:         req.StoreID,
+			Name:            strings.TrimSpace(req.Name),
+			Email:           addr.Address,
+			CreatedAt:       time.Now(),
+		}
+		if err := h.repo.AddWaitlistEntry(entry); err != nil {
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to join waitlist")
+			return
+		}
+		log.Printf("[Waitlist] %s joined the waitlist for %s", entry.Email, id)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"data":    entry,
 	})
+}
+
+// findPendingWaitlistEntry returns the entry for email that hasn't been notified yet, if any
+func findPendingWaitlistEntry(entries []*models.WaitlistEntry, email string) *models.WaitlistEntry {
+	for _, entry := range entries {
+		if entry.NotifiedAt == nil && strings.EqualFold(entry.Email, email) {
+			return entry
+		}
+	}
+	return nil
+}
+
+// Catalog sort keys accepted by GetAllCollectibles
+const (
+	sortByName  = "name"
+	sortByPrice = "price"
+	sortByETA   = "eta"
+	sortByStock = "stock"
+)
+
+// Catalog page sizes for GetAllCollectibles
+const (
+	defaultCatalogPageSize = 20
+	maxCatalogPageSize     = 100
+)
+
+// GetAllCollectibles returns the catalog, optionally filtered by ?q= (name or
+// description, case-insensitive), ?size=S|M|L and ?in_stock=true, and ordered by
+// ?sort=name|price|eta|stock with ?order=asc|desc (default name ascending).
+// Results are paged with ?page= (from 1) and ?page_size= (default 20, max 100).
+// Archived collectibles are hidden unless an admin asks for ?include_archived=true.
+func (h *CollectiblesHandler) GetAllCollectibles(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
 
 	// Get store_id from query params, default to "store-a"
-	targetStore := r.URL.Query().Get("store_id")
+	targetStore := query.Get("store_id")
 	if targetStore == "" {
 		targetStore = "store-a"
 	}
+	if !validateStore(w, h.config, targetStore) {
+		return
+	}
+
+	search := strings.ToLower(strings.TrimSpace(query.Get("q")))
+	size := models.Size(strings.ToUpper(query.Get("size")))
+	if size != "" && size != models.SizeSmall && size != models.SizeMedium && size != models.SizeLarge {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "size must be one of S, M, L")
+		return
+	}
+	inStockOnly := false
+	if raw := query.Get("in_stock"); raw != "" {
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "in_stock must be true or false")
+			return
+		}
+		inStockOnly = parsed
+	}
+	includeArchived := false
+	if raw := query.Get("include_archived"); raw != "" {
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "include_archived must be true or false")
+			return
+		}
+		if parsed && !authorizeAdmin(w, h.config, r) {
+			return
+		}
+		includeArchived = parsed
+	}
+
+	sortKey := strings.ToLower(query.Get("sort"))
+	switch sortKey {
+	case "":
+		sortKey = sortByName
+	case sortByName, sortByPrice, sortByETA, sortByStock:
+	default:
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "sort must be one of name, price, eta, stock")
+		return
+	}
+	descending := false
+	switch strings.ToLower(query.Get("order")) {
+	case "", "asc":
+	case "desc":
+		descending = true
+	default:
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "order must be asc or desc")
+		return
+	}
+	page := 1
+	if v := query.Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "page must be a positive integer")
+			return
+		}
+		page = n
+	}
+	pageSize := defaultCatalogPageSize
+	if v := query.Get("page_size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "page_size must be a positive integer")
+			return
+		}
+		pageSize = min(n, maxCatalogPageSize)
+	}
+
+	collectibles, err := h.repo.GetAllCollectibles()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to fetch collectibles")
+		return
+	}
 
+	// Text and size filters don't need inventory, so apply them before computing stock
+	results := []*models.Collectible{}
 	for _, c := range collectibles {
-		c.Stock = h.allocationManager.GetTotalStock(c.ID)
-
-		// Calculate ETA logic based on target store
-		// If stock is available locally (distance 0 or handled by logic), ETA is 0 or 1
-		eta, err := h.allocationManager.GetETA(c.ID, targetStore)
-		if err == nil {
-			c.ETADays = eta
-		} else {
-			c.ETADays = 0 // No units available
+		if c.Archived && !includeArchived {
+			continue
 		}
+		if matchesCollectibleFilter(c, search, size) {
+			// Set daily rate based on size
+			c.DailyRate = c.Size.GetDailyRate()
+			results = append(results, c)
+		}
+	}
 
-		// Set daily rate based on size
-		c.DailyRate = c.Size.GetDailyRate()
+	// Stock and ETA are only computed for the requested page, unless filtering or
+	// sorting on them needs every match
+	needsInventory := inStockOnly || sortKey == sortByETA || sortKey == sortByStock
+	if needsInventory {
+		// One pass over the whole inventory instead of two lookups per collectible
+		stock := h.allocationManager.GetStockAndETAForAll(targetStore)
+		inStock := results[:0]
+		for _, c := range results {
+			c.Stock, c.ETADays = stock[c.ID].Stock, stock[c.ID].ETA
+			if !inStockOnly || c.Stock > 0 {
+				inStock = append(inStock, c)
+			}
+		}
+		results = inStock
+	}
+
+	sortCollectibles(results, sortKey, descending)
+
+	total := len(results)
+	start := min((page-1)*pageSize, total)
+	end := min(start+pageSize, total)
+	results = results[start:end]
+	if !needsInventory {
+		for _, c := range results {
+			stock := h.allocationManager.GetStockAndETA(c.ID, targetStore)
+			c.Stock, c.ETADays = stock.Stock, stock.ETA
+		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"data":    collectibles,
+		"success":     true,
+		"data":        results,
+		"total":       total,
+		"page":        page,
+		"page_size":   pageSize,
+		"total_pages": (total + pageSize - 1) / pageSize,
 	})
 }
 
+// sortCollectibles orders enriched collectibles by a catalog sort key, breaking ties by
+// name so the order is stable. For eta, out-of-stock items (no ETA) always come last.
+func sortCollectibles(collectibles []*models.Collectible, key string, descending bool) {
+	sort.SliceStable(collectibles, func(i, j int) bool {
+		a, b := collectibles[i], collectibles[j]
+
+		var order int
+		switch key {
+		case sortByPrice:
+			order = cmp.Compare(a.DailyRate, b.DailyRate)
+		case sortByETA:
+			if (a.Stock == 0) != (b.Stock == 0) {
+				return b.Stock == 0
+			}
+			order = cmp.Compare(a.ETADays, b.ETADays)
+		case sortByStock:
+			order = cmp.Compare(a.Stock, b.Stock)
+		}
+		if order == 0 {
+			order = strings.Compare(a.Name, b.Name)
+		}
+		if descending {
+			return order > 0
+		}
+		return order < 0
+	})
+}
+
+// matchesCollectibleFilter reports whether a collectible matches a lowercased search
+// term (against name or description) and a size; empty values match everything
+func matchesCollectibleFilter(c *models.Collectible, search string, size models.Size) bool {
+	if size != "" && c.Size != size {
+		return false
+	}
+	if search == "" {
+		return true
+	}
+	return strings.Contains(strings.ToLower(c.Name), search) ||
+		strings.Contains(strings.ToLower(c.Description), search)
+}
+
 // GetCollectibleByID returns a specific collectible with warehouse information
 func (h *CollectiblesHandler) GetCollectibleByID(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -84,12 +307,7 @@ func (h *CollectiblesHandler) GetCollectibleByID(w http.ResponseWriter, r *http.
 
 	collectible, err := h.repo.GetCollectibleByID(id)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Collectible not found",
-		})
+		writeError(w, http.StatusNotFound, ErrCodeCollectibleNotFound, "Collectible not found")
 		return
 	}
 
@@ -102,3 +320,27 @@ func (h *CollectiblesHandler) GetCollectibleByID(w http.ResponseWriter, r *http.
 		"warehouses": warehouses,
 	})
 }
+
+// GetAvailability returns per-warehouse stock of a collectible near a store, nearest first
+func (h *CollectiblesHandler) GetAvailability(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	storeID := r.URL.Query().Get("store_id")
+	if storeID == "" {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "store_id is required")
+		return
+	}
+	if !validateStore(w, h.config, storeID) {
+		return
+	}
+
+	if _, err := h.repo.GetCollectibleByID(id); err != nil {
+		writeError(w, http.StatusNotFound, ErrCodeCollectibleNotFound, "Collectible not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"data":    h.allocationManager.GetStockDetails(id, storeID),
+	})
+}
@@ -0,0 +1,425 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mongocollectibles/rental-system/config"
+	"github.com/mongocollectibles/rental-system/data"
+	"github.com/mongocollectibles/rental-system/models"
+	"github.com/mongocollectibles/rental-system/services"
+)
+
+// newTestCollectiblesHandler builds a catalog of four collectibles across all sizes.
+// Only col-001 (2 units, 10 km = ETA 2 days to store-a) and col-003 (1 unit, 3 km = 1 day)
+// are in stock.
+func newTestCollectiblesHandler(t *testing.T) *CollectiblesHandler {
+	t.Helper()
+
+	repo := data.NewRepository()
+	for _, c := range []*models.Collectible{
+		{ID: "col-001", Name: "Vintage Batman Action Figure", Description: "Rare 1989 figure", Size: models.SizeSmall},
+		{ID: "col-002", Name: "Millennium Falcon Model", Description: "Detailed spaceship replica", Size: models.SizeMedium},
+		{ID: "col-003", Name: "Iron Man Suit", Description: "Full-scale armor replica", Size: models.SizeLarge},
+		{ID: "col-004", Name: "Pokemon Card Set", Description: "First edition holographic", Size: models.SizeSmall},
+	} {
+		repo.AddCollectible(c)
+	}
+
+	warehouses := []models.WarehouseNode{
+		{ID: "wh-1", Distances: map[string]int{"store-a": 3, "store-b": 7}},
+		{ID: "wh-2", Distances: map[string]int{"store-a": 10, "store-b": 2}},
+	}
+	units := []*models.CollectibleUnit{
+		{ID: "u-1a", CollectibleID: "col-001", WarehouseID: "wh-2", IsAvailable: true},
+		{ID: "u-1b", CollectibleID: "col-001", WarehouseID: "wh-2", IsAvailable: true},
+		{ID: "u-2", CollectibleID: "col-002", WarehouseID: "wh-1", IsAvailable: false},
+		{ID: "u-3", CollectibleID: "col-003", WarehouseID: "wh-1", IsAvailable: true},
+	}
+	am := services.NewAllocationManager(units, warehouses)
+	am.SetETAConversion(5, 0)
+
+	cfg := &config.Config{
+		Stores: []models.Store{
+			{ID: "store-a", Name: "Store A"},
+			{ID: "store-b", Name: "Store B"},
+		},
+	}
+	return NewCollectiblesHandler(repo, am, cfg)
+}
+
+// listCollectibles calls GetAllCollectibles with a query string and returns the page and total
+func listCollectibles(t *testing.T, h *CollectiblesHandler, query string) ([]models.Collectible, int) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/collectibles"+query, nil)
+	rec := httptest.NewRecorder()
+	h.GetAllCollectibles(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+
+	var resp struct {
+		Data  []models.Collectible `json:"data"`
+		Total int                  `json:"total"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return resp.Data, resp.Total
+}
+
+// assertCollectibleIDs checks that items carry exactly the wanted IDs, in order
+func assertCollectibleIDs(t *testing.T, items []models.Collectible, want []string) {
+	t.Helper()
+
+	got := make([]string, len(items))
+	for i, c := range items {
+		got[i] = c.ID
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("Expected %v, got %v", want, got)
+		}
+	}
+}
+
+func TestCollectiblesHandler_GetAllCollectibles_Filters(t *testing.T) {
+	h := newTestCollectiblesHandler(t)
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"No filters returns everything by name", "", []string{"col-003", "col-002", "col-004", "col-001"}},
+		{"Search matches name case-insensitively", "?q=BATMAN", []string{"col-001"}},
+		{"Search matches description", "?q=replica", []string{"col-003", "col-002"}},
+		{"Size filter", "?size=S", []string{"col-004", "col-001"}},
+		{"Lowercase size", "?size=l", []string{"col-003"}},
+		{"In stock only", "?in_stock=true", []string{"col-003", "col-001"}},
+		{"Search and size", "?q=replica&size=M", []string{"col-002"}},
+		{"Size and in stock", "?size=S&in_stock=true", []string{"col-001"}},
+		{"All filters with no match", "?q=falcon&size=M&in_stock=true", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, total := listCollectibles(t, h, tt.query)
+			if total != len(tt.want) {
+				t.Errorf("Expected total %d, got %d", len(tt.want), total)
+			}
+			assertCollectibleIDs(t, items, tt.want)
+		})
+	}
+
+	t.Run("Results keep stock enrichment", func(t *testing.T) {
+		items, _ := listCollectibles(t, h, "?q=batman")
+		if len(items) != 1 || items[0].Stock != 2 || items[0].DailyRate != 1000 {
+			t.Errorf("Expected enriched col-001, got %+v", items)
+		}
+	})
+
+	for _, query := range []string{"?size=XL", "?in_stock=maybe"} {
+		t.Run("Rejects "+query, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/collectibles"+query, nil)
+			rec := httptest.NewRecorder()
+			h.GetAllCollectibles(rec, req)
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("Expected 400, got %d", rec.Code)
+			}
+			assertErrorCode(t, rec, ErrCodeInvalidRequest)
+		})
+	}
+}
+
+func TestCollectiblesHandler_GetAllCollectibles_Sort(t *testing.T) {
+	h := newTestCollectiblesHandler(t)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"col-003", "col-002", "col-004", "col-001"}},
+		{"?sort=name&order=desc", []string{"col-001", "col-004", "col-002", "col-003"}},
+		// Equal small rates fall back to name
+		{"?sort=price", []string{"col-004", "col-001", "col-002", "col-003"}},
+		{"?sort=price&order=desc", []string{"col-003", "col-002", "col-001", "col-004"}},
+		// Out-of-stock items have no ETA and sort last either way
+		{"?sort=eta", []string{"col-003", "col-001", "col-002", "col-004"}},
+		{"?sort=eta&order=desc", []string{"col-001", "col-003", "col-004", "col-002"}},
+		{"?sort=stock", []string{"col-002", "col-004", "col-003", "col-001"}},
+		{"?sort=STOCK&order=DESC", []string{"col-001", "col-003", "col-004", "col-002"}},
+		{"?sort=price&size=S&order=desc", []string{"col-001", "col-004"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			items, _ := listCollectibles(t, h, tt.query)
+			assertCollectibleIDs(t, items, tt.want)
+		})
+	}
+
+	for _, query := range []string{"?sort=popularity", "?order=up"} {
+		t.Run("Rejects "+query, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/collectibles"+query, nil)
+			rec := httptest.NewRecorder()
+			h.GetAllCollectibles(rec, req)
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("Expected 400, got %d", rec.Code)
+			}
+			assertErrorCode(t, rec, ErrCodeInvalidRequest)
+		})
+	}
+}
+
+func TestCollectiblesHandler_GetAllCollectibles_Pagination(t *testing.T) {
+	type pageResponse struct {
+		Data       []models.Collectible `json:"data"`
+		Total      int                  `json:"total"`
+		Page       int                  `json:"page"`
+		PageSize   int                  `json:"page_size"`
+		TotalPages int                  `json:"total_pages"`
+	}
+	getPage := func(t *testing.T, h *CollectiblesHandler, query string) pageResponse {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/collectibles"+query, nil)
+		rec := httptest.NewRecorder()
+		h.GetAllCollectibles(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", rec.Code)
+		}
+		var resp pageResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return resp
+	}
+
+	t.Run("Second page with metadata", func(t *testing.T) {
+		h := newTestCollectiblesHandler(t)
+		resp := getPage(t, h, "?page=2&page_size=3")
+		assertCollectibleIDs(t, resp.Data, []string{"col-001"})
+		if resp.Total != 4 || resp.Page != 2 || resp.PageSize != 3 || resp.TotalPages != 2 {
+			t.Errorf("Unexpected pagination metadata: %+v", resp)
+		}
+	})
+
+	t.Run("Only the page's items get stock and ETA", func(t *testing.T) {
+		h := newTestCollectiblesHandler(t)
+		// Name order is col-003, col-002, col-004, col-001
+		resp := getPage(t, h, "?page=2&page_size=2")
+		assertCollectibleIDs(t, resp.Data, []string{"col-004", "col-001"})
+		if resp.Data[1].Stock != 2 || resp.Data[1].ETADays != 2 {
+			t.Errorf("Expected col-001 enriched, got %+v", resp.Data[1])
+		}
+
+		// col-003 has a unit in stock, but sat on page 1 so was never looked up
+		offPage, _ := h.repo.GetCollectibleByID("col-003")
+		if offPage.Stock != 0 || offPage.ETADays != 0 {
+			t.Errorf("Expected no stock lookup for off-page col-003, got %+v", offPage)
+		}
+	})
+
+	t.Run("Page past the end is empty", func(t *testing.T) {
+		h := newTestCollectiblesHandler(t)
+		resp := getPage(t, h, "?page=5&page_size=2")
+		if len(resp.Data) != 0 || resp.Total != 4 || resp.TotalPages != 2 {
+			t.Errorf("Expected empty page with totals, got %+v", resp)
+		}
+	})
+
+	t.Run("Page size is capped", func(t *testing.T) {
+		h := newTestCollectiblesHandler(t)
+		if resp := getPage(t, h, "?page_size=1000"); resp.PageSize != maxCatalogPageSize {
+			t.Errorf("Expected page size capped at %d, got %d", maxCatalogPageSize, resp.PageSize)
+		}
+	})
+
+	t.Run("Stock sort still pages correctly", func(t *testing.T) {
+		h := newTestCollectiblesHandler(t)
+		resp := getPage(t, h, "?sort=stock&order=desc&page_size=1")
+		assertCollectibleIDs(t, resp.Data, []string{"col-001"})
+	})
+
+	for _, query := range []string{"?page=0", "?page_size=-1", "?page=two"} {
+		t.Run("Rejects "+query, func(t *testing.T) {
+			h := newTestCollectiblesHandler(t)
+			req := httptest.NewRequest(http.MethodGet, "/api/collectibles"+query, nil)
+			rec := httptest.NewRecorder()
+			h.GetAllCollectibles(rec, req)
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("Expected 400, got %d", rec.Code)
+			}
+			assertErrorCode(t, rec, ErrCodeInvalidRequest)
+		})
+	}
+}
+
+func TestCollectiblesHandler_GetAllCollectibles_Archived(t *testing.T) {
+	list := func(h *CollectiblesHandler, query, auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/collectibles"+query, nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		h.GetAllCollectibles(rec, req)
+		return rec
+	}
+	newHandler := func(t *testing.T) *CollectiblesHandler {
+		h := newTestCollectiblesHandler(t)
+		h.config.Environment = "production"
+		h.config.AdminToken = "s3cret"
+		if err := h.repo.ArchiveCollectible("col-003"); err != nil {
+			t.Fatalf("ArchiveCollectible failed: %v", err)
+		}
+		return h
+	}
+
+	t.Run("Hidden from the catalog by default", func(t *testing.T) {
+		h := newHandler(t)
+		items, total := listCollectibles(t, h, "")
+		assertCollectibleIDs(t, items, []string{"col-002", "col-004", "col-001"})
+		if total != 3 {
+			t.Errorf("Expected total 3, got %d", total)
+		}
+	})
+
+	t.Run("Admins can include archived items", func(t *testing.T) {
+		h := newHandler(t)
+		rec := list(h, "?include_archived=true", "Bearer s3cret")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", rec.Code)
+		}
+		var items []models.Collectible
+		decodeData(t, rec, &items)
+		assertCollectibleIDs(t, items, []string{"col-003", "col-002", "col-004", "col-001"})
+		if !items[0].Archived {
+			t.Errorf("Expected col-003 flagged archived, got %+v", items[0])
+		}
+	})
+
+	t.Run("Non-admins cannot include archived items", func(t *testing.T) {
+		h := newHandler(t)
+		if rec := list(h, "?include_archived=true", ""); rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected 401 without a token, got %d", rec.Code)
+		}
+		if rec := list(h, "?include_archived=true", "Bearer wrong"); rec.Code != http.StatusForbidden {
+			t.Errorf("Expected 403 with a wrong token, got %d", rec.Code)
+		}
+		if rec := list(h, "?include_archived=maybe", ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for a non-boolean value, got %d", rec.Code)
+		}
+	})
+
+	t.Run("Still retrievable by ID", func(t *testing.T) {
+		h := newHandler(t)
+		req := httptest.NewRequest(http.MethodGet, "/api/collectibles/col-003", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "col-003"})
+		rec := httptest.NewRecorder()
+		h.GetCollectibleByID(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", rec.Code)
+		}
+		var c models.Collectible
+		decodeData(t, rec, &c)
+		if c.Name != "Iron Man Suit" || !c.Archived {
+			t.Errorf("Expected archived Iron Man Suit, got %+v", c)
+		}
+	})
+}
+
+func TestCollectiblesHandler_JoinWaitlist(t *testing.T) {
+	h := newTestCollectiblesHandler(t)
+
+	join := func(id string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/collectibles/"+id+"/waitlist", strings.NewReader(body))
+		req = mux.SetURLVars(req, map[string]string{"id": id})
+		rec := httptest.NewRecorder()
+		h.JoinWaitlist(rec, req)
+		return rec
+	}
+
+	rec := join("col-002", `{"name":"Juan","email":"Juan@Example.com","store_id":"store-a"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	var entry models.WaitlistEntry
+	decodeData(t, rec, &entry)
+	if entry.ID == "" || entry.CollectibleName != "Millennium Falcon Model" || entry.StoreID != "store-a" || entry.NotifiedAt != nil {
+		t.Errorf("Unexpected waitlist entry: %+v", entry)
+	}
+
+	t.Run("Joining again returns the pending entry", func(t *testing.T) {
+		rec := join("col-002", `{"email":"juan@example.com","store_id":"store-b"}`)
+		var again models.WaitlistEntry
+		decodeData(t, rec, &again)
+		if again.ID != entry.ID {
+			t.Errorf("Expected existing entry %s, got %s", entry.ID, again.ID)
+		}
+		if entries, _ := h.repo.GetWaitlistByCollectible("col-002"); len(entries) != 1 {
+			t.Errorf("Expected 1 waitlist entry, got %d", len(entries))
+		}
+	})
+
+	rejects := []struct {
+		name, id, body string
+		status         int
+		code           string
+	}{
+		{"Missing email", "col-002", `{"store_id":"store-a"}`, http.StatusBadRequest, ErrCodeInvalidRequest},
+		{"Malformed email", "col-002", `{"email":"juan","store_id":"store-a"}`, http.StatusBadRequest, ErrCodeInvalidRequest},
+		{"Unknown store", "col-002", `{"email":"juan@example.com","store_id":"store-z"}`, http.StatusBadRequest, ErrCodeUnknownStore},
+		{"Unknown collectible", "col-999", `{"email":"juan@example.com","store_id":"store-a"}`, http.StatusNotFound, ErrCodeCollectibleNotFound},
+	}
+	for _, tt := range rejects {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := join(tt.id, tt.body)
+			if rec.Code != tt.status {
+				t.Fatalf("Expected %d, got %d", tt.status, rec.Code)
+			}
+			assertErrorCode(t, rec, tt.code)
+		})
+	}
+}
+
+func TestWaitlist_NotifiedOnRelease(t *testing.T) {
+	h := newTestCollectiblesHandler(t)
+	am := h.allocationManager
+	notifier := &fakeNotifier{}
+	am.SetAvailabilityListener(services.NewWaitlistService(h.repo, notifier))
+
+	// col-003 has a single unit; take it so the collectible is out of stock
+	unit, _, err := am.Allocate("col-003", "store-a", "rental-1")
+	if err != nil {
+		t.Fatalf("Allocate failed: %v", err)
+	}
+	now := time.Now()
+	h.repo.AddWaitlistEntry(&models.WaitlistEntry{ID: "w-new", CollectibleID: "col-003", Email: "second@example.com", CreatedAt: now})
+	h.repo.AddWaitlistEntry(&models.WaitlistEntry{ID: "w-old", CollectibleID: "col-003", Email: "first@example.com", CreatedAt: now.Add(-time.Hour)})
+
+	if err := am.ReleaseUnit(unit.ID); err != nil {
+		t.Fatalf("ReleaseUnit failed: %v", err)
+	}
+	if len(notifier.backInStock) != 1 || notifier.backInStock[0] != "first@example.com" {
+		t.Fatalf("Expected the oldest entry to be notified, got %v", notifier.backInStock)
+	}
+
+	entries, _ := h.repo.GetWaitlistByCollectible("col-003")
+	if entries[0].ID != "w-old" || entries[0].NotifiedAt == nil || entries[1].NotifiedAt != nil {
+		t.Errorf("Expected only w-old marked notified, got %+v %+v", entries[0], entries[1])
+	}
+
+	// The next released unit goes to the next customer
+	unit, _, _ = am.Allocate("col-003", "store-a", "rental-2")
+	am.ReleaseUnit(unit.ID)
+	if len(notifier.backInStock) != 2 || notifier.backInStock[1] != "second@example.com" {
+		t.Errorf("Expected second@example.com notified next, got %v", notifier.backInStock)
+	}
+}
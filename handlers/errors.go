@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mongocollectibles/rental-system/config"
+)
+
+// Stable error codes returned in the error_code field of failed API responses.
+// Frontends should branch on these rather than on the human-readable message.
+const (
+	ErrCodeInvalidRequest      = "INVALID_REQUEST"
+	ErrCodeInvalidDuration     = "INVALID_DURATION"
+	ErrCodeCollectibleNotFound = "COLLECTIBLE_NOT_FOUND"
+	ErrCodeCollectibleArchived = "COLLECTIBLE_ARCHIVED"
+	ErrCodeUnknownStore        = "UNKNOWN_STORE"
+	ErrCodeRentalNotFound      = "RENTAL_NOT_FOUND"
+	ErrCodeUnitNotFound        = "UNIT_NOT_FOUND"
+	ErrCodeUnitRented          = "UNIT_RENTED"
+	ErrCodeWarehouseExists     = "WAREHOUSE_EXISTS"
+	ErrCodeNoStock             = "NO_STOCK"
+	ErrCodeStoreNotServed      = "STORE_NOT_SERVED"
+	ErrCodeInvalidRentalState  = "INVALID_RENTAL_STATE"
+	ErrCodeReservationExpired  = "RESERVATION_EXPIRED"
+	ErrCodePaymentError        = "PAYMENT_ERROR"
+	ErrCodeIdempotencyConflict = "IDEMPOTENCY_CONFLICT"
+	ErrCodeUnauthorized        = "UNAUTHORIZED"
+	ErrCodeForbidden           = "FORBIDDEN"
+	ErrCodeInternal            = "INTERNAL_ERROR"
+	ErrCodeUnavailable         = "SERVICE_UNAVAILABLE"
+)
+
+// APIError is the error body returned by JSON endpoints.
+// The success flag and free-text error are kept for backward compatibility.
+type APIError struct {
+	Success bool   `json:"success"`
+	Code    string `json:"error_code"`
+	Message string `json:"error"`
+}
+
+// writeError writes a JSON error response with a stable error code
+func writeError(w http.ResponseWriter, status int, code string, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(APIError{
+		Success: false,
+		Code:    code,
+		Message: message,
+	})
+}
+
+// validateStore writes an UNKNOWN_STORE error listing the valid store IDs and returns false
+// if storeID isn't a configured store
+func validateStore(w http.ResponseWriter, cfg *config.Config, storeID string) bool {
+	if cfg.IsValidStore(storeID) {
+		return true
+	}
+	writeError(w, http.StatusBadRequest, ErrCodeUnknownStore,
+		fmt.Sprintf("Unknown store_id %q; valid stores: %s", storeID, strings.Join(cfg.StoreIDs(), ", ")))
+	return false
+}
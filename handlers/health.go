@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/mongocollectibles/rental-system/data"
+)
+
+// HealthHandler serves liveness and readiness probes for load balancers
+type HealthHandler struct {
+	repo      data.Repository
+	version   string
+	startedAt time.Time
+}
+
+// NewHealthHandler creates a new health handler
+func NewHealthHandler(repo data.Repository, version string) *HealthHandler {
+	return &HealthHandler{
+		repo:      repo,
+		version:   version,
+		startedAt: time.Now(),
+	}
+}
+
+// Healthz reports that the process is up, with build and uptime info
+func (h *HealthHandler) Healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":     "ok",
+		"version":    h.version,
+		"started_at": h.startedAt,
+		"uptime":     time.Since(h.startedAt).Round(time.Second).String(),
+	})
+}
+
+// Readyz reports whether the backing repository is reachable
+func (h *HealthHandler) Readyz(w http.ResponseWriter, r *http.Request) {
+	if err := h.repo.Ping(); err != nil {
+		log.Printf("[Health] Readiness check failed: %v", err)
+		writeError(w, http.StatusServiceUnavailable, ErrCodeUnavailable, "Repository unreachable")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ready",
+	})
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mongocollectibles/rental-system/data"
+)
+
+// unreachableRepo is a repository whose backend cannot be reached
+type unreachableRepo struct {
+	data.Repository
+}
+
+func (unreachableRepo) Ping() error {
+	return errors.New("connection refused")
+}
+
+func TestHealthHandler(t *testing.T) {
+	t.Run("Healthz always reports ok", func(t *testing.T) {
+		h := NewHealthHandler(unreachableRepo{}, "test")
+		rec := httptest.NewRecorder()
+
+		h.Healthz(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("Expected 200, got %d", rec.Code)
+		}
+	})
+
+	t.Run("Readyz succeeds when repository is reachable", func(t *testing.T) {
+		h := NewHealthHandler(data.NewRepository(), "test")
+		rec := httptest.NewRecorder()
+
+		h.Readyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("Expected 200, got %d", rec.Code)
+		}
+	})
+
+	t.Run("Readyz returns 503 when repository is unreachable", func(t *testing.T) {
+		h := NewHealthHandler(unreachableRepo{}, "test")
+		rec := httptest.NewRecorder()
+
+		h.Readyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Fatalf("Expected 503, got %d", rec.Code)
+		}
+		assertErrorCode(t, rec, ErrCodeUnavailable)
+	})
+}
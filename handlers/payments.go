@@ -2,8 +2,14 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/mongocollectibles/rental-system/data"
 	"github.com/mongocollectibles/rental-system/models"
 	"github.com/mongocollectibles/rental-system/services"
@@ -14,6 +20,7 @@ type PaymentsHandler struct {
 	repo              data.Repository
 	paymentService    *services.PaymentService
 	allocationManager *services.AllocationManager
+	notifier          services.NotificationService
 }
 
 // NewPaymentsHandler creates a new payments handler
@@ -22,83 +29,192 @@ func NewPaymentsHandler(repo data.Repository, paymentService *services.PaymentSe
 		repo:              repo,
 		paymentService:    paymentService,
 		allocationManager: allocationManager,
+		notifier:          services.NoopNotificationService{},
 	}
 }
 
-// WebhookPayMongo handles PayMongo webhook events
+// SetNotificationService sets where customer emails (e.g. rental confirmations) are sent
+func (h *PaymentsHandler) SetNotificationService(notifier services.NotificationService) {
+	h.notifier = notifier
+}
+
+// WebhookPayMongo handles PayMongo webhook events. Every event is logged before it is
+// processed, then updated with the outcome, so missed payments can be debugged and replayed.
 func (h *PaymentsHandler) WebhookPayMongo(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	event := &models.WebhookEvent{
+		ID:         uuid.New().String(),
+		Payload:    string(body),
+		ReceivedAt: time.Now(),
+	}
+
 	var webhookData map[string]interface{}
-	if err := json.NewDecoder(r.Body).Decode(&webhookData); err != nil {
+	if err := json.Unmarshal(body, &webhookData); err != nil {
+		event.Error = "invalid JSON: " + err.Error()
+		h.saveWebhookEvent(event)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	// Extract payment ID from webhook
+	// Extract event ID and type
 	// Note: Actual webhook structure may vary, this is a simplified version
-	data, ok := webhookData["data"].(map[string]interface{})
-	if !ok {
-		w.WriteHeader(http.StatusOK)
-		return
+	eventData, _ := webhookData["data"].(map[string]interface{})
+	eventID, _ := eventData["id"].(string)
+	if eventID != "" {
+		event.ID = eventID
 	}
+	attributes, _ := eventData["attributes"].(map[string]interface{})
+	event.Type, _ = attributes["type"].(string)
 
-	// Extract event type
-	attributes, ok := data["attributes"].(map[string]interface{})
-	if !ok {
-		w.WriteHeader(http.StatusOK)
-		return
+	// PayMongo retries deliveries, so claim the event ID and skip events already handled.
+	// A 200 for duplicates tells PayMongo to stop retrying.
+	claimed := false
+	if eventID != "" {
+		switch err := h.repo.SaveIdempotencyKey(webhookIdempotencyKey(eventID), ""); {
+		case errors.Is(err, data.ErrIdempotencyKeyExists):
+			log.Printf("[Payment] Skipping duplicate webhook %s (%s)", eventID, event.Type)
+			w.WriteHeader(http.StatusOK)
+			return
+		case err != nil:
+			// Better to risk reprocessing than to drop the event
+			log.Printf("[Payment] Warning: Failed to claim webhook %s: %v", eventID, err)
+		default:
+			claimed = true
+		}
 	}
 
-	eventType, _ := attributes["type"].(string)
+	h.saveWebhookEvent(event)
 
+	if err := h.processWebhook(event.Type, attributes); err != nil {
+		log.Printf("[Payment] Webhook %s (%s) failed: %v", event.ID, event.Type, err)
+		event.Error = err.Error()
+		// Release the claim so a PayMongo retry or manual replay can process it again
+		if claimed {
+			if err := h.repo.DeleteIdempotencyKey(webhookIdempotencyKey(eventID)); err != nil {
+				log.Printf("[Payment] Warning: Failed to release webhook %s: %v", eventID, err)
+			}
+		}
+	} else {
+		event.Processed = true
+	}
+	h.saveWebhookEvent(event)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// webhookIdempotencyKey namespaces PayMongo event IDs within the idempotency key store
+func webhookIdempotencyKey(eventID string) string {
+	return "webhook:" + eventID
+}
+
+// saveWebhookEvent records a webhook event; a logging failure never blocks processing
+func (h *PaymentsHandler) saveWebhookEvent(event *models.WebhookEvent) {
+	if err := h.repo.SaveWebhookEvent(event); err != nil {
+		log.Printf("[Payment] Warning: Failed to log webhook %s: %v", event.ID, err)
+	}
+}
+
+// processWebhook applies a webhook event to the matching rental.
+// Events without a payment resource are ignored and count as processed.
+func (h *PaymentsHandler) processWebhook(eventType string, attributes map[string]interface{}) error {
 	// Use the data structure we need
 	dataResource, ok := attributes["data"].(map[string]interface{})
 	if !ok {
-		// Some events might be structured differently, safely ignore or log
-		w.WriteHeader(http.StatusOK)
-		return
+		// Some events might be structured differently, safely ignore
+		return nil
 	}
 	resourceAttr, ok := dataResource["attributes"].(map[string]interface{})
 	if !ok {
-		w.WriteHeader(http.StatusOK)
-		return
+		return nil
 	}
 	paymentID, _ := resourceAttr["id"].(string)
 
 	if eventType == "checkout_session.expired" {
 		// Find rental by payment ID (which is the session ID in this context)
-		// Or if we store session ID separately
-		rentals, _ := h.repo.GetAllRentals()
-		for _, rental := range rentals {
-			if rental.PaymentID == paymentID {
-				// Release unit
-				h.allocationManager.ReleaseUnit(rental.CollectibleID, rental.WarehouseID)
+		rental, err := h.repo.GetRentalByPaymentID(paymentID)
+		if err != nil {
+			return fmt.Errorf("no rental found for payment %s: %w", paymentID, err)
+		}
+		// Only a rental still awaiting payment can expire; a late (or forged) event must not
+		// fail a paid rental or free its unit
+		var newlyFailed bool
+		rental, err = data.UpdateRentalWithRetry(h.repo, rental.ID, func(rental *models.Rental) error {
+			newlyFailed = rental.PaymentStatus == models.PaymentPending
+			if newlyFailed {
 				rental.PaymentStatus = models.PaymentFailed
-				h.repo.UpdateRental(rental)
-				break
 			}
+			return nil
+		})
+		if err != nil {
+			return err
 		}
-		w.WriteHeader(http.StatusOK)
-		return
+		// Release the unit held for this rental
+		if newlyFailed {
+			if err := h.allocationManager.ReleaseByRentalID(rental.ID); err != nil {
+				log.Printf("[Payment] Unit for rental %s was already released: %v", rental.ID, err)
+			}
+		} else {
+			log.Printf("[Payment] Ignoring expired session for rental %s (Payment status: %s)", rental.ID, rental.PaymentStatus)
+		}
+		return nil
 	}
 
 	// Verify payment status for strictness, or trust the webhook
 	status, err := h.paymentService.VerifyPayment(paymentID)
 	if err != nil {
-		w.WriteHeader(http.StatusOK)
-		return
+		return fmt.Errorf("failed to verify payment %s: %w", paymentID, err)
 	}
 
 	// Update rental status based on payment
-	rentals, _ := h.repo.GetAllRentals()
-	for _, rental := range rentals {
-		if rental.PaymentID == paymentID {
-			rental.PaymentStatus = status
-			h.repo.UpdateRental(rental)
-			break
+	rental, err := h.repo.GetRentalByPaymentID(paymentID)
+	if err != nil {
+		return fmt.Errorf("no rental found for payment %s: %w", paymentID, err)
+	}
+	// Confirm the unit once, outside the update: it has side effects that must not repeat on a retry
+	var confirmed *confirmedAllocation
+	if status == models.PaymentCompleted && awaitingPayment(rental) {
+		confirmed = h.confirmAllocation(rental)
+	}
+
+	// The redirect may update the same rental concurrently, so transitions are decided
+	// against the copy that is actually saved
+	var newlyPaid, newlyFailed bool
+	rental, err = data.UpdateRentalWithRetry(h.repo, rental.ID, func(rental *models.Rental) error {
+		newlyFailed = status == models.PaymentFailed && awaitingPayment(rental)
+		newlyPaid = status == models.PaymentCompleted && awaitingPayment(rental)
+		switch {
+		case newlyPaid:
+			confirmed.applyTo(rental)
+			paidAt := time.Now()
+			rental.PaidAt = &paidAt
+			rental.PaymentStatus = models.PaymentCompleted
+		case newlyFailed:
+			rental.PaymentStatus = models.PaymentFailed
 		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !newlyPaid && !newlyFailed {
+		log.Printf("[Payment] Ignoring %s payment for rental %s (Status: %s, Payment status: %s)", status, rental.ID, rental.Status, rental.PaymentStatus)
 	}
 
-	w.WriteHeader(http.StatusOK)
+	// An expired or cancelled session frees the unit held for this rental
+	if newlyFailed {
+		if err := h.allocationManager.ReleaseByRentalID(rental.ID); err != nil {
+			log.Printf("[Payment] Unit for rental %s was already released: %v", rental.ID, err)
+		}
+	}
+	if newlyPaid {
+		h.sendConfirmation(rental)
+	}
+	return nil
 }
 
 // PaymentSuccess handles successful payment redirects
@@ -111,13 +227,41 @@ func (h *PaymentsHandler) PaymentSuccess(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	rental.PaymentStatus = models.PaymentCompleted
-	h.repo.UpdateRental(rental)
+	// A cancelled or already settled rental is never confirmed, even if its session was paid
+	if !awaitingPayment(rental) {
+		log.Printf("[Payment] Not confirming rental %s on redirect (Status: %s, Payment status: %s)", rental.ID, rental.Status, rental.PaymentStatus)
+		http.Redirect(w, r, "/success.html?rental_id="+rentalID, http.StatusSeeOther)
+		return
+	}
+
+	// Anyone can hit this redirect, so only a payment PayMongo reports as paid is confirmed.
+	// Anything else is left for the webhook to settle.
+	status, err := h.paymentService.VerifyPayment(rental.PaymentID)
+	if err != nil || status != models.PaymentCompleted {
+		log.Printf("[Payment] Not confirming rental %s on redirect (Payment status: %s, err: %v)", rental.ID, status, err)
+		http.Redirect(w, r, "/success.html?rental_id="+rentalID, http.StatusSeeOther)
+		return
+	}
 
 	// Confirm reservation in allocation manager to prevent auto-cleanup
-	if err := h.allocationManager.ConfirmReservation(rental.CollectibleID, rental.WarehouseID); err != nil {
-		// Log error but assume valid since we are in success flow
-		// log.Printf("Warning: Failed to confirm reservation: %v", err)
+	confirmed := h.confirmAllocation(rental)
+
+	// The webhook may update the same rental concurrently, so retry on version conflicts
+	var newlyPaid bool
+	updated, err := data.UpdateRentalWithRetry(h.repo, rental.ID, func(rental *models.Rental) error {
+		newlyPaid = awaitingPayment(rental)
+		if newlyPaid {
+			confirmed.applyTo(rental)
+			paidAt := time.Now()
+			rental.PaidAt = &paidAt
+			rental.PaymentStatus = models.PaymentCompleted
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("[Payment] Warning: Failed to mark rental %s paid: %v", rental.ID, err)
+	} else if newlyPaid {
+		h.sendConfirmation(updated)
 	}
 
 	// Redirect to success page
@@ -134,15 +278,75 @@ func (h *PaymentsHandler) PaymentFailed(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Release the allocated unit back to inventory
-	if err := h.allocationManager.ReleaseUnit(rental.CollectibleID, rental.WarehouseID); err != nil {
-		// Log the error but continue - we still want to update the rental status
-		// The unit might have already been released or not found
-	}
+	// Anyone can hit this redirect, so a rental is only failed while it still awaits a
+	// payment PayMongo confirms was not made. Anything else is left for the webhook to settle.
+	if rental.PaymentStatus == models.PaymentPending {
+		status, err := h.paymentService.VerifyPayment(rental.PaymentID)
+		if err != nil || status == models.PaymentCompleted {
+			log.Printf("[Payment] Not failing rental %s on redirect (Payment status: %s, err: %v)", rental.ID, status, err)
+			http.Redirect(w, r, "/failed.html?rental_id="+rentalID, http.StatusSeeOther)
+			return
+		}
 
-	rental.PaymentStatus = models.PaymentFailed
-	h.repo.UpdateRental(rental)
+		var newlyFailed bool
+		if _, err := data.UpdateRentalWithRetry(h.repo, rental.ID, func(rental *models.Rental) error {
+			newlyFailed = rental.PaymentStatus == models.PaymentPending
+			if newlyFailed {
+				rental.PaymentStatus = models.PaymentFailed
+			}
+			return nil
+		}); err != nil {
+			log.Printf("[Payment] Warning: Failed to mark rental %s failed: %v", rental.ID, err)
+		} else if newlyFailed {
+			// Release the allocated unit back to inventory
+			if err := h.allocationManager.ReleaseByRentalID(rental.ID); err != nil {
+				log.Printf("[Payment] Unit for rental %s was already released: %v", rental.ID, err)
+			}
+		}
+	} else {
+		log.Printf("[Payment] Ignoring failed redirect for rental %s (Payment status: %s)", rental.ID, rental.PaymentStatus)
+	}
 
 	// Redirect to failure page
 	http.Redirect(w, r, "/failed.html?rental_id="+rentalID, http.StatusSeeOther)
 }
+
+// awaitingPayment reports whether a rental can still be paid for (or fail to be).
+// Cancelled rentals and rentals whose payment was already settled are left as they are.
+func awaitingPayment(rental *models.Rental) bool {
+	return rental.Status == models.RentalActive && rental.PaymentStatus == models.PaymentPending
+}
+
+// sendConfirmation emails the customer that their rental is paid; failures are only logged
+func (h *PaymentsHandler) sendConfirmation(rental *models.Rental) {
+	if err := h.notifier.SendRentalConfirmation(rental); err != nil {
+		log.Printf("[Payment] Warning: Failed to send confirmation for rental %s: %v", rental.ID, err)
+	}
+}
+
+// confirmedAllocation is where a paid rental's confirmed unit ships from
+type confirmedAllocation struct {
+	warehouseID string
+	eta         int
+}
+
+// applyTo moves a rental to the confirmed unit's warehouse and ETA if they differ.
+// A nil allocation (nothing was confirmed) leaves the rental as it is.
+func (a *confirmedAllocation) applyTo(rental *models.Rental) {
+	if a != nil && a.warehouseID != rental.WarehouseID {
+		rental.WarehouseID = a.warehouseID
+		rental.ETA = a.eta
+	}
+}
+
+// confirmAllocation commits the unit held for a paid rental. The allocation manager may
+// pick a different unit (an expired soft hold); the result says where the rental now ships from.
+func (h *PaymentsHandler) confirmAllocation(rental *models.Rental) *confirmedAllocation {
+	unit, distance, err := h.allocationManager.ConfirmAllocation(rental.ID, rental.CollectibleID, rental.StoreID)
+	if err != nil {
+		// Log error but assume valid since we are in success flow
+		log.Printf("[Payment] Warning: Failed to confirm allocation for rental %s: %v", rental.ID, err)
+		return nil
+	}
+	return &confirmedAllocation{warehouseID: unit.WarehouseID, eta: h.allocationManager.ETADays(distance)}
+}
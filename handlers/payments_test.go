@@ -0,0 +1,421 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mongocollectibles/rental-system/data"
+	"github.com/mongocollectibles/rental-system/models"
+	"github.com/mongocollectibles/rental-system/services"
+)
+
+// expiredSessionEvent is a minimal checkout_session.expired webhook for the given session
+func expiredSessionEvent(eventID, sessionID string) []byte {
+	return []byte(`{"data":{"id":"` + eventID + `","attributes":{"type":"checkout_session.expired",` +
+		`"data":{"attributes":{"id":"` + sessionID + `"}}}}}`)
+}
+
+func TestWebhookPayMongo_EventLog(t *testing.T) {
+	_, repo, am := newTestRentalsHandler(t)
+	h := NewPaymentsHandler(repo, services.NewPaymentService("", ""), am)
+
+	send := func(body []byte) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.WebhookPayMongo(rec, httptest.NewRequest(http.MethodPost, "/api/webhooks/paymongo", bytes.NewReader(body)))
+		return rec
+	}
+	lastEvent := func(t *testing.T) *models.WebhookEvent {
+		t.Helper()
+		events, _ := repo.GetRecentWebhookEvents(1)
+		if len(events) != 1 {
+			t.Fatalf("Expected a logged webhook event, got %d", len(events))
+		}
+		return events[0]
+	}
+
+	t.Run("Processed event is logged with its ID and type", func(t *testing.T) {
+		repo.CreateRental(&models.Rental{ID: "rental-1", CollectibleID: "col-001", Status: models.RentalActive, PaymentID: "cs_1", PaymentStatus: models.PaymentPending})
+
+		body := expiredSessionEvent("evt_1", "cs_1")
+		if rec := send(body); rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", rec.Code)
+		}
+
+		event := lastEvent(t)
+		if event.ID != "evt_1" || event.Type != "checkout_session.expired" {
+			t.Errorf("Unexpected event: %+v", event)
+		}
+		if !event.Processed || event.Error != "" {
+			t.Errorf("Expected processed event without error, got %+v", event)
+		}
+		if event.Payload != string(body) {
+			t.Errorf("Expected raw payload to be stored, got %s", event.Payload)
+		}
+		if rental, _ := repo.GetRentalByID("rental-1"); rental.PaymentStatus != models.PaymentFailed {
+			t.Errorf("Expected rental to be marked failed, got %s", rental.PaymentStatus)
+		}
+	})
+
+	t.Run("Unmatched payment is logged as unprocessed", func(t *testing.T) {
+		send(expiredSessionEvent("evt_2", "cs_unknown"))
+
+		event := lastEvent(t)
+		if event.ID != "evt_2" || event.Processed || event.Error == "" {
+			t.Errorf("Expected unprocessed event with error, got %+v", event)
+		}
+	})
+
+	t.Run("Invalid JSON is logged and rejected", func(t *testing.T) {
+		if rec := send([]byte("{not json")); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400, got %d", rec.Code)
+		}
+
+		event := lastEvent(t)
+		if event.Processed || event.Payload != "{not json" || event.Error == "" {
+			t.Errorf("Expected failed event with raw payload, got %+v", event)
+		}
+	})
+}
+
+// countingRepo counts rental updates so tests can assert side effects happen once
+type countingRepo struct {
+	data.Repository
+	updates int
+}
+
+func (r *countingRepo) UpdateRental(rental *models.Rental) error {
+	r.updates++
+	return r.Repository.UpdateRental(rental)
+}
+
+func TestWebhookPayMongo_DuplicateEvent(t *testing.T) {
+	_, base, am := newTestRentalsHandler(t)
+	repo := &countingRepo{Repository: base}
+
+	var verifications int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&verifications, 1)
+		w.Write([]byte(`{"data":{"id":"cs_paid","attributes":{"status":"paid"}}}`))
+	}))
+	defer srv.Close()
+
+	h := NewPaymentsHandler(repo, services.NewPaymentServiceWithBaseURL("sk_test", "pk_test", srv.URL), am)
+
+	unit, _, err := am.Allocate("col-001", "store-a", "rental-1")
+	if err != nil {
+		t.Fatalf("Allocate failed: %v", err)
+	}
+	repo.CreateRental(&models.Rental{
+		ID: "rental-1", CollectibleID: "col-001", StoreID: "store-a", WarehouseID: unit.WarehouseID,
+		Status: models.RentalActive, PaymentID: "cs_paid", PaymentStatus: models.PaymentPending,
+	})
+
+	body := []byte(`{"data":{"id":"evt_paid","attributes":{"type":"checkout_session.payment.paid",` +
+		`"data":{"attributes":{"id":"cs_paid"}}}}}`)
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		h.WebhookPayMongo(rec, httptest.NewRequest(http.MethodPost, "/api/webhooks/paymongo", bytes.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Delivery %d: expected 200, got %d", i+1, rec.Code)
+		}
+	}
+
+	if repo.updates != 1 {
+		t.Errorf("Expected rental to be updated once, got %d", repo.updates)
+	}
+	if n := atomic.LoadInt32(&verifications); n != 1 {
+		t.Errorf("Expected payment to be verified once, got %d", n)
+	}
+	if rental, _ := repo.GetRentalByID("rental-1"); rental.PaymentStatus != models.PaymentCompleted {
+		t.Errorf("Expected completed, got %s", rental.PaymentStatus)
+	}
+}
+
+func TestWebhookPayMongo_LapsedSoftHoldConfirmedOnce(t *testing.T) {
+	_, base, am := newTestRentalsHandler(t)
+	am.SetAllocationMode(services.AllocationModeSoftHold, time.Minute)
+	repo := &conflictOnceRepo{Repository: base}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":{"id":"cs_paid","attributes":{"status":"paid"}}}`))
+	}))
+	defer srv.Close()
+
+	h := NewPaymentsHandler(repo, services.NewPaymentServiceWithBaseURL("sk_test", "pk_test", srv.URL), am)
+
+	// The hold on wh-2 already lapsed, so payment allocates the nearest unit (wh-1) instead
+	repo.CreateRental(&models.Rental{
+		ID: "rental-1", CollectibleID: "col-001", StoreID: "store-a", WarehouseID: "wh-2",
+		Status: models.RentalActive, PaymentID: "cs_paid", PaymentStatus: models.PaymentPending,
+	})
+
+	body := []byte(`{"data":{"id":"evt_paid","attributes":{"type":"checkout_session.payment.paid",` +
+		`"data":{"attributes":{"id":"cs_paid"}}}}}`)
+	rec := httptest.NewRecorder()
+	h.WebhookPayMongo(rec, httptest.NewRequest(http.MethodPost, "/api/webhooks/paymongo", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+
+	// The first save conflicted; retrying it must not allocate a second unit
+	if stock := am.GetTotalStock("col-001"); stock != 1 {
+		t.Errorf("Expected exactly one unit allocated on payment, %d left", stock)
+	}
+	rental, _ := repo.GetRentalByID("rental-1")
+	if rental.PaymentStatus != models.PaymentCompleted || rental.WarehouseID != "wh-1" {
+		t.Errorf("Expected completed rental moved to wh-1, got %s from %s", rental.PaymentStatus, rental.WarehouseID)
+	}
+}
+
+func TestPayment_CancelledRentalIsNotRevived(t *testing.T) {
+	srv := paymongoSessionStatus(t, "paid")
+	paidEvent := []byte(`{"data":{"id":"evt_paid","attributes":{"type":"checkout_session.payment.paid",` +
+		`"data":{"attributes":{"id":"cs_1"}}}}}`)
+
+	tests := []struct {
+		name string
+		pay  func(h *PaymentsHandler)
+	}{
+		{"Webhook", func(h *PaymentsHandler) {
+			h.WebhookPayMongo(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/webhooks/paymongo", bytes.NewReader(paidEvent)))
+		}},
+		{"Success redirect", func(h *PaymentsHandler) {
+			h.PaymentSuccess(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/payment/success?rental_id=rental-1", nil))
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, repo, am := newTestRentalsHandler(t)
+			am.SetAllocationMode(services.AllocationModeSoftHold, time.Minute)
+			h := NewPaymentsHandler(repo, services.NewPaymentServiceWithBaseURL("sk_test", "pk_test", srv.URL), am)
+			notifier := &fakeNotifier{}
+			h.SetNotificationService(notifier)
+
+			// The customer cancelled, then paid through the still-open session
+			repo.CreateRental(&models.Rental{
+				ID: "rental-1", CollectibleID: "col-001", StoreID: "store-a",
+				Status: models.RentalCancelled, PaymentID: "cs_1", PaymentStatus: models.PaymentFailed,
+			})
+
+			tt.pay(h)
+
+			rental, _ := repo.GetRentalByID("rental-1")
+			if rental.Status != models.RentalCancelled || rental.PaymentStatus != models.PaymentFailed || rental.PaidAt != nil {
+				t.Errorf("Expected cancelled rental to be left alone, got %s (payment %s, paid at %v)", rental.Status, rental.PaymentStatus, rental.PaidAt)
+			}
+			if stock := am.GetTotalStock("col-001"); stock != 2 {
+				t.Errorf("Expected no unit allocated to a cancelled rental, stock %d", stock)
+			}
+			if len(notifier.confirmations) != 0 {
+				t.Errorf("Expected no confirmation email, got %v", notifier.confirmations)
+			}
+		})
+	}
+}
+
+func TestWebhookPayMongo_ExpiredSessionIgnoredOncePaid(t *testing.T) {
+	_, repo, am := newTestRentalsHandler(t)
+	h := NewPaymentsHandler(repo, services.NewPaymentService("", ""), am)
+
+	unit, _, _ := am.Allocate("col-001", "store-a", "rental-1")
+	if _, _, err := am.ConfirmAllocation("rental-1", "col-001", "store-a"); err != nil {
+		t.Fatalf("ConfirmAllocation failed: %v", err)
+	}
+	repo.CreateRental(&models.Rental{ID: "rental-1", CollectibleID: "col-001", WarehouseID: unit.WarehouseID, PaymentID: "cs_1", PaymentStatus: models.PaymentCompleted})
+
+	rec := httptest.NewRecorder()
+	h.WebhookPayMongo(rec, httptest.NewRequest(http.MethodPost, "/api/webhooks/paymongo", bytes.NewReader(expiredSessionEvent("evt_late", "cs_1"))))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+
+	if rental, _ := repo.GetRentalByID("rental-1"); rental.PaymentStatus != models.PaymentCompleted {
+		t.Errorf("Expected paid rental to stay completed, got %s", rental.PaymentStatus)
+	}
+	if unit.IsAvailable {
+		t.Error("Expected the paid rental's unit to stay rented")
+	}
+}
+
+func TestWebhookPayMongo_FailedEventCanBeRetried(t *testing.T) {
+	_, repo, am := newTestRentalsHandler(t)
+	h := NewPaymentsHandler(repo, services.NewPaymentService("", ""), am)
+
+	send := func() {
+		rec := httptest.NewRecorder()
+		h.WebhookPayMongo(rec, httptest.NewRequest(http.MethodPost, "/api/webhooks/paymongo", bytes.NewReader(expiredSessionEvent("evt_retry", "cs_late"))))
+	}
+
+	// First delivery arrives before the rental exists
+	send()
+	repo.CreateRental(&models.Rental{ID: "rental-2", CollectibleID: "col-001", Status: models.RentalActive, PaymentID: "cs_late", PaymentStatus: models.PaymentPending})
+	send()
+
+	if rental, _ := repo.GetRentalByID("rental-2"); rental.PaymentStatus != models.PaymentFailed {
+		t.Errorf("Expected retried event to be processed, got %s", rental.PaymentStatus)
+	}
+}
+
+// fakeNotifier records the rentals and waitlist emails it was asked to send
+type fakeNotifier struct {
+	confirmations []string
+	refunds       []string
+	backInStock   []string
+	err           error
+}
+
+func (n *fakeNotifier) SendRentalConfirmation(rental *models.Rental) error {
+	n.confirmations = append(n.confirmations, rental.ID)
+	return n.err
+}
+
+func (n *fakeNotifier) SendRefundNotice(rental *models.Rental) error {
+	n.refunds = append(n.refunds, rental.ID)
+	return n.err
+}
+
+func (n *fakeNotifier) SendBackInStock(entry *models.WaitlistEntry) error {
+	n.backInStock = append(n.backInStock, entry.Email)
+	return n.err
+}
+
+// paymongoSessionStatus serves checkout sessions that all report the given status
+func paymongoSessionStatus(t *testing.T, status string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":{"id":"cs_1","attributes":{"status":"` + status + `"}}}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestPaymentSuccess_SendsConfirmation(t *testing.T) {
+	_, repo, am := newTestRentalsHandler(t)
+	srv := paymongoSessionStatus(t, "paid")
+	h := NewPaymentsHandler(repo, services.NewPaymentServiceWithBaseURL("sk_test", "pk_test", srv.URL), am)
+	notifier := &fakeNotifier{err: errors.New("smtp down")}
+	h.SetNotificationService(notifier)
+
+	unit, _, _ := am.Allocate("col-001", "store-a", "rental-1")
+	repo.CreateRental(&models.Rental{ID: "rental-1", CollectibleID: "col-001", StoreID: "store-a", WarehouseID: unit.WarehouseID, Status: models.RentalActive, PaymentID: "cs_1", PaymentStatus: models.PaymentPending})
+
+	// The redirect can be hit more than once (refresh); only the first one confirms
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		h.PaymentSuccess(rec, httptest.NewRequest(http.MethodGet, "/payment/success?rental_id=rental-1", nil))
+		if rec.Code != http.StatusSeeOther {
+			t.Fatalf("Expected redirect despite notification failure, got %d", rec.Code)
+		}
+	}
+
+	if len(notifier.confirmations) != 1 || notifier.confirmations[0] != "rental-1" {
+		t.Errorf("Expected one confirmation for rental-1, got %v", notifier.confirmations)
+	}
+	if rental, _ := repo.GetRentalByID("rental-1"); rental.PaymentStatus != models.PaymentCompleted || rental.PaidAt == nil {
+		t.Errorf("Expected completed with a payment timestamp, got %s (paid at %v)", rental.PaymentStatus, rental.PaidAt)
+	}
+}
+
+func TestPaymentSuccess_UnpaidSessionIsNotConfirmed(t *testing.T) {
+	_, repo, am := newTestRentalsHandler(t)
+	am.SetAllocationMode(services.AllocationModeSoftHold, time.Minute)
+	srv := paymongoSessionStatus(t, "active")
+	h := NewPaymentsHandler(repo, services.NewPaymentServiceWithBaseURL("sk_test", "pk_test", srv.URL), am)
+	notifier := &fakeNotifier{}
+	h.SetNotificationService(notifier)
+
+	// The soft hold lapsed; confirming now would allocate a fresh unit
+	repo.CreateRental(&models.Rental{ID: "rental-1", CollectibleID: "col-001", StoreID: "store-a", Status: models.RentalActive, PaymentID: "cs_1", PaymentStatus: models.PaymentPending})
+
+	rec := httptest.NewRecorder()
+	h.PaymentSuccess(rec, httptest.NewRequest(http.MethodGet, "/payment/success?rental_id=rental-1", nil))
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("Expected redirect, got %d", rec.Code)
+	}
+
+	if rental, _ := repo.GetRentalByID("rental-1"); rental.PaymentStatus != models.PaymentPending {
+		t.Errorf("Expected rental to stay pending, got %s", rental.PaymentStatus)
+	}
+	if stock := am.GetTotalStock("col-001"); stock != 2 {
+		t.Errorf("Expected no unit to be allocated, stock %d", stock)
+	}
+	if len(notifier.confirmations) != 0 {
+		t.Errorf("Expected no confirmation email, got %v", notifier.confirmations)
+	}
+}
+
+func TestPaymentFailed_ReleasesRentalsOwnUnit(t *testing.T) {
+	_, repo, am := newTestRentalsHandler(t)
+	srv := paymongoSessionStatus(t, "expired")
+	h := NewPaymentsHandler(repo, services.NewPaymentServiceWithBaseURL("sk_test", "pk_test", srv.URL), am)
+
+	// Both units are held; the failed rental must not free the other rental's unit
+	held, _, _ := am.Allocate("col-001", "store-a", "rental-1")
+	failed, _, _ := am.Allocate("col-001", "store-a", "rental-2")
+	repo.CreateRental(&models.Rental{ID: "rental-2", CollectibleID: "col-001", WarehouseID: failed.WarehouseID, Status: models.RentalActive, PaymentID: "cs_1", PaymentStatus: models.PaymentPending})
+
+	rec := httptest.NewRecorder()
+	h.PaymentFailed(rec, httptest.NewRequest(http.MethodGet, "/payment/failed?rental_id=rental-2", nil))
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("Expected redirect, got %d", rec.Code)
+	}
+
+	if !failed.IsAvailable {
+		t.Error("Expected the failed rental's unit back in stock")
+	}
+	if held.IsAvailable || held.ReservationID != "rental-1" {
+		t.Errorf("Other rental's unit should stay held, got %+v", held)
+	}
+	if rental, _ := repo.GetRentalByID("rental-2"); rental.PaymentStatus != models.PaymentFailed {
+		t.Errorf("Expected failed, got %s", rental.PaymentStatus)
+	}
+}
+
+func TestPaymentFailed_PaidRentalKeepsItsUnit(t *testing.T) {
+	_, repo, am := newTestRentalsHandler(t)
+
+	tests := []struct {
+		name          string
+		sessionStatus string
+		paymentStatus models.PaymentStatus
+	}{
+		{"Rental already paid", "paid", models.PaymentCompleted},
+		{"Session paid before the webhook arrived", "paid", models.PaymentPending},
+		{"Refunded rental", "expired", models.PaymentRefunded},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := paymongoSessionStatus(t, tt.sessionStatus)
+			h := NewPaymentsHandler(repo, services.NewPaymentServiceWithBaseURL("sk_test", "pk_test", srv.URL), am)
+
+			rentalID := fmt.Sprintf("rental-%d", i)
+			unit, _, err := am.Allocate("col-001", "store-a", rentalID)
+			if err != nil {
+				t.Fatalf("Allocate failed: %v", err)
+			}
+			defer am.ReleaseUnit(unit.ID)
+			repo.CreateRental(&models.Rental{ID: rentalID, CollectibleID: "col-001", WarehouseID: unit.WarehouseID, PaymentID: "cs_1", PaymentStatus: tt.paymentStatus})
+
+			rec := httptest.NewRecorder()
+			h.PaymentFailed(rec, httptest.NewRequest(http.MethodGet, "/payment/failed?rental_id="+rentalID, nil))
+			if rec.Code != http.StatusSeeOther {
+				t.Fatalf("Expected redirect, got %d", rec.Code)
+			}
+
+			if unit.IsAvailable || unit.ReservationID != rentalID {
+				t.Errorf("Expected the unit to stay with the rental, got %+v", unit)
+			}
+			if rental, _ := repo.GetRentalByID(rentalID); rental.PaymentStatus != tt.paymentStatus {
+				t.Errorf("Expected payment status %s to be kept, got %s", tt.paymentStatus, rental.PaymentStatus)
+			}
+		})
+	}
+}
@@ -2,12 +2,14 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/gorilla/mux"
 	"github.com/mongocollectibles/rental-system/config"
 	"github.com/mongocollectibles/rental-system/data"
 	"github.com/mongocollectibles/rental-system/models"
@@ -20,6 +22,7 @@ type RentalsHandler struct {
 	pricingService    *services.PricingService
 	allocationManager *services.AllocationManager
 	paymentService    *services.PaymentService
+	notifier          services.NotificationService
 	config            *config.Config
 }
 
@@ -36,41 +39,42 @@ func NewRentalsHandler(
 		pricingService:    pricingService,
 		allocationManager: allocationManager,
 		paymentService:    paymentService,
+		notifier:          services.NoopNotificationService{},
 		config:            cfg,
 	}
 }
 
+// SetNotificationService sets where customer emails (e.g. refund notices) are sent
+func (h *RentalsHandler) SetNotificationService(notifier services.NotificationService) {
+	h.notifier = notifier
+}
+
 // GetQuote calculates a rental quote
 func (h *RentalsHandler) GetQuote(w http.ResponseWriter, r *http.Request) {
 	var req models.RentalQuoteRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Invalid request body",
-		})
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.pricingService.ValidateDuration(req.Duration); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidDuration, err.Error())
 		return
 	}
 
-	// Validate store first
-	if req.StoreID == "" {
-		// Optional: If no store selected, return stock but 0 ETA, or error.
-		// For now, let's assume store is required for a valid quote including ETA.
-		// However, the prompt implies "EU1 rents from Store1", so store is known context.
-		// If the frontend calls getQuote before store selection, we might handle that.
-		// Let's implement strict validation for now.
+	// Validate store first so an unknown store doesn't surface as a zero ETA
+	if !validateStore(w, h.config, req.StoreID) {
+		return
 	}
 
 	// Get collectible
 	collectible, err := h.repo.GetCollectibleByID(req.CollectibleID)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Collectible not found",
-		})
+		writeError(w, http.StatusNotFound, ErrCodeCollectibleNotFound, "Collectible not found")
+		return
+	}
+	if collectible.Archived {
+		writeError(w, http.StatusConflict, ErrCodeCollectibleArchived, "Collectible is no longer available for rent")
 		return
 	}
 
@@ -81,15 +85,19 @@ func (h *RentalsHandler) GetQuote(w http.ResponseWriter, r *http.Request) {
 	stock := h.allocationManager.GetTotalStock(collectible.ID)
 	quote.Stock = stock
 
-	// Get ETA
+	// Get ETA from the same warehouse checkout would allocate from
 	if req.StoreID != "" {
-		eta, err := h.allocationManager.GetETA(collectible.ID, req.StoreID)
+		_, eta, err := h.allocationManager.PreviewAllocation(collectible.ID, req.StoreID)
 		if err == nil {
 			quote.ETA = eta
 		} else {
 			// If error (e.g. no stock), ETA remains 0 or we could set a flag
 			quote.ETA = 0
 		}
+
+		// The first option is what checkout would allocate; the rest are fallbacks
+		options := h.allocationManager.GetStockDetails(collectible.ID, req.StoreID)
+		quote.WarehouseOptions = options[:min(len(options), maxQuoteWarehouseOptions)]
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -99,16 +107,23 @@ func (h *RentalsHandler) GetQuote(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// maxQuoteWarehouseOptions caps how many warehouses a quote lists
+const maxQuoteWarehouseOptions = 3
+
 // Checkout creates a rental and initiates payment
 func (h *RentalsHandler) Checkout(w http.ResponseWriter, r *http.Request) {
 	var req models.CheckoutRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Invalid request body",
-		})
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	// Reject unpriceable durations before allocating a unit or creating a payment session
+	if err := h.pricingService.ValidateDuration(req.Duration); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidDuration, err.Error())
+		return
+	}
+	if !validateStore(w, h.config, req.StoreID) {
 		return
 	}
 
@@ -117,33 +132,38 @@ func (h *RentalsHandler) Checkout(w http.ResponseWriter, r *http.Request) {
 	// Get collectible
 	collectible, err := h.repo.GetCollectibleByID(req.CollectibleID)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Collectible not found",
-		})
+		writeError(w, http.StatusNotFound, ErrCodeCollectibleNotFound, "Collectible not found")
 		return
 	}
-
-	// Allocate warehouse
-	// Now using StoreID directly as the primary identifier for distance lookups
-	unit, eta, err := h.allocationManager.Allocate(req.CollectibleID, req.StoreID)
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusConflict)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "No available warehouse for this collectible at the selected store",
-		})
+	if collectible.Archived {
+		writeError(w, http.StatusConflict, ErrCodeCollectibleArchived, "Collectible is no longer available for rent")
 		return
 	}
-	warehouseID := unit.WarehouseID
 
-	// Calculate pricing
-	dailyRate, totalFee, _ := h.pricingService.CalculateRentalFee(collectible.Size, req.Duration)
+	rentalID := uuid.New().String()
 
-	// Idempotency: Check if user already has a pending rental for this collectible
+	// Idempotency-Key: the first request to claim a key owns it; retries replay its result.
+	// The claim is released if this request fails so the client can retry with the same key.
+	idempotencyKey := r.Header.Get("Idempotency-Key")
+	rentalCreated := false
+	if idempotencyKey != "" {
+		if err := h.repo.SaveIdempotencyKey(idempotencyKey, rentalID); err != nil {
+			if errors.Is(err, data.ErrIdempotencyKeyExists) {
+				h.replayCheckout(w, idempotencyKey)
+				return
+			}
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to process idempotency key")
+			return
+		}
+		defer func() {
+			if !rentalCreated {
+				h.repo.DeleteIdempotencyKey(idempotencyKey)
+			}
+		}()
+	}
+
+	// Idempotency: Check if user already has a pending rental for this collectible.
+	// This runs before allocating so resuming a rental never reserves a second unit.
 	// note: This simplistic check assumes 1 pending rental per user/collectible pair is allowed
 	existingRentals, _ := h.repo.GetRentalsByCustomerAndCollectible(req.Customer.Email, req.CollectibleID)
 	for _, rent := range existingRentals {
@@ -155,11 +175,16 @@ func (h *RentalsHandler) Checkout(w http.ResponseWriter, r *http.Request) {
 			// We might need to update the payment session if amount changed, but keeping it simple:
 			// just return existing rental info
 			response := models.CheckoutResponse{
-				RentalID:   rent.ID,
-				TotalFee:   rent.TotalFee,
-				ETA:        rent.ETA,
-				PaymentURL: rent.PaymentURL,
-				Message:    "Found pending rental. Please complete payment.",
+				RentalID:     rent.ID,
+				TotalFee:     rent.TotalFee,
+				TaxAmount:    rent.TaxAmount,
+				TotalWithTax: rent.TotalFee + rent.TaxAmount,
+				Deposit:      rent.Deposit,
+				InsuranceFee: rent.InsuranceFee,
+				TotalDue:     rent.AmountCharged(),
+				ETA:          rent.ETA,
+				PaymentURL:   rent.PaymentURL,
+				Message:      "Found pending rental. Please complete payment.",
 			}
 
 			log.Printf("[Rental] Resuming pending rental %s", rent.ID)
@@ -173,8 +198,40 @@ func (h *RentalsHandler) Checkout(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Allocate warehouse
+	// Now using StoreID directly as the primary identifier for distance lookups
+	unit, distance, err := h.allocationManager.Allocate(req.CollectibleID, req.StoreID, rentalID)
+	if errors.Is(err, services.ErrStoreNotServed) {
+		writeError(w, http.StatusConflict, ErrCodeStoreNotServed, "This collectible is in stock, but no warehouse holding it ships to the selected store")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusConflict, ErrCodeNoStock, "No available warehouse for this collectible at the selected store")
+		return
+	}
+
+	// Give the unit back if this request fails before its rental is saved
+	keepUnit := false
+	defer func() {
+		if !keepUnit {
+			if err := h.allocationManager.ReleaseUnit(unit.ID); err != nil {
+				log.Printf("[Rental] Warning: Failed to release hold on Unit %s: %v", unit.ID, err)
+			}
+		}
+	}()
+	warehouseID := unit.WarehouseID
+	eta := h.allocationManager.ETADays(distance)
+
+	// Calculate pricing
+	dailyRate, totalFee, _, _ := h.pricingService.CalculateRentalFee(collectible.Size, req.Duration)
+	taxAmount := h.pricingService.CalculateTax(totalFee)
+	deposit := h.pricingService.CalculateDeposit(collectible.Size)
+	var insuranceFee float64
+	if req.InsuranceOptIn {
+		insuranceFee = h.pricingService.CalculateInsuranceFee(totalFee)
+	}
+
 	// Create rental record
-	rentalID := uuid.New().String()
 	rental := &models.Rental{
 		ID:              rentalID,
 		CollectibleID:   req.CollectibleID,
@@ -182,55 +239,64 @@ func (h *RentalsHandler) Checkout(w http.ResponseWriter, r *http.Request) {
 		StoreID:         req.StoreID,
 		WarehouseID:     warehouseID,
 		Customer:        req.Customer,
+		CustomerEmail:   req.Customer.Email,
 		Duration:        req.Duration,
 		DailyRate:       dailyRate,
 		TotalFee:        totalFee,
+		TaxAmount:       taxAmount,
+		Deposit:         deposit,
+		InsuranceFee:    insuranceFee,
 		PaymentMethod:   req.PaymentMethod,
 		PaymentStatus:   models.PaymentPending,
 		ETA:             eta,
+		Status:          models.RentalActive,
 		CreatedAt:       time.Now(),
 		UpdatedAt:       time.Now(),
 	}
 
-	// Determine Base URL
-	scheme := "http"
-	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
-		scheme = "https"
+	// Payment redirect links point at the configured public URL, falling back to the request host
+	baseURL := h.config.BaseURL
+	if baseURL == "" {
+		scheme := "http"
+		if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+			scheme = "https"
+		}
+		baseURL = fmt.Sprintf("%s://%s", scheme, r.Host)
 	}
-	baseURL := fmt.Sprintf("%s://%s", scheme, r.Host)
 
 	// Create payment session
-	paymentID, paymentURL, err := h.paymentService.CreateCheckoutSession(
-		baseURL,
-		totalFee,
-		rentalID,
-		collectible.Name,
-		req.Duration,
-	)
+	paymentID, paymentURL, err := h.paymentService.CreateCheckoutSession(services.CheckoutSessionParams{
+		BaseURL:         baseURL,
+		RentalID:        rentalID,
+		CollectibleName: collectible.Name,
+		Duration:        req.Duration,
+		DailyRate:       dailyRate,
+		TaxAmount:       taxAmount,
+		InsuranceFee:    insuranceFee,
+		Deposit:         deposit,
+		PaymentMethods:  checkoutPaymentMethods(collectible),
+	})
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Failed to create payment: " + err.Error(),
-		})
+		writeError(w, http.StatusInternalServerError, ErrCodePaymentError, "Failed to create payment: "+err.Error())
 		return
 	}
 
 	rental.PaymentID = paymentID
 	rental.PaymentURL = paymentURL
 
-	// Save rental
+	// Save rental. Rental IDs are generated per request, so a taken ID is a conflict rather
+	// than a retry (retries are matched by Idempotency-Key above); the unit held here is given back.
 	if err := h.repo.CreateRental(rental); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   "Failed to create rental",
-		})
+		if errors.Is(err, data.ErrRentalExists) {
+			writeError(w, http.StatusConflict, ErrCodeIdempotencyConflict, "Rental already exists; please check out again")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to create rental")
 		return
 	}
 
+	rentalCreated = true
+	keepUnit = true
 	log.Printf("[Rental] Created Rental %s (Payment ID: %s)", rentalID, paymentID)
 
 	// Mark warehouse as unavailable
@@ -238,11 +304,301 @@ func (h *RentalsHandler) Checkout(w http.ResponseWriter, r *http.Request) {
 
 	// Return response
 	response := models.CheckoutResponse{
-		RentalID:   rentalID,
-		TotalFee:   totalFee,
-		ETA:        eta,
-		PaymentURL: paymentURL,
-		Message:    "Rental created successfully. Please complete payment.",
+		RentalID:     rentalID,
+		TotalFee:     totalFee,
+		TaxAmount:    taxAmount,
+		TotalWithTax: totalFee + taxAmount,
+		Deposit:      deposit,
+		InsuranceFee: insuranceFee,
+		TotalDue:     totalFee + taxAmount + insuranceFee + deposit,
+		ETA:          eta,
+		PaymentURL:   paymentURL,
+		Message:      "Rental created successfully. Please complete payment.",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"data":    response,
+	})
+}
+
+// GetRental returns the current state of a single rental so customers can poll after checkout
+func (h *RentalsHandler) GetRental(w http.ResponseWriter, r *http.Request) {
+	rentalID := mux.Vars(r)["id"]
+
+	rental, err := h.repo.GetRentalByID(rentalID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, ErrCodeRentalNotFound, "Rental not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"data":    h.rentalDetails(rental),
+	})
+}
+
+// rentalDetails is the customer-facing view of a rental. It leaves out customer details and
+// payment references, which only staff should see.
+func (h *RentalsHandler) rentalDetails(rental *models.Rental) models.RentalDetailsResponse {
+	details := models.RentalDetailsResponse{
+		RentalID:        rental.ID,
+		CollectibleID:   rental.CollectibleID,
+		CollectibleName: rental.CollectibleName,
+		StoreID:         rental.StoreID,
+		Duration:        rental.Duration,
+		DailyRate:       rental.DailyRate,
+		TotalFee:        rental.TotalFee,
+		LateFee:         rental.LateFee,
+		ETA:             rental.ETA,
+		PaymentStatus:   rental.PaymentStatus,
+		Status:          rental.Status,
+		CreatedAt:       rental.CreatedAt,
+		ReturnedAt:      rental.ReturnedAt,
+	}
+	if store := h.config.GetStoreByID(rental.StoreID); store != nil {
+		details.StoreName = store.Name
+	}
+	return details
+}
+
+// GetReceipt returns an itemized breakdown of a rental's charges
+func (h *RentalsHandler) GetReceipt(w http.ResponseWriter, r *http.Request) {
+	rentalID := mux.Vars(r)["id"]
+
+	rental, err := h.repo.GetRentalByID(rentalID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, ErrCodeRentalNotFound, "Rental not found")
+		return
+	}
+
+	collectible, err := h.repo.GetCollectibleByID(rental.CollectibleID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, ErrCodeCollectibleNotFound, "Collectible not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"data":    h.pricingService.BuildReceipt(collectible, rental),
+	})
+}
+
+// replayCheckout returns the original checkout result for a repeated Idempotency-Key
+func (h *RentalsHandler) replayCheckout(w http.ResponseWriter, idempotencyKey string) {
+	rentalID, err := h.repo.GetRentalIDByIdempotencyKey(idempotencyKey)
+	if err == nil {
+		if rental, err := h.repo.GetRentalByID(rentalID); err == nil {
+			log.Printf("[Rental] Replaying checkout for Idempotency-Key (Rental %s)", rental.ID)
+			writeCheckoutReplay(w, rental)
+			return
+		}
+	}
+
+	// The original request claimed the key but hasn't created its rental yet
+	writeError(w, http.StatusConflict, ErrCodeIdempotencyConflict, "A request with this Idempotency-Key is still being processed")
+}
+
+// writeCheckoutReplay answers a repeated checkout with the rental the first attempt created
+func writeCheckoutReplay(w http.ResponseWriter, rental *models.Rental) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"data": models.CheckoutResponse{
+			RentalID:     rental.ID,
+			TotalFee:     rental.TotalFee,
+			TaxAmount:    rental.TaxAmount,
+			TotalWithTax: rental.TotalFee + rental.TaxAmount,
+			Deposit:      rental.Deposit,
+			InsuranceFee: rental.InsuranceFee,
+			TotalDue:     rental.AmountCharged(),
+			ETA:          rental.ETA,
+			PaymentURL:   rental.PaymentURL,
+			Message:      "Rental created successfully. Please complete payment.",
+		},
+	})
+}
+
+// ExtendHold restarts the reservation timeout for a rental that is still awaiting payment,
+// so a customer who needs longer at checkout doesn't lose their unit
+func (h *RentalsHandler) ExtendHold(w http.ResponseWriter, r *http.Request) {
+	rentalID := mux.Vars(r)["id"]
+
+	rental, err := h.repo.GetRentalByID(rentalID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, ErrCodeRentalNotFound, "Rental not found")
+		return
+	}
+
+	if rental.Status != models.RentalActive || rental.PaymentStatus != models.PaymentPending {
+		writeError(w, http.StatusConflict, ErrCodeInvalidRentalState, "Only rentals awaiting payment can extend their hold")
+		return
+	}
+
+	if err := h.allocationManager.ExtendReservation(rental.ID); err != nil {
+		if errors.Is(err, services.ErrReservationNotFound) {
+			writeError(w, http.StatusConflict, ErrCodeReservationExpired, "Reservation has expired; please check out again")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to extend reservation")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"data": map[string]interface{}{
+			"rental_id":       rental.ID,
+			"hold_expires_at": time.Now().Add(h.allocationManager.HoldTimeout()),
+		},
+	})
+}
+
+// errRentalChanged aborts a rental update when the latest copy no longer allows the transition
+var errRentalChanged = errors.New("rental changed while it was being updated")
+
+// CancelRental lets a customer abandon a rental that is still awaiting payment: the checkout
+// session is expired, the hold released and the payment marked failed. Paid rentals are cancelled by staff (AdminCancelRental).
+func (h *RentalsHandler) CancelRental(w http.ResponseWriter, r *http.Request) {
+	h.cancelRental(w, r, false)
+}
+
+// AdminCancelRental cancels any rental that hasn't been returned. Unpaid rentals are simply
+// released; paid rentals are refunded in full through PayMongo before the unit is released.
+func (h *RentalsHandler) AdminCancelRental(w http.ResponseWriter, r *http.Request) {
+	h.cancelRental(w, r, true)
+}
+
+// cancelRental implements CancelRental and AdminCancelRental; only the latter may refund
+func (h *RentalsHandler) cancelRental(w http.ResponseWriter, r *http.Request, allowRefund bool) {
+	rentalID := mux.Vars(r)["id"]
+
+	rental, err := h.repo.GetRentalByID(rentalID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, ErrCodeRentalNotFound, "Rental not found")
+		return
+	}
+
+	// Cancelling twice is a no-op so clients can safely retry
+	if rental.Status == models.RentalCancelled {
+		h.writeCancelledRental(w, rental, allowRefund)
+		return
+	}
+
+	if rental.Status == models.RentalReturned {
+		writeError(w, http.StatusConflict, ErrCodeInvalidRentalState, "Returned rentals cannot be cancelled")
+		return
+	}
+
+	switch rental.PaymentStatus {
+	case models.PaymentPending:
+	case models.PaymentFailed, models.PaymentCompleted:
+		if !allowRefund {
+			writeError(w, http.StatusConflict, ErrCodeInvalidRentalState, "Only rentals awaiting payment can be cancelled; contact support to cancel a paid rental")
+			return
+		}
+	default:
+		writeError(w, http.StatusConflict, ErrCodeInvalidRentalState, "Rental cannot be cancelled")
+		return
+	}
+
+	// Close the checkout session first so an abandoned rental can't be paid for afterwards
+	if rental.PaymentStatus == models.PaymentPending && rental.PaymentID != "" {
+		if err := h.paymentService.ExpireCheckoutSession(rental.PaymentID); err != nil {
+			writeError(w, http.StatusBadGateway, ErrCodePaymentError, "Failed to close checkout session: "+err.Error())
+			return
+		}
+	}
+
+	// Refund before touching the rental or inventory so a failed refund leaves both intact.
+	// The refund stays outside the update below: a version conflict retries the save, not the refund.
+	var refundID string
+	if rental.PaymentStatus == models.PaymentCompleted {
+		paymentID, err := h.paymentService.GetSessionPaymentID(rental.PaymentID)
+		if err != nil {
+			writeError(w, http.StatusBadGateway, ErrCodePaymentError, "Failed to look up payment: "+err.Error())
+			return
+		}
+		// Refund everything the customer paid, VAT, damage waiver and deposit included
+		refundID, err = h.paymentService.CreateRefund(paymentID, services.ToCentavos(rental.AmountCharged()), "requested_by_customer")
+		if err != nil {
+			writeError(w, http.StatusBadGateway, ErrCodePaymentError, "Failed to refund payment: "+err.Error())
+			return
+		}
+	}
+
+	// A failed payment already gave its unit back; releasing again could free another rental's unit
+	var holdsUnit bool
+	rental, err = data.UpdateRentalWithRetry(h.repo, rentalID, func(rental *models.Rental) error {
+		if rental.Status != models.RentalActive {
+			return errRentalChanged
+		}
+		switch rental.PaymentStatus {
+		case models.PaymentPending:
+			rental.PaymentStatus = models.PaymentFailed
+			holdsUnit = true
+		case models.PaymentFailed:
+			if !allowRefund {
+				return errRentalChanged
+			}
+			holdsUnit = false
+		case models.PaymentCompleted:
+			// Paid after we read it, so there is no refund to record yet
+			if refundID == "" || rental.RefundID != "" {
+				return errRentalChanged
+			}
+			rental.RefundID = refundID
+			rental.PaymentStatus = models.PaymentRefunded
+			holdsUnit = true
+		default:
+			return errRentalChanged
+		}
+
+		now := time.Now()
+		rental.Status = models.RentalCancelled
+		rental.CancelledAt = &now
+		rental.UpdatedAt = now
+		return nil
+	})
+	if err != nil {
+		if refundID != "" {
+			log.Printf("[Rental] Warning: Refund %s issued for rental %s but not recorded: %v", refundID, rentalID, err)
+		}
+		if errors.Is(err, errRentalChanged) {
+			writeError(w, http.StatusConflict, ErrCodeInvalidRentalState, "Rental changed while cancelling; please try again")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to update rental")
+		return
+	}
+
+	// The unit may already be back in inventory (e.g. expired reservation); that's fine
+	if holdsUnit {
+		if err := h.allocationManager.ReleaseByRentalID(rental.ID); err != nil {
+			log.Printf("[Rental] Unit for rental %s was already released: %v", rental.ID, err)
+		}
+	}
+
+	log.Printf("[Rental] Rental %s cancelled (Payment status: %s)", rental.ID, rental.PaymentStatus)
+
+	if rental.PaymentStatus == models.PaymentRefunded {
+		if err := h.notifier.SendRefundNotice(rental); err != nil {
+			log.Printf("[Rental] Warning: Failed to send refund notice for rental %s: %v", rental.ID, err)
+		}
+	}
+
+	h.writeCancelledRental(w, rental, allowRefund)
+}
+
+// writeCancelledRental answers a cancellation. Staff get the full rental; customers get the
+// same details GetRental shows them.
+func (h *RentalsHandler) writeCancelledRental(w http.ResponseWriter, rental *models.Rental, admin bool) {
+	var response interface{} = h.rentalDetails(rental)
+	if admin {
+		response = rental
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -251,3 +607,114 @@ func (h *RentalsHandler) Checkout(w http.ResponseWriter, r *http.Request) {
 		"data":    response,
 	})
 }
+
+// ReturnRental checks a rented unit back into its warehouse and marks the rental as returned.
+// Check-in is a warehouse action, so this is an admin route. Any late fee is kept out of
+// the deposit and the rest of the deposit is refunded.
+func (h *RentalsHandler) ReturnRental(w http.ResponseWriter, r *http.Request) {
+	rentalID := mux.Vars(r)["id"]
+
+	rental, err := h.repo.GetRentalByID(rentalID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, ErrCodeRentalNotFound, "Rental not found")
+		return
+	}
+
+	// Returning twice is a no-op so clients can safely retry
+	if rental.Status == models.RentalReturned {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"data":    rental,
+		})
+		return
+	}
+
+	if rental.PaymentStatus != models.PaymentCompleted {
+		writeError(w, http.StatusConflict, ErrCodeInvalidRentalState, "Only paid rentals can be returned")
+		return
+	}
+
+	now := time.Now()
+
+	// Charge an overage for days kept past the rental duration, counted from delivery
+	var lateFee float64
+	if daysLate := h.pricingService.DaysLate(rental.StartsAt(), rental.Duration, now); daysLate > 0 {
+		if collectible, err := h.repo.GetCollectibleByID(rental.CollectibleID); err == nil {
+			lateFee = h.pricingService.CalculateLateFee(collectible.Size, daysLate)
+			log.Printf("[Rental] Rental %s returned %d day(s) late (Late fee: %.2f)", rental.ID, daysLate, lateFee)
+		} else {
+			log.Printf("[Rental] Could not compute late fee for rental %s: %v", rental.ID, err)
+		}
+	}
+
+	// The late fee is collected from the deposit; only what's left goes back to the customer
+	depositRefund := max(rental.Deposit-lateFee, 0)
+
+	// Refund the deposit before touching inventory so a failed refund can be retried by returning again.
+	// The refund stays outside the update below: a version conflict retries the save, not the refund.
+	var depositRefundID string
+	if depositRefund > 0 && rental.DepositRefundID == "" {
+		paymentID, err := h.paymentService.GetSessionPaymentID(rental.PaymentID)
+		if err != nil {
+			writeError(w, http.StatusBadGateway, ErrCodePaymentError, "Failed to look up payment: "+err.Error())
+			return
+		}
+		depositRefundID, err = h.paymentService.CreateRefund(paymentID, services.ToCentavos(depositRefund), "others")
+		if err != nil {
+			writeError(w, http.StatusBadGateway, ErrCodePaymentError, "Failed to refund deposit: "+err.Error())
+			return
+		}
+		log.Printf("[Rental] Refunded %.2f of the %.2f deposit for rental %s (Refund ID: %s)", depositRefund, rental.Deposit, rental.ID, depositRefundID)
+	}
+
+	rental, err = data.UpdateRentalWithRetry(h.repo, rentalID, func(rental *models.Rental) error {
+		if rental.Status != models.RentalActive || rental.PaymentStatus != models.PaymentCompleted {
+			return errRentalChanged
+		}
+		if depositRefundID != "" {
+			if rental.DepositRefundID != "" {
+				return errRentalChanged
+			}
+			rental.DepositRefundID = depositRefundID
+		}
+		rental.LateFee = lateFee
+		rental.Status = models.RentalReturned
+		rental.ReturnedAt = &now
+		rental.UpdatedAt = now
+		return nil
+	})
+	if err != nil {
+		if depositRefundID != "" {
+			log.Printf("[Rental] Warning: Deposit refund %s issued for rental %s but not recorded: %v", depositRefundID, rentalID, err)
+		}
+		if errors.Is(err, errRentalChanged) {
+			writeError(w, http.StatusConflict, ErrCodeInvalidRentalState, "Rental changed while returning; please try again")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to update rental")
+		return
+	}
+
+	// The unit may already be back in inventory (e.g. manual release); that's fine
+	if err := h.allocationManager.ReleaseByRentalID(rental.ID); err != nil {
+		log.Printf("[Rental] Unit for rental %s was already released: %v", rental.ID, err)
+	}
+
+	log.Printf("[Rental] Rental %s returned to Warehouse %s", rental.ID, rental.WarehouseID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"data":    rental,
+	})
+}
+
+// checkoutPaymentMethods returns the PayMongo payment methods offered for a collectible.
+// High-value (large) items are card-only; everything else gets the default list.
+func checkoutPaymentMethods(collectible *models.Collectible) []string {
+	if collectible.Size == models.SizeLarge {
+		return []string{"card"}
+	}
+	return nil
+}
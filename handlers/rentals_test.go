@@ -0,0 +1,1125 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mongocollectibles/rental-system/config"
+	"github.com/mongocollectibles/rental-system/data"
+	"github.com/mongocollectibles/rental-system/models"
+	"github.com/mongocollectibles/rental-system/services"
+)
+
+// newTestRentalsHandler builds a handler backed by an in-memory repo with one
+// small collectible stocked in two warehouses.
+func newTestRentalsHandler(t *testing.T) (*RentalsHandler, data.Repository, *services.AllocationManager) {
+	t.Helper()
+
+	repo := data.NewRepository()
+	repo.AddCollectible(&models.Collectible{
+		ID:        "col-001",
+		Name:      "Vintage Batman Action Figure",
+		Size:      models.SizeSmall,
+		Available: true,
+	})
+
+	warehouses := []models.WarehouseNode{
+		{ID: "wh-1", Distances: map[string]int{"store-a": 3, "store-b": 7}},
+		{ID: "wh-2", Distances: map[string]int{"store-a": 5, "store-b": 2}},
+	}
+	units := []*models.CollectibleUnit{
+		{ID: "wh-1", CollectibleID: "col-001", WarehouseID: "wh-1", IsAvailable: true},
+		{ID: "wh-2", CollectibleID: "col-001", WarehouseID: "wh-2", IsAvailable: true},
+	}
+	am := services.NewAllocationManager(units, warehouses)
+
+	cfg := &config.Config{
+		Stores: []models.Store{
+			{ID: "store-a", Name: "Store A"},
+			{ID: "store-b", Name: "Store B"},
+		},
+	}
+
+	h := NewRentalsHandler(repo, services.NewPricingService(), am, services.NewPaymentService("", ""), cfg)
+	return h, repo, am
+}
+
+// decodeData unmarshals the "data" field of a success envelope into v
+func decodeData(t *testing.T, rec *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+
+	var envelope struct {
+		Success bool            `json:"success"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&envelope); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !envelope.Success {
+		t.Fatalf("Expected success response, got status %d", rec.Code)
+	}
+	if err := json.Unmarshal(envelope.Data, v); err != nil {
+		t.Fatalf("Failed to decode data: %v", err)
+	}
+}
+
+// assertErrorCode checks that a failed response carries the expected error_code
+func assertErrorCode(t *testing.T, rec *httptest.ResponseRecorder, want string) {
+	t.Helper()
+
+	var apiErr APIError
+	if err := json.NewDecoder(rec.Body).Decode(&apiErr); err != nil {
+		t.Fatalf("Failed to decode error response: %v", err)
+	}
+	if apiErr.Success || apiErr.Code != want {
+		t.Errorf("Expected error_code %s, got %+v", want, apiErr)
+	}
+}
+
+func TestRentalsHandler_GetQuote(t *testing.T) {
+	h, _, _ := newTestRentalsHandler(t)
+
+	t.Run("Valid store returns ETA and stock", func(t *testing.T) {
+		body, _ := json.Marshal(models.RentalQuoteRequest{
+			CollectibleID: "col-001",
+			StoreID:       "store-b",
+			Duration:      7,
+		})
+		req := httptest.NewRequest(http.MethodPost, "/api/rentals/quote", bytes.NewReader(body))
+		rec := httptest.NewRecorder()
+
+		h.GetQuote(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", rec.Code)
+		}
+		var quote models.RentalQuoteResponse
+		decodeData(t, rec, &quote)
+
+		// wh-2 is nearest to store-b: 2 km is one handling day plus one day in transit
+		if quote.ETA != 2 {
+			t.Errorf("Expected ETA 2, got %d", quote.ETA)
+		}
+		if quote.Stock != 2 {
+			t.Errorf("Expected stock 2, got %d", quote.Stock)
+		}
+	})
+
+	t.Run("Lists warehouse options nearest first", func(t *testing.T) {
+		h, _, am := newTestRentalsHandler(t)
+		getOptions := func() []models.WarehouseOption {
+			body, _ := json.Marshal(models.RentalQuoteRequest{CollectibleID: "col-001", StoreID: "store-b", Duration: 7})
+			req := httptest.NewRequest(http.MethodPost, "/api/rentals/quote", bytes.NewReader(body))
+			rec := httptest.NewRecorder()
+			h.GetQuote(rec, req)
+			var quote models.RentalQuoteResponse
+			decodeData(t, rec, &quote)
+			return quote.WarehouseOptions
+		}
+
+		options := getOptions()
+		if len(options) != 2 || options[0].WarehouseID != "wh-2" || options[1].WarehouseID != "wh-1" {
+			t.Fatalf("Expected wh-2 then wh-1, got %+v", options)
+		}
+		if options[1].Distance != 7 || options[1].ETADays != 2 {
+			t.Errorf("Expected wh-1 at 7 km and 2 days, got %+v", options[1])
+		}
+
+		// With wh-2's unit reserved, wh-1 is the only option left
+		if _, _, err := am.Allocate("col-001", "store-b", "rental-1"); err != nil {
+			t.Fatalf("Allocate failed: %v", err)
+		}
+		if options := getOptions(); len(options) != 1 || options[0].WarehouseID != "wh-1" {
+			t.Errorf("Expected only wh-1, got %+v", options)
+		}
+	})
+
+	t.Run("Non-positive duration is rejected", func(t *testing.T) {
+		body, _ := json.Marshal(models.RentalQuoteRequest{CollectibleID: "col-001", StoreID: "store-a", Duration: 0})
+		req := httptest.NewRequest(http.MethodPost, "/api/rentals/quote", bytes.NewReader(body))
+		rec := httptest.NewRecorder()
+
+		h.GetQuote(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400, got %d", rec.Code)
+		}
+		assertErrorCode(t, rec, ErrCodeInvalidDuration)
+	})
+
+	t.Run("Unknown store is rejected", func(t *testing.T) {
+		body, _ := json.Marshal(models.RentalQuoteRequest{CollectibleID: "col-001", StoreID: "store-z", Duration: 7})
+		req := httptest.NewRequest(http.MethodPost, "/api/rentals/quote", bytes.NewReader(body))
+		rec := httptest.NewRecorder()
+
+		h.GetQuote(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400, got %d", rec.Code)
+		}
+		if !bytes.Contains(rec.Body.Bytes(), []byte("store-a, store-b")) {
+			t.Errorf("Expected valid store IDs in error, got %s", rec.Body.String())
+		}
+		assertErrorCode(t, rec, ErrCodeUnknownStore)
+	})
+
+	t.Run("Unknown collectible returns 404", func(t *testing.T) {
+		body, _ := json.Marshal(models.RentalQuoteRequest{CollectibleID: "missing", StoreID: "store-a", Duration: 7})
+		req := httptest.NewRequest(http.MethodPost, "/api/rentals/quote", bytes.NewReader(body))
+		rec := httptest.NewRecorder()
+
+		h.GetQuote(rec, req)
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("Expected 404, got %d", rec.Code)
+		}
+		assertErrorCode(t, rec, ErrCodeCollectibleNotFound)
+	})
+}
+
+func TestRentalsHandler_ReturnRental(t *testing.T) {
+	h, repo, am := newTestRentalsHandler(t)
+
+	unit, eta, err := am.Allocate("col-001", "store-a", "rental-1")
+	if err != nil {
+		t.Fatalf("Allocate failed: %v", err)
+	}
+	repo.CreateRental(&models.Rental{
+		ID:            "rental-1",
+		CollectibleID: "col-001",
+		StoreID:       "store-a",
+		WarehouseID:   unit.WarehouseID,
+		Duration:      7,
+		PaymentStatus: models.PaymentCompleted,
+		ETA:           eta,
+		Status:        models.RentalActive,
+		CreatedAt:     time.Now(),
+	})
+
+	doReturn := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/rentals/rental-1/return", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "rental-1"})
+		rec := httptest.NewRecorder()
+		h.ReturnRental(rec, req)
+		return rec
+	}
+
+	rec := doReturn()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	var returned models.Rental
+	decodeData(t, rec, &returned)
+	if returned.Status != models.RentalReturned || returned.ReturnedAt == nil {
+		t.Errorf("Expected returned status with timestamp, got %+v", returned)
+	}
+	if stock := am.GetTotalStock("col-001"); stock != 2 {
+		t.Errorf("Expected unit back in stock (2), got %d", stock)
+	}
+
+	// Second return is idempotent
+	if rec := doReturn(); rec.Code != http.StatusOK {
+		t.Errorf("Expected idempotent 200 on repeated return, got %d", rec.Code)
+	}
+}
+
+func TestRentalsHandler_ReturnRefundsDeposit(t *testing.T) {
+	var refunds []services.PayMongoRefundRequest
+	paymongo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/checkout_sessions/cs_1":
+			w.Write([]byte(`{"data":{"id":"cs_1","attributes":{"status":"paid","payments":[{"id":"pay_1"}]}}}`))
+		case "/refunds":
+			var refund services.PayMongoRefundRequest
+			json.NewDecoder(r.Body).Decode(&refund)
+			refunds = append(refunds, refund)
+			w.Write([]byte(`{"data":{"id":"ref_dep","attributes":{"status":"pending"}}}`))
+		default:
+			t.Errorf("Unexpected PayMongo call %s", r.URL.Path)
+		}
+	}))
+	defer paymongo.Close()
+
+	h, repo, am := newTestRentalsHandler(t)
+	h.paymentService = services.NewPaymentServiceWithBaseURL("sk_test", "pk_test", paymongo.URL)
+	unit, _, _ := am.Allocate("col-001", "store-a", "rental-1")
+	repo.CreateRental(&models.Rental{
+		ID:            "rental-1",
+		CollectibleID: "col-001",
+		WarehouseID:   unit.WarehouseID,
+		Duration:      7,
+		TotalFee:      70000,
+		Deposit:       5000,
+		PaymentID:     "cs_1",
+		PaymentStatus: models.PaymentCompleted,
+		Status:        models.RentalActive,
+		CreatedAt:     time.Now(),
+	})
+
+	// A concurrent writer forces the save to retry; the refund must not be retried with it
+	h.repo = &conflictOnceRepo{Repository: repo}
+
+	doReturn := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/rentals/rental-1/return", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "rental-1"})
+		rec := httptest.NewRecorder()
+		h.ReturnRental(rec, req)
+		return rec
+	}
+
+	rec := doReturn()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	var returned models.Rental
+	decodeData(t, rec, &returned)
+	if returned.DepositRefundID != "ref_dep" || returned.PaymentStatus != models.PaymentCompleted {
+		t.Errorf("Expected deposit refund recorded on a still-paid rental, got %+v", returned)
+	}
+	if len(refunds) != 1 || refunds[0].Data.Attributes.PaymentID != "pay_1" || refunds[0].Data.Attributes.Amount != 500000 {
+		t.Fatalf("Expected a single 500000 centavo deposit refund, got %+v", refunds)
+	}
+
+	// Repeated returns must not refund the deposit twice
+	doReturn()
+	if len(refunds) != 1 {
+		t.Errorf("Expected deposit to be refunded once, got %d refunds", len(refunds))
+	}
+}
+
+func TestRentalsHandler_ReturnKeepsLateFeeFromDeposit(t *testing.T) {
+	tests := []struct {
+		name       string
+		daysLate   int
+		wantFee    float64
+		wantRefund int // centavos; 0 means no refund
+	}{
+		{"On time gets the whole deposit back", 0, 0, 500000},
+		{"One day late keeps the late fee", 1, 2000, 300000},
+		{"Late fee above the deposit refunds nothing", 3, 6000, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var refunds []services.PayMongoRefundRequest
+			paymongo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/checkout_sessions/cs_1":
+					w.Write([]byte(`{"data":{"id":"cs_1","attributes":{"status":"paid","payments":[{"id":"pay_1"}]}}}`))
+				case "/refunds":
+					var refund services.PayMongoRefundRequest
+					json.NewDecoder(r.Body).Decode(&refund)
+					refunds = append(refunds, refund)
+					w.Write([]byte(`{"data":{"id":"ref_dep","attributes":{"status":"pending"}}}`))
+				default:
+					t.Errorf("Unexpected PayMongo call %s", r.URL.Path)
+				}
+			}))
+			defer paymongo.Close()
+
+			h, repo, am := newTestRentalsHandler(t)
+			h.paymentService = services.NewPaymentServiceWithBaseURL("sk_test", "pk_test", paymongo.URL)
+			unit, _, _ := am.Allocate("col-001", "store-a", "rental-1")
+			// Due an hour from now, plus however many days late
+			repo.CreateRental(&models.Rental{
+				ID:            "rental-1",
+				CollectibleID: "col-001",
+				WarehouseID:   unit.WarehouseID,
+				Duration:      7,
+				Deposit:       5000,
+				PaymentID:     "cs_1",
+				PaymentStatus: models.PaymentCompleted,
+				Status:        models.RentalActive,
+				CreatedAt:     time.Now().AddDate(0, 0, -7-tt.daysLate).Add(time.Hour),
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/admin/rentals/rental-1/return", nil)
+			req = mux.SetURLVars(req, map[string]string{"id": "rental-1"})
+			rec := httptest.NewRecorder()
+			h.ReturnRental(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected 200, got %d", rec.Code)
+			}
+			var returned models.Rental
+			decodeData(t, rec, &returned)
+			if returned.LateFee != tt.wantFee {
+				t.Errorf("Expected late fee %.2f, got %.2f", tt.wantFee, returned.LateFee)
+			}
+
+			if tt.wantRefund == 0 {
+				if len(refunds) != 0 || returned.DepositRefundID != "" {
+					t.Errorf("Expected no deposit refund, got %+v", refunds)
+				}
+				return
+			}
+			if len(refunds) != 1 || refunds[0].Data.Attributes.Amount != tt.wantRefund {
+				t.Errorf("Expected a single %d centavo refund, got %+v", tt.wantRefund, refunds)
+			}
+		})
+	}
+}
+
+func TestRentalsHandler_ReturnLateFeeCountsFromDelivery(t *testing.T) {
+	now := time.Now()
+	paidAt := now.AddDate(0, 0, -9)
+
+	tests := []struct {
+		name      string
+		createdAt time.Time
+		paidAt    *time.Time
+		wantFee   float64
+	}{
+		// 7 days rented after a 3 day delivery is due tomorrow
+		{"Delivery days are not late", now.AddDate(0, 0, -9), nil, 0},
+		{"Time awaiting payment is not late", now.AddDate(0, 0, -20), &paidAt, 0},
+		{"Late days count from delivery", now.AddDate(0, 0, -12).Add(time.Hour), nil, 4000}, // 2 days late
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, repo, am := newTestRentalsHandler(t)
+			unit, _, _ := am.Allocate("col-001", "store-a", "rental-1")
+			repo.CreateRental(&models.Rental{
+				ID:            "rental-1",
+				CollectibleID: "col-001",
+				WarehouseID:   unit.WarehouseID,
+				Duration:      7,
+				ETA:           3,
+				PaymentStatus: models.PaymentCompleted,
+				PaidAt:        tt.paidAt,
+				Status:        models.RentalActive,
+				CreatedAt:     tt.createdAt,
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/admin/rentals/rental-1/return", nil)
+			req = mux.SetURLVars(req, map[string]string{"id": "rental-1"})
+			rec := httptest.NewRecorder()
+			h.ReturnRental(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected 200, got %d", rec.Code)
+			}
+			var returned models.Rental
+			decodeData(t, rec, &returned)
+			if returned.LateFee != tt.wantFee {
+				t.Errorf("Expected late fee %.2f, got %.2f", tt.wantFee, returned.LateFee)
+			}
+		})
+	}
+}
+
+func TestRentalsHandler_CheckoutShortage(t *testing.T) {
+	checkout := func(h *RentalsHandler, storeID string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(models.CheckoutRequest{
+			CollectibleID: "col-001",
+			StoreID:       storeID,
+			Duration:      7,
+			PaymentMethod: models.PaymentCard,
+			Customer:      models.Customer{Name: "Juan Dela Cruz", Email: "juan@example.com"},
+		})
+		req := httptest.NewRequest(http.MethodPost, "/api/rentals/checkout", bytes.NewReader(body))
+		rec := httptest.NewRecorder()
+		h.Checkout(rec, req)
+		return rec
+	}
+
+	t.Run("Store no warehouse ships to", func(t *testing.T) {
+		h, _, am := newTestRentalsHandler(t)
+		// store-c is a real store, but neither warehouse has a distance to it
+		h.config.Stores = append(h.config.Stores, models.Store{ID: "store-c", Name: "Store C"})
+
+		rec := checkout(h, "store-c")
+		if rec.Code != http.StatusConflict {
+			t.Fatalf("Expected 409, got %d", rec.Code)
+		}
+		assertErrorCode(t, rec, ErrCodeStoreNotServed)
+		if stock := am.GetTotalStock("col-001"); stock != 2 {
+			t.Errorf("Expected stock untouched at 2, got %d", stock)
+		}
+	})
+
+	t.Run("No units left anywhere", func(t *testing.T) {
+		h, _, am := newTestRentalsHandler(t)
+		if _, _, err := am.AllocateN("col-001", "store-a", "rental-other", 2); err != nil {
+			t.Fatalf("AllocateN failed: %v", err)
+		}
+
+		rec := checkout(h, "store-a")
+		if rec.Code != http.StatusConflict {
+			t.Fatalf("Expected 409, got %d", rec.Code)
+		}
+		assertErrorCode(t, rec, ErrCodeNoStock)
+	})
+}
+
+func TestRentalsHandler_CheckoutIdempotencyKey(t *testing.T) {
+	h, repo, am := newTestRentalsHandler(t)
+
+	body, _ := json.Marshal(models.CheckoutRequest{
+		CollectibleID: "col-001",
+		StoreID:       "store-a",
+		Duration:      7,
+		PaymentMethod: models.PaymentCard,
+		Customer:      models.Customer{Name: "Juan Dela Cruz", Email: "juan@example.com"},
+	})
+	doCheckout := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/rentals/checkout", bytes.NewReader(body))
+		req.Header.Set("Idempotency-Key", key)
+		rec := httptest.NewRecorder()
+		h.Checkout(rec, req)
+		return rec
+	}
+
+	t.Run("Duration above the cap is rejected before allocating", func(t *testing.T) {
+		tooLong, _ := json.Marshal(models.CheckoutRequest{
+			CollectibleID: "col-001",
+			StoreID:       "store-a",
+			Duration:      services.DefaultMaxRentalDays + 1,
+			Customer:      models.Customer{Name: "Juan Dela Cruz", Email: "juan@example.com"},
+		})
+		req := httptest.NewRequest(http.MethodPost, "/api/rentals/checkout", bytes.NewReader(tooLong))
+		rec := httptest.NewRecorder()
+		h.Checkout(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("Expected 400, got %d", rec.Code)
+		}
+		assertErrorCode(t, rec, ErrCodeInvalidDuration)
+		if stock := am.GetTotalStock("col-001"); stock != 2 {
+			t.Errorf("Rejected checkout must not allocate; expected stock 2, got %d", stock)
+		}
+	})
+
+	t.Run("Repeated key replays the original rental", func(t *testing.T) {
+		repo.CreateRental(&models.Rental{
+			ID:            "rental-1",
+			CollectibleID: "col-001",
+			TotalFee:      7000,
+			ETA:           3,
+			PaymentURL:    "https://checkout.example/rental-1",
+			PaymentStatus: models.PaymentPending,
+		})
+		repo.SaveIdempotencyKey("key-done", "rental-1")
+
+		rec := doCheckout("key-done")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", rec.Code)
+		}
+		var resp models.CheckoutResponse
+		decodeData(t, rec, &resp)
+		if resp.RentalID != "rental-1" || resp.PaymentURL != "https://checkout.example/rental-1" {
+			t.Errorf("Expected replay of rental-1, got %+v", resp)
+		}
+		if stock := am.GetTotalStock("col-001"); stock != 2 {
+			t.Errorf("Replay must not allocate; expected stock 2, got %d", stock)
+		}
+	})
+
+	t.Run("Concurrent duplicate is rejected while the first is in flight", func(t *testing.T) {
+		// Simulate the first request having claimed the key but not yet saved its rental
+		repo.SaveIdempotencyKey("key-inflight", "rental-pending")
+
+		rec := doCheckout("key-inflight")
+		if rec.Code != http.StatusConflict {
+			t.Fatalf("Expected 409, got %d", rec.Code)
+		}
+		assertErrorCode(t, rec, ErrCodeIdempotencyConflict)
+		if stock := am.GetTotalStock("col-001"); stock != 2 {
+			t.Errorf("Duplicate must not allocate; expected stock 2, got %d", stock)
+		}
+	})
+}
+
+func TestRentalsHandler_CheckoutDoesNotLeakHolds(t *testing.T) {
+	body, _ := json.Marshal(models.CheckoutRequest{
+		CollectibleID: "col-001",
+		StoreID:       "store-a",
+		Duration:      7,
+		PaymentMethod: models.PaymentCard,
+		Customer:      models.Customer{Name: "Juan Dela Cruz", Email: "juan@example.com"},
+	})
+	doCheckout := func(h *RentalsHandler) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/rentals/checkout", bytes.NewReader(body))
+		req.Header.Set("Idempotency-Key", "key-1")
+		rec := httptest.NewRecorder()
+		h.Checkout(rec, req)
+		return rec
+	}
+
+	t.Run("Failed payment session releases the unit", func(t *testing.T) {
+		paymongo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"errors":[{"detail":"invalid amount"}]}`))
+		}))
+		defer paymongo.Close()
+
+		h, _, am := newTestRentalsHandler(t)
+		h.paymentService = services.NewPaymentServiceWithBaseURL("sk_test", "pk_test", paymongo.URL)
+
+		if rec := doCheckout(h); rec.Code != http.StatusInternalServerError {
+			t.Fatalf("Expected 500, got %d", rec.Code)
+		}
+		if stock := am.GetTotalStock("col-001"); stock != 2 {
+			t.Errorf("Expected the hold to be released (stock 2), got %d", stock)
+		}
+		// The key was released too, so a retry fails the same way without piling up holds
+		doCheckout(h)
+		if stock := am.GetTotalStock("col-001"); stock != 2 {
+			t.Errorf("Expected retries not to accumulate holds (stock 2), got %d", stock)
+		}
+	})
+
+	t.Run("Resuming a pending rental allocates nothing", func(t *testing.T) {
+		h, repo, am := newTestRentalsHandler(t)
+		repo.CreateRental(&models.Rental{
+			ID:            "rental-1",
+			CollectibleID: "col-001",
+			Customer:      models.Customer{Email: "juan@example.com"},
+			PaymentURL:    "https://checkout.example/rental-1",
+			PaymentStatus: models.PaymentPending,
+		})
+
+		rec := doCheckout(h)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", rec.Code)
+		}
+		var resp models.CheckoutResponse
+		decodeData(t, rec, &resp)
+		if resp.RentalID != "rental-1" {
+			t.Errorf("Expected pending rental-1 to be resumed, got %+v", resp)
+		}
+		if stock := am.GetTotalStock("col-001"); stock != 2 {
+			t.Errorf("Expected stock untouched at 2, got %d", stock)
+		}
+	})
+}
+
+// takenIDRepo saves a competing rental under each new rental's ID just before the real write
+type takenIDRepo struct {
+	data.Repository
+}
+
+func (r *takenIDRepo) CreateRental(rental *models.Rental) error {
+	r.Repository.CreateRental(&models.Rental{ID: rental.ID})
+	return r.Repository.CreateRental(rental)
+}
+
+func TestRentalsHandler_CheckoutExistingRental(t *testing.T) {
+	paymongo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":{"id":"cs_2","attributes":{"checkout_url":"https://checkout.example/cs_2","status":"active"}}}`))
+	}))
+	defer paymongo.Close()
+
+	h, repo, am := newTestRentalsHandler(t)
+	h.repo = &takenIDRepo{Repository: repo}
+	h.paymentService = services.NewPaymentServiceWithBaseURL("sk_test", "pk_test", paymongo.URL)
+
+	body, _ := json.Marshal(models.CheckoutRequest{
+		CollectibleID: "col-001",
+		StoreID:       "store-a",
+		Duration:      7,
+		PaymentMethod: models.PaymentCard,
+		Customer:      models.Customer{Name: "Juan Dela Cruz", Email: "juan@example.com"},
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/rentals/checkout", bytes.NewReader(body))
+	req.Header.Set("Idempotency-Key", "key-1")
+	rec := httptest.NewRecorder()
+	h.Checkout(rec, req)
+
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("Expected 409, got %d: %s", rec.Code, rec.Body.String())
+	}
+	assertErrorCode(t, rec, ErrCodeIdempotencyConflict)
+	if stock := am.GetTotalStock("col-001"); stock != 2 {
+		t.Errorf("Expected the attempt's unit to be released (stock 2), got %d", stock)
+	}
+	// The key is released too, so the client can retry with it
+	if _, err := repo.GetRentalIDByIdempotencyKey("key-1"); err == nil {
+		t.Error("Expected the Idempotency-Key to be released")
+	}
+}
+
+func TestRentalsHandler_CheckoutRedirectURLs(t *testing.T) {
+	checkout := func(t *testing.T, baseURL string, prepare func(*http.Request)) services.PayMongoSessionRequest {
+		t.Helper()
+
+		var session services.PayMongoSessionRequest
+		paymongo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&session)
+			w.Write([]byte(`{"data":{"id":"cs_1","attributes":{"checkout_url":"https://checkout.example/cs_1","status":"active"}}}`))
+		}))
+		defer paymongo.Close()
+
+		h, _, _ := newTestRentalsHandler(t)
+		h.paymentService = services.NewPaymentServiceWithBaseURL("sk_test", "pk_test", paymongo.URL)
+		h.config.BaseURL = baseURL
+
+		body, _ := json.Marshal(models.CheckoutRequest{
+			CollectibleID: "col-001",
+			StoreID:       "store-a",
+			Duration:      7,
+			PaymentMethod: models.PaymentCard,
+			Customer:      models.Customer{Name: "Juan Dela Cruz", Email: "juan@example.com"},
+		})
+		req := httptest.NewRequest(http.MethodPost, "/api/rentals/checkout", bytes.NewReader(body))
+		prepare(req)
+		rec := httptest.NewRecorder()
+		h.Checkout(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", rec.Code)
+		}
+		return session
+	}
+
+	tests := []struct {
+		name    string
+		baseURL string
+		prepare func(*http.Request)
+		want    string
+	}{
+		{"Configured URL wins", "https://rentals.example.com", func(r *http.Request) { r.Host = "internal:8080" }, "https://rentals.example.com/payment/"},
+		{"Falls back to the request host", "", func(r *http.Request) { r.Host = "shop.example.com" }, "http://shop.example.com/payment/"},
+		{"Honors a TLS-terminating proxy", "", func(r *http.Request) {
+			r.Host = "shop.example.com"
+			r.Header.Set("X-Forwarded-Proto", "https")
+		}, "https://shop.example.com/payment/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attrs := checkout(t, tt.baseURL, tt.prepare).Data.Attributes
+			if !strings.HasPrefix(attrs.SuccessUrl, tt.want+"success?rental_id=") || !strings.HasPrefix(attrs.CancelUrl, tt.want+"failed?rental_id=") {
+				t.Errorf("Expected redirects under %s, got %s and %s", tt.want, attrs.SuccessUrl, attrs.CancelUrl)
+			}
+		})
+	}
+}
+
+func TestRentalsHandler_CheckoutInsurance(t *testing.T) {
+	checkout := func(t *testing.T, optIn bool) (models.CheckoutResponse, services.PayMongoSessionRequest, data.Repository) {
+		t.Helper()
+
+		var session services.PayMongoSessionRequest
+		paymongo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&session)
+			w.Write([]byte(`{"data":{"id":"cs_1","attributes":{"checkout_url":"https://checkout.example/cs_1","status":"active"}}}`))
+		}))
+		defer paymongo.Close()
+
+		h, repo, _ := newTestRentalsHandler(t)
+		h.paymentService = services.NewPaymentServiceWithBaseURL("sk_test", "pk_test", paymongo.URL)
+
+		body, _ := json.Marshal(models.CheckoutRequest{
+			CollectibleID:  "col-001",
+			StoreID:        "store-a",
+			Duration:       7,
+			PaymentMethod:  models.PaymentCard,
+			Customer:       models.Customer{Name: "Juan Dela Cruz", Email: "juan@example.com"},
+			InsuranceOptIn: optIn,
+		})
+		req := httptest.NewRequest(http.MethodPost, "/api/rentals/checkout", bytes.NewReader(body))
+		rec := httptest.NewRecorder()
+		h.Checkout(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", rec.Code)
+		}
+		var resp models.CheckoutResponse
+		decodeData(t, rec, &resp)
+		return resp, session, repo
+	}
+
+	t.Run("Opted in", func(t *testing.T) {
+		resp, session, repo := checkout(t, true)
+
+		// 7,000 fee + 840 VAT + 700 waiver
+		if resp.InsuranceFee != 700 || resp.TotalDue != 8540 {
+			t.Errorf("Unexpected checkout totals: %+v", resp)
+		}
+		items := session.Data.Attributes.LineItems
+		if len(items) != 3 || items[2].Name != "Damage Waiver" || items[2].Amount != 70000 {
+			t.Errorf("Expected a damage waiver line item, got %+v", items)
+		}
+		if rental, err := repo.GetRentalByID(resp.RentalID); err != nil || rental.InsuranceFee != 700 {
+			t.Errorf("Expected waiver stored on the rental, got %+v (%v)", rental, err)
+		}
+	})
+
+	t.Run("Not opted in", func(t *testing.T) {
+		resp, session, _ := checkout(t, false)
+
+		if resp.InsuranceFee != 0 || resp.TotalDue != 7840 {
+			t.Errorf("Unexpected checkout totals: %+v", resp)
+		}
+		for _, item := range session.Data.Attributes.LineItems {
+			if item.Name == "Damage Waiver" {
+				t.Errorf("Unexpected damage waiver line item: %+v", item)
+			}
+		}
+	})
+}
+
+func TestRentalsHandler_GetRental(t *testing.T) {
+	h, repo, _ := newTestRentalsHandler(t)
+
+	repo.CreateRental(&models.Rental{
+		ID:              "rental-1",
+		CollectibleID:   "col-001",
+		CollectibleName: "Vintage Batman Action Figure",
+		StoreID:         "store-b",
+		TotalFee:        7000,
+		ETA:             2,
+		PaymentID:       "cs_secret",
+		PaymentStatus:   models.PaymentPending,
+		Status:          models.RentalActive,
+	})
+
+	getRental := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/rentals/"+id, nil)
+		req = mux.SetURLVars(req, map[string]string{"id": id})
+		rec := httptest.NewRecorder()
+		h.GetRental(rec, req)
+		return rec
+	}
+
+	rec := getRental("rental-1")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	if bytes.Contains(rec.Body.Bytes(), []byte("cs_secret")) {
+		t.Error("Response must not expose the payment session ID")
+	}
+	var details models.RentalDetailsResponse
+	decodeData(t, rec, &details)
+	if details.StoreName != "Store B" || details.ETA != 2 || details.PaymentStatus != models.PaymentPending {
+		t.Errorf("Unexpected rental details: %+v", details)
+	}
+
+	rec = getRental("missing")
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404, got %d", rec.Code)
+	}
+	assertErrorCode(t, rec, ErrCodeRentalNotFound)
+}
+
+func TestRentalsHandler_GetReceipt(t *testing.T) {
+	h, repo, _ := newTestRentalsHandler(t)
+	repo.CreateRental(&models.Rental{
+		ID: "rental-1", CollectibleID: "col-001", Duration: 10,
+		DailyRate: 1000, TotalFee: 10000, TaxAmount: 1200, Deposit: 1500, LateFee: 2000,
+	})
+
+	getReceipt := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/rentals/"+id+"/receipt", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": id})
+		rec := httptest.NewRecorder()
+		h.GetReceipt(rec, req)
+		return rec
+	}
+
+	rec := getReceipt("rental-1")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	var receipt models.Receipt
+	decodeData(t, rec, &receipt)
+	if receipt.Subtotal != 10000 || receipt.TaxAmount != 1200 || receipt.Deposit != 1500 || receipt.LateFee != 2000 || receipt.GrandTotal != 14700 {
+		t.Errorf("Unexpected receipt totals: %+v", receipt)
+	}
+	if receipt.GrandTotalDisplay != "PHP 14,700.00" {
+		t.Errorf("Unexpected display total %q", receipt.GrandTotalDisplay)
+	}
+
+	rec = getReceipt("missing")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown rental, got %d", rec.Code)
+	}
+	assertErrorCode(t, rec, ErrCodeRentalNotFound)
+}
+
+func TestRentalsHandler_ExtendHold(t *testing.T) {
+	doExtend := func(h *RentalsHandler, id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/rentals/"+id+"/extend-hold", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": id})
+		rec := httptest.NewRecorder()
+		h.ExtendHold(rec, req)
+		return rec
+	}
+
+	newPendingRental := func(t *testing.T) (*RentalsHandler, data.Repository, *models.CollectibleUnit) {
+		h, repo, am := newTestRentalsHandler(t)
+		unit, _, err := am.Allocate("col-001", "store-a", "rental-1")
+		if err != nil {
+			t.Fatalf("Allocate failed: %v", err)
+		}
+		repo.CreateRental(&models.Rental{
+			ID:            "rental-1",
+			CollectibleID: "col-001",
+			WarehouseID:   unit.WarehouseID,
+			PaymentStatus: models.PaymentPending,
+			Status:        models.RentalActive,
+		})
+		return h, repo, unit
+	}
+
+	t.Run("Pending rental gets a fresh hold", func(t *testing.T) {
+		h, _, unit := newPendingRental(t)
+		reservedAt := time.Now().Add(-10 * time.Minute)
+		unit.ReservedAt = &reservedAt
+
+		rec := doExtend(h, "rental-1")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var resp struct {
+			RentalID      string    `json:"rental_id"`
+			HoldExpiresAt time.Time `json:"hold_expires_at"`
+		}
+		decodeData(t, rec, &resp)
+		if resp.RentalID != "rental-1" || time.Until(resp.HoldExpiresAt) < 14*time.Minute {
+			t.Errorf("Expected a full reservation timeout ahead, got %+v", resp)
+		}
+		if time.Since(*unit.ReservedAt) > time.Minute {
+			t.Errorf("Expected unit hold to be re-stamped, got %v", unit.ReservedAt)
+		}
+	})
+
+	t.Run("Expired hold is rejected", func(t *testing.T) {
+		h, _, unit := newPendingRental(t)
+		reservedAt := time.Now().Add(-time.Hour)
+		unit.ReservedAt = &reservedAt
+
+		rec := doExtend(h, "rental-1")
+		if rec.Code != http.StatusConflict {
+			t.Fatalf("Expected 409, got %d", rec.Code)
+		}
+		assertErrorCode(t, rec, ErrCodeReservationExpired)
+	})
+
+	t.Run("Paid rental is rejected", func(t *testing.T) {
+		h, repo, _ := newPendingRental(t)
+		rental, _ := repo.GetRentalByID("rental-1")
+		rental.PaymentStatus = models.PaymentCompleted
+		repo.UpdateRental(rental)
+
+		rec := doExtend(h, "rental-1")
+		if rec.Code != http.StatusConflict {
+			t.Fatalf("Expected 409, got %d", rec.Code)
+		}
+		assertErrorCode(t, rec, ErrCodeInvalidRentalState)
+	})
+
+	t.Run("Unknown rental", func(t *testing.T) {
+		h, _, _ := newTestRentalsHandler(t)
+		rec := doExtend(h, "missing")
+		if rec.Code != http.StatusNotFound {
+			t.Fatalf("Expected 404, got %d", rec.Code)
+		}
+		assertErrorCode(t, rec, ErrCodeRentalNotFound)
+	})
+}
+
+// conflictOnceRepo fails the first rental update as if another writer saved first
+type conflictOnceRepo struct {
+	data.Repository
+	conflicted bool
+}
+
+func (r *conflictOnceRepo) UpdateRental(rental *models.Rental) error {
+	if !r.conflicted {
+		r.conflicted = true
+		return data.ErrRentalVersionConflict
+	}
+	return r.Repository.UpdateRental(rental)
+}
+
+func TestRentalsHandler_CancelRental(t *testing.T) {
+	doCancel := func(h *RentalsHandler, id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/rentals/"+id+"/cancel", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": id})
+		rec := httptest.NewRecorder()
+		h.CancelRental(rec, req)
+		return rec
+	}
+	doAdminCancel := func(h *RentalsHandler, id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/rentals/"+id+"/cancel", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": id})
+		rec := httptest.NewRecorder()
+		h.AdminCancelRental(rec, req)
+		return rec
+	}
+
+	t.Run("Pending rental expires its session and releases its unit", func(t *testing.T) {
+		var expired []string
+		paymongo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			expired = append(expired, r.URL.Path)
+			w.Write([]byte(`{"data":{"id":"cs_1","attributes":{"status":"expired"}}}`))
+		}))
+		defer paymongo.Close()
+
+		h, repo, am := newTestRentalsHandler(t)
+		h.paymentService = services.NewPaymentServiceWithBaseURL("sk_test", "pk_test", paymongo.URL)
+		unit, _, _ := am.Allocate("col-001", "store-a", "rental-1")
+		repo.CreateRental(&models.Rental{
+			ID:            "rental-1",
+			CollectibleID: "col-001",
+			WarehouseID:   unit.WarehouseID,
+			PaymentID:     "cs_1",
+			PaymentStatus: models.PaymentPending,
+			Status:        models.RentalActive,
+		})
+
+		rec := doCancel(h, "rental-1")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", rec.Code)
+		}
+		if len(expired) != 1 || expired[0] != "/checkout_sessions/cs_1/expire" {
+			t.Errorf("Expected the checkout session to be expired, got %v", expired)
+		}
+		var cancelled map[string]interface{}
+		decodeData(t, rec, &cancelled)
+		if cancelled["status"] != string(models.RentalCancelled) || cancelled["payment_status"] != string(models.PaymentFailed) {
+			t.Errorf("Unexpected rental after cancel: %+v", cancelled)
+		}
+		// Customers see the same details as GetRental, without payment references
+		for _, field := range []string{"payment_id", "payment_url", "customer"} {
+			if _, ok := cancelled[field]; ok {
+				t.Errorf("Expected %s to be hidden from the customer, got %+v", field, cancelled)
+			}
+		}
+		if stock := am.GetTotalStock("col-001"); stock != 2 {
+			t.Errorf("Expected unit back in stock (2), got %d", stock)
+		}
+	})
+
+	t.Run("Session that can't be expired leaves the rental pending", func(t *testing.T) {
+		paymongo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"errors":[{"code":"resource_invalid_state"}]}`))
+		}))
+		defer paymongo.Close()
+
+		h, repo, am := newTestRentalsHandler(t)
+		h.paymentService = services.NewPaymentServiceWithBaseURL("sk_test", "pk_test", paymongo.URL)
+		unit, _, _ := am.Allocate("col-001", "store-a", "rental-1")
+		repo.CreateRental(&models.Rental{
+			ID:            "rental-1",
+			CollectibleID: "col-001",
+			WarehouseID:   unit.WarehouseID,
+			PaymentID:     "cs_1",
+			PaymentStatus: models.PaymentPending,
+			Status:        models.RentalActive,
+		})
+
+		rec := doCancel(h, "rental-1")
+		if rec.Code != http.StatusBadGateway {
+			t.Fatalf("Expected 502, got %d", rec.Code)
+		}
+		assertErrorCode(t, rec, ErrCodePaymentError)
+		if stored, _ := repo.GetRentalByID("rental-1"); stored.Status != models.RentalActive || stored.PaymentStatus != models.PaymentPending {
+			t.Errorf("Expected rental to stay pending, got %+v", stored)
+		}
+		if stock := am.GetTotalStock("col-001"); stock != 1 {
+			t.Errorf("Expected the unit to stay held, stock %d", stock)
+		}
+	})
+
+	t.Run("Paid rental is refunded once despite a version conflict", func(t *testing.T) {
+		var refunded services.PayMongoRefundRequest
+		refunds := 0
+		paymongo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/checkout_sessions/cs_1":
+				w.Write([]byte(`{"data":{"id":"cs_1","attributes":{"status":"paid","payments":[{"id":"pay_1"}]}}}`))
+			case "/refunds":
+				refunds++
+				json.NewDecoder(r.Body).Decode(&refunded)
+				w.Write([]byte(`{"data":{"id":"ref_1","attributes":{"status":"pending"}}}`))
+			default:
+				t.Errorf("Unexpected PayMongo call %s", r.URL.Path)
+			}
+		}))
+		defer paymongo.Close()
+
+		h, repo, am := newTestRentalsHandler(t)
+		h.paymentService = services.NewPaymentServiceWithBaseURL("sk_test", "pk_test", paymongo.URL)
+		notifier := &fakeNotifier{}
+		h.SetNotificationService(notifier)
+		unit, _, _ := am.Allocate("col-001", "store-a", "rental-1")
+		repo.CreateRental(&models.Rental{
+			ID:            "rental-1",
+			CollectibleID: "col-001",
+			WarehouseID:   unit.WarehouseID,
+			TotalFee:      7000,
+			PaymentID:     "cs_1",
+			PaymentStatus: models.PaymentCompleted,
+			Status:        models.RentalActive,
+		})
+		h.repo = &conflictOnceRepo{Repository: repo}
+
+		rec := doAdminCancel(h, "rental-1")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", rec.Code)
+		}
+		var cancelled models.Rental
+		decodeData(t, rec, &cancelled)
+		if cancelled.PaymentStatus != models.PaymentRefunded || cancelled.RefundID != "ref_1" {
+			t.Errorf("Expected refunded rental with refund ID, got %+v", cancelled)
+		}
+		if refunds != 1 || refunded.Data.Attributes.PaymentID != "pay_1" || refunded.Data.Attributes.Amount != 700000 {
+			t.Errorf("Expected a single 700000 centavo refund, got %d: %+v", refunds, refunded)
+		}
+		if stored, _ := repo.GetRentalByID("rental-1"); stored.RefundID != "ref_1" {
+			t.Errorf("Expected refund ID to be saved, got %+v", stored)
+		}
+		if len(notifier.refunds) != 1 || notifier.refunds[0] != "rental-1" {
+			t.Errorf("Expected a refund notice for rental-1, got %v", notifier.refunds)
+		}
+	})
+
+	t.Run("Customers cannot cancel a paid rental", func(t *testing.T) {
+		h, repo, am := newTestRentalsHandler(t)
+		h.paymentService = services.NewPaymentServiceWithBaseURL("sk_test", "pk_test", "http://paymongo.invalid")
+		unit, _, _ := am.Allocate("col-001", "store-a", "rental-1")
+		repo.CreateRental(&models.Rental{
+			ID:            "rental-1",
+			CollectibleID: "col-001",
+			WarehouseID:   unit.WarehouseID,
+			PaymentID:     "cs_1",
+			PaymentStatus: models.PaymentCompleted,
+			Status:        models.RentalActive,
+		})
+
+		rec := doCancel(h, "rental-1")
+		if rec.Code != http.StatusConflict {
+			t.Fatalf("Expected 409, got %d", rec.Code)
+		}
+		assertErrorCode(t, rec, ErrCodeInvalidRentalState)
+		if stored, _ := repo.GetRentalByID("rental-1"); stored.Status != models.RentalActive || stored.PaymentStatus != models.PaymentCompleted {
+			t.Errorf("Expected paid rental to be untouched, got %+v", stored)
+		}
+		if stock := am.GetTotalStock("col-001"); stock != 1 {
+			t.Errorf("Expected the unit to stay rented, stock %d", stock)
+		}
+	})
+
+	t.Run("Returned rental is rejected", func(t *testing.T) {
+		h, repo, _ := newTestRentalsHandler(t)
+		repo.CreateRental(&models.Rental{
+			ID:            "rental-1",
+			CollectibleID: "col-001",
+			PaymentStatus: models.PaymentCompleted,
+			Status:        models.RentalReturned,
+		})
+
+		rec := doAdminCancel(h, "rental-1")
+		if rec.Code != http.StatusConflict {
+			t.Fatalf("Expected 409, got %d", rec.Code)
+		}
+		assertErrorCode(t, rec, ErrCodeInvalidRentalState)
+	})
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/mongocollectibles/rental-system/config"
+	"github.com/mongocollectibles/rental-system/models"
+)
+
+// StoresHandler serves the configured store locations
+type StoresHandler struct {
+	config *config.Config
+}
+
+// NewStoresHandler creates a new stores handler
+func NewStoresHandler(cfg *config.Config) *StoresHandler {
+	return &StoresHandler{config: cfg}
+}
+
+// GetStores returns all configured stores sorted by name
+func (h *StoresHandler) GetStores(w http.ResponseWriter, r *http.Request) {
+	// Copy so sorting doesn't reorder the config, which GetStoreIndex relies on
+	stores := make([]models.Store, len(h.config.Stores))
+	copy(stores, h.config.Stores)
+	sort.Slice(stores, func(i, j int) bool {
+		return stores[i].Name < stores[j].Name
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"data":    stores,
+	})
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mongocollectibles/rental-system/config"
+	"github.com/mongocollectibles/rental-system/models"
+)
+
+func TestGetStores(t *testing.T) {
+	cfg := &config.Config{
+		Stores: []models.Store{
+			{ID: "store-b", Name: "Store B", Latitude: 14.6760, Longitude: 121.0437},
+			{ID: "store-a", Name: "Store A", Latitude: 14.5995, Longitude: 120.9842},
+		},
+	}
+	h := NewStoresHandler(cfg)
+
+	rec := httptest.NewRecorder()
+	h.GetStores(rec, httptest.NewRequest(http.MethodGet, "/api/stores", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+
+	var stores []models.Store
+	decodeData(t, rec, &stores)
+	if len(stores) != 2 {
+		t.Fatalf("Expected 2 stores, got %d", len(stores))
+	}
+	if stores[0].ID != "store-a" || stores[1].ID != "store-b" {
+		t.Errorf("Expected stores sorted by name, got %s, %s", stores[0].ID, stores[1].ID)
+	}
+	if stores[0].Latitude != 14.5995 || stores[0].Longitude != 120.9842 {
+		t.Errorf("Expected coordinates to be returned, got %v, %v", stores[0].Latitude, stores[0].Longitude)
+	}
+	if cfg.Stores[0].ID != "store-b" {
+		t.Error("Expected config store order to be left untouched")
+	}
+}
@@ -5,30 +5,40 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/mongocollectibles/rental-system/config"
 	"github.com/mongocollectibles/rental-system/data"
 	"github.com/mongocollectibles/rental-system/handlers"
-	"github.com/mongocollectibles/rental-system/models"
 	"github.com/mongocollectibles/rental-system/services"
 
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 )
 
+// shutdownTimeout bounds how long in-flight requests may take to finish on shutdown
+const shutdownTimeout = 15 * time.Second
+
+// version is stamped at build time via -ldflags "-X main.version=..."
+var version = "dev"
+
 func main() {
 	// Load configuration
 	cfg := config.LoadConfig()
 
 	// Initialize repository
 	var repo data.Repository
+	var reservationStore services.ReservationStore
 	if os.Getenv("USE_DYNAMODB") == "true" {
 		awsCfg, err := awsconfig.LoadDefaultConfig(context.TODO())
 		if err != nil {
 			log.Fatalf("unable to load SDK config, %v", err)
 		}
-		repo = data.NewDynamoDBRepository(awsCfg)
+		dynamoRepo := data.NewDynamoDBRepository(awsCfg, cfg.DynamoDB)
+		repo = dynamoRepo
+		reservationStore = dynamoRepo
 		log.Println("Using DynamoDB Repository")
 
 		// Auto-seed if empty
@@ -60,39 +70,39 @@ func main() {
 
 	// Initialize services
 	pricingService := services.NewPricingService()
+	pricingService.SetMaxRentalDays(cfg.MaxRentalDays)
+	pricingService.SetVATRate(cfg.VATRate)
 
 	// Bridge: Transform legacy data for new AllocationManager
 	log.Println("Initializing AllocationManager with warehouse data...")
 	allWarehouses, _ := repo.GetAllWarehouses()
-	var newInventory []*models.CollectibleUnit
-	var newDistances []models.WarehouseNode
-	seenWarehouses := make(map[string]bool)
-
-	for collectibleID, warehouseList := range allWarehouses {
-		for _, wh := range warehouseList {
-			// Create Unit
-			unit := &models.CollectibleUnit{
-				ID:            wh.ID, // Assuming Unit ID = Warehouse ID for legacy
-				CollectibleID: collectibleID,
-				WarehouseID:   wh.ID,
-				IsAvailable:   wh.Available,
-			}
-			newInventory = append(newInventory, unit)
-
-			// Create Warehouse Node (Physical)
-			if !seenWarehouses[wh.ID] {
-				// Use the Distances map directly from the warehouse data
-				node := models.WarehouseNode{
-					ID:        wh.ID,
-					Distances: wh.Distances,
-				}
-				newDistances = append(newDistances, node)
-				seenWarehouses[wh.ID] = true
+	newInventory, newDistances := services.BuildInventory(allWarehouses, cfg.Stores)
+
+	// Persisted units keep their availability across restarts; the first boot seeds them
+	if persistedUnits, err := repo.GetAllUnits(); err != nil {
+		log.Printf("Warning: Failed to load persisted units, using warehouse data: %v", err)
+	} else if len(persistedUnits) > 0 {
+		newInventory = persistedUnits
+	} else {
+		log.Println("No persisted units found. Seeding units from warehouse data...")
+		for _, unit := range newInventory {
+			if err := repo.SaveUnit(unit); err != nil {
+				log.Printf("Warning: Failed to persist Unit %s: %v", unit.ID, err)
 			}
 		}
 	}
+	log.Printf("Loaded %d units across %d warehouses", len(newInventory), len(newDistances))
 
 	allocationManager := services.NewAllocationManager(newInventory, newDistances)
+	allocationManager.SetUnitStore(repo)
+
+	// Restore holds persisted by this or other instances before reconstructing from rentals
+	if reservationStore != nil {
+		allocationManager.SetReservationStore(reservationStore)
+		if err := allocationManager.RestoreReservations(); err != nil {
+			log.Printf("Warning: Failed to restore persisted reservations: %v", err)
+		}
+	}
 
 	// Sync with persistent storage (fix for inventory reset on restart)
 	log.Println("Syncing inventory with persistent rentals...")
@@ -103,35 +113,78 @@ func main() {
 	}
 
 	// VALIDATION: Enforce Minimum 3 Stores Rule PER WAREHOUSE
-	// We iterate through every physical warehouse node to ensure full connectivity.
-	for _, wh := range newDistances {
-		storeCount := len(wh.Distances)
-		if storeCount < 3 {
-			log.Fatalf("System Startup Failed: Constraint Violation. Warehouse '%s' only has %d stores connected (Minimum 3 required).", wh.ID, storeCount)
-		}
+	// Every physical warehouse node must reach enough stores; main decides that a violation is fatal.
+	if err := services.ValidateConnectivity(newDistances); err != nil {
+		log.Fatalf("System Startup Failed: Constraint Violation.\n%v", err)
 	}
-	log.Printf("System Validation Passed: All warehouses meet connectivity requirements.", len(newDistances))
+	log.Printf("System Validation Passed: All warehouses meet connectivity requirements across %d warehouses.", len(newDistances))
 
-	// Start reservation cleanup job (Run every 1 mins, expire after 10 mins)
-	allocationManager.StartCleanupJob(1*time.Minute, 2*time.Minute)
+	// Cancelled on SIGINT/SIGTERM to stop background jobs and begin shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Start reservation cleanup job (interval and timeout come from config)
+	allocationManager.SetReservationTimeout(cfg.ReservationTimeout)
+	allocationManager.SetAllocationMode(services.AllocationMode(cfg.AllocationMode), cfg.SoftHoldTTL)
+	allocationManager.SetETAConversion(cfg.ETAKmPerDay, cfg.ETAHandlingDays)
+	allocationManager.StartCleanupJob(ctx, cfg.CleanupInterval)
 
 	paymentService := services.NewPaymentService(cfg.PayMongoSecretKey, cfg.PayMongoPublicKey)
+	paymentService.SetTimeout(cfg.PaymentTimeout)
+	paymentService.SetMaxRetries(cfg.PaymentMaxRetries)
 
 	// Initialize handlers
-	collectiblesHandler := handlers.NewCollectiblesHandler(repo, allocationManager)
+	collectiblesHandler := handlers.NewCollectiblesHandler(repo, allocationManager, cfg)
 	rentalsHandler := handlers.NewRentalsHandler(repo, pricingService, allocationManager, paymentService, cfg)
 	paymentsHandler := handlers.NewPaymentsHandler(repo, paymentService, allocationManager)
-	adminHandler := handlers.NewAdminHandler(repo, allocationManager)
+	adminHandler := handlers.NewAdminHandler(repo, allocationManager, cfg)
+	healthHandler := handlers.NewHealthHandler(repo, version)
+	storesHandler := handlers.NewStoresHandler(cfg)
+
+	// Customer emails are only sent when an SMTP relay is configured. Without one, waitlist
+	// entries stay pending rather than being marked notified.
+	if cfg.SMTP.Host != "" {
+		notifier := services.NewSMTPNotificationService(cfg.SMTP.Host, cfg.SMTP.Port, cfg.SMTP.Username, cfg.SMTP.Password, cfg.SMTP.From)
+		rentalsHandler.SetNotificationService(notifier)
+		paymentsHandler.SetNotificationService(notifier)
+		// Each released unit goes to the longest-waiting customer on the collectible's waitlist
+		allocationManager.SetAvailabilityListener(services.NewWaitlistService(repo, notifier))
+	} else {
+		log.Println("SMTP_HOST not set; customer email notifications are disabled")
+	}
 
 	// Setup router
 	router := mux.NewRouter()
 
+	// Health probes (for load balancer target groups)
+	router.HandleFunc("/healthz", healthHandler.Healthz).Methods("GET")
+	router.HandleFunc("/readyz", healthHandler.Readyz).Methods("GET")
+
 	// --- Admin Configuration ---
 	// Use path prefix instead of host for simpler access
 	adminRouter := router.PathPrefix("/admin").Subrouter()
 
-	// API Route for admin data
-	adminRouter.HandleFunc("/dashboard/api", adminHandler.GetDashboardData).Methods("GET")
+	// API routes for admin data require the admin token; the static dashboard shell stays public
+	if cfg.AdminToken == "" {
+		if cfg.IsDevelopment() {
+			log.Println("Warning: ADMIN_TOKEN is not set; admin API routes are open (development only)")
+		} else {
+			log.Println("Warning: ADMIN_TOKEN is not set; admin API routes are disabled")
+		}
+	}
+	adminAPI := adminRouter.NewRoute().Subrouter()
+	adminAPI.Use(handlers.RequireAdmin(cfg))
+	adminAPI.HandleFunc("/dashboard/api", adminHandler.GetDashboardData).Methods("GET")
+	adminAPI.HandleFunc("/reservations", adminHandler.GetReservations).Methods("GET")
+	adminAPI.HandleFunc("/inventory/release", adminHandler.ReleaseUnit).Methods("POST")
+	adminAPI.HandleFunc("/collectibles", adminHandler.CreateCollectible).Methods("POST")
+	adminAPI.HandleFunc("/collectibles/{id}", adminHandler.UpdateCollectible).Methods("PUT")
+	adminAPI.HandleFunc("/collectibles/{id}/warehouses", adminHandler.RegisterWarehouse).Methods("POST")
+	adminAPI.HandleFunc("/collectibles/{id}/archive", adminHandler.ArchiveCollectible).Methods("POST")
+	adminAPI.HandleFunc("/rentals/export.csv", adminHandler.ExportRentalsCSV).Methods("GET")
+	adminAPI.HandleFunc("/rentals/{id}/return", rentalsHandler.ReturnRental).Methods("POST")
+	adminAPI.HandleFunc("/rentals/{id}/cancel", rentalsHandler.AdminCancelRental).Methods("POST")
+	adminAPI.HandleFunc("/webhooks", adminHandler.GetWebhookEvents).Methods("GET")
 
 	// Serve admin static files at /admin/
 	// We need StripPrefix so the file server doesn't look for /admin/ inside static/admin/
@@ -144,10 +197,19 @@ func main() {
 	// Collectibles endpoints
 	api.HandleFunc("/collectibles", collectiblesHandler.GetAllCollectibles).Methods("GET")
 	api.HandleFunc("/collectibles/{id}", collectiblesHandler.GetCollectibleByID).Methods("GET")
+	api.HandleFunc("/collectibles/{id}/availability", collectiblesHandler.GetAvailability).Methods("GET")
+	api.HandleFunc("/collectibles/{id}/waitlist", collectiblesHandler.JoinWaitlist).Methods("POST")
+
+	// Stores endpoints
+	api.HandleFunc("/stores", storesHandler.GetStores).Methods("GET")
 
 	// Rentals endpoints
 	api.HandleFunc("/rentals/quote", rentalsHandler.GetQuote).Methods("POST")
 	api.HandleFunc("/rentals/checkout", rentalsHandler.Checkout).Methods("POST")
+	api.HandleFunc("/rentals/{id}", rentalsHandler.GetRental).Methods("GET")
+	api.HandleFunc("/rentals/{id}/cancel", rentalsHandler.CancelRental).Methods("POST")
+	api.HandleFunc("/rentals/{id}/extend-hold", rentalsHandler.ExtendHold).Methods("POST")
+	api.HandleFunc("/rentals/{id}/receipt", rentalsHandler.GetReceipt).Methods("GET")
 
 	// Payment endpoints
 	api.HandleFunc("/webhooks/paymongo", paymentsHandler.WebhookPayMongo).Methods("POST")
@@ -162,9 +224,31 @@ func main() {
 
 	// Start server
 	addr := ":" + cfg.ServerPort
-	log.Printf("Server starting on http://localhost%s", addr)
-	log.Printf("Environment: %s", cfg.Environment)
-	log.Fatal(http.ListenAndServe(addr, corsRouter))
+	server := &http.Server{
+		Addr:    addr,
+		Handler: corsRouter,
+	}
+
+	go func() {
+		log.Printf("Server starting on http://localhost%s", addr)
+		log.Printf("Environment: %s", cfg.Environment)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Server failed: %v", err)
+		}
+	}()
+
+	// Wait for a termination signal, then drain in-flight requests
+	<-ctx.Done()
+	stop()
+	log.Println("Shutdown signal received. Draining connections...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Graceful shutdown failed: %v", err)
+		return
+	}
+	log.Println("Server stopped cleanly")
 }
 
 // enableCORS adds CORS headers to responses
@@ -172,7 +256,7 @@ func enableCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Idempotency-Key")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
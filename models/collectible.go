@@ -34,15 +34,16 @@ type Collectible struct {
 	Available   bool    `json:"available" dynamodbav:"available"`
 	DailyRate   float64 `json:"daily_rate" dynamodbav:"daily_rate"` // Daily rental rate
 	ETADays     int     `json:"eta_days" dynamodbav:"-"`            // Estimated time of arrival in days, ignored in DB
+	Archived    bool    `json:"archived" dynamodbav:"archived"`     // Retired from the catalog but kept for past rentals
 }
 
 // Store represents a brick-and-mortar store location
 type Store struct {
-	ID      string `json:"id" dynamodbav:"id"`
-	Name    string `json:"name" dynamodbav:"name"`
-	Address string `json:"address" dynamodbav:"address"`
-	// Latitude  float64 `json:"latitude" dynamodbav:"latitude"`
-	// Longitude float64 `json:"longitude" dynamodbav:"longitude"`
+	ID        string  `json:"id" dynamodbav:"id"`
+	Name      string  `json:"name" dynamodbav:"name"`
+	Address   string  `json:"address" dynamodbav:"address"`
+	Latitude  float64 `json:"latitude" dynamodbav:"latitude"`
+	Longitude float64 `json:"longitude" dynamodbav:"longitude"`
 }
 
 // Warehouse represents a storage location for collectibles
@@ -51,5 +52,8 @@ type Warehouse struct {
 	Name          string         `json:"name" dynamodbav:"name"`
 	CollectibleID string         `json:"collectible_id" dynamodbav:"collectible_id"`
 	Available     bool           `json:"available" dynamodbav:"available"`
-	Distances     map[string]int `json:"distances" dynamodbav:"distances"` // StoreID -> distance (km)
+	Quantity      int            `json:"quantity" dynamodbav:"quantity"` // Copies of the collectible stocked here; 0 is treated as 1 for older records
+	Latitude      float64        `json:"latitude" dynamodbav:"latitude"`
+	Longitude     float64        `json:"longitude" dynamodbav:"longitude"`
+	Distances     map[string]int `json:"distances,omitempty" dynamodbav:"distances,omitempty"` // Manual StoreID -> distance (km) overrides; others are computed from coordinates
 }
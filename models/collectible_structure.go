@@ -11,10 +11,18 @@ import "time"
 // CollectibleUnit represents a specific physical item in a warehouse
 // This struct is internal-facing; the customer never sees the Unit ID.
 type CollectibleUnit struct {
-	ID            string
-	CollectibleID string // Links to CollectibleType
-	WarehouseID   string // Links to WarehouseNode
-	IsAvailable   bool
-	ReservedAt    *time.Time
-	ReservationID string
+	ID            string     `dynamodbav:"id"`
+	CollectibleID string     `dynamodbav:"collectible_id"` // Links to CollectibleType
+	WarehouseID   string     `dynamodbav:"warehouse_id"`   // Links to WarehouseNode
+	IsAvailable   bool       `dynamodbav:"is_available"`
+	ReservedAt    *time.Time `dynamodbav:"reserved_at,omitempty"`
+	ReservationID string     `dynamodbav:"reservation_id,omitempty"`
+}
+
+// Reservation is the persisted hold of a unit by a rental, keyed by unit ID.
+// A nil ReservedAt means the reservation is confirmed (paid) and never expires.
+type Reservation struct {
+	UnitID     string     `dynamodbav:"unit_id"`
+	RentalID   string     `dynamodbav:"rental_id"`
+	ReservedAt *time.Time `dynamodbav:"reserved_at,omitempty"`
 }
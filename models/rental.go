@@ -20,11 +20,23 @@ const (
 	PaymentPending   PaymentStatus = "pending"
 	PaymentCompleted PaymentStatus = "completed"
 	PaymentFailed    PaymentStatus = "failed"
+	PaymentRefunded  PaymentStatus = "refunded"
+)
+
+// RentalStatus represents where a rental is in its lifecycle
+type RentalStatus string
+
+const (
+	RentalActive    RentalStatus = "active"
+	RentalReturned  RentalStatus = "returned"
+	RentalCancelled RentalStatus = "cancelled"
 )
 
 // Customer represents customer information
 type Customer struct {
 	Name       string `json:"name" dynamodbav:"name"`
+	FirstName  string `json:"first_name,omitempty" dynamodbav:"first_name,omitempty"` // Optional; derived from Name when empty
+	LastName   string `json:"last_name,omitempty" dynamodbav:"last_name,omitempty"`
 	Email      string `json:"email" dynamodbav:"email"`
 	Phone      string `json:"phone" dynamodbav:"phone"`
 	Address    string `json:"address" dynamodbav:"address"`
@@ -43,14 +55,41 @@ type Rental struct {
 	CustomerEmail   string        `json:"customer_email" dynamodbav:"customer_email"` // For GSI Index
 	Duration        int           `json:"duration" dynamodbav:"duration"`             // in days
 	DailyRate       float64       `json:"daily_rate" dynamodbav:"daily_rate"`
-	TotalFee        float64       `json:"total_fee" dynamodbav:"total_fee"`
+	TotalFee        float64       `json:"total_fee" dynamodbav:"total_fee"`         // Tax-exclusive rental fee
+	TaxAmount       float64       `json:"tax_amount" dynamodbav:"tax_amount"`       // VAT charged on TotalFee
+	Deposit         float64       `json:"deposit" dynamodbav:"deposit"`             // Refundable security deposit, refunded on return
+	InsuranceFee    float64       `json:"insurance_fee" dynamodbav:"insurance_fee"` // Optional damage waiver; zero when not taken
 	PaymentMethod   PaymentMethod `json:"payment_method" dynamodbav:"payment_method"`
 	PaymentStatus   PaymentStatus `json:"payment_status" dynamodbav:"payment_status"`
-	PaymentID       string        `json:"payment_id" dynamodbav:"payment_id"`
+	PaymentID       string        `json:"payment_id" dynamodbav:"payment_id,omitempty"` // Omitted when empty: it keys the PaymentIDIndex GSI
 	PaymentURL      string        `json:"payment_url" dynamodbav:"payment_url"`
 	ETA             int           `json:"eta" dynamodbav:"eta"` // in days
+	Status          RentalStatus  `json:"status" dynamodbav:"status"`
+	PaidAt          *time.Time    `json:"paid_at,omitempty" dynamodbav:"paid_at,omitempty"`
+	ReturnedAt      *time.Time    `json:"returned_at,omitempty" dynamodbav:"returned_at,omitempty"`
+	LateFee         float64       `json:"late_fee" dynamodbav:"late_fee"` // Overage charged on return
+	CancelledAt     *time.Time    `json:"cancelled_at,omitempty" dynamodbav:"cancelled_at,omitempty"`
+	RefundID        string        `json:"refund_id,omitempty" dynamodbav:"refund_id,omitempty"`                 // PayMongo refund for a cancelled paid rental
+	DepositRefundID string        `json:"deposit_refund_id,omitempty" dynamodbav:"deposit_refund_id,omitempty"` // PayMongo refund of the deposit on return
 	CreatedAt       time.Time     `json:"created_at" dynamodbav:"created_at"`
 	UpdatedAt       time.Time     `json:"updated_at" dynamodbav:"updated_at"`
+	Version         int           `json:"version" dynamodbav:"version"` // Incremented on every update for optimistic locking
+}
+
+// AmountCharged is everything the customer paid at checkout: the rental fee, VAT,
+// any damage waiver and the refundable deposit
+func (r *Rental) AmountCharged() float64 {
+	return r.TotalFee + r.TaxAmount + r.InsuranceFee + r.Deposit
+}
+
+// StartsAt is when the rental period begins: when the unit reaches the store, ETA days after
+// payment. Rentals without a payment timestamp count from checkout instead.
+func (r *Rental) StartsAt() time.Time {
+	start := r.CreatedAt
+	if r.PaidAt != nil {
+		start = *r.PaidAt
+	}
+	return start.AddDate(0, 0, r.ETA)
 }
 
 // RentalQuoteRequest represents a request for rental fee calculation
@@ -67,26 +106,79 @@ type RentalQuoteResponse struct {
 	Size            Size    `json:"size"`
 	Duration        int     `json:"duration"`
 	DailyRate       float64 `json:"daily_rate"`
-	TotalFee        float64 `json:"total_fee"`
+	TotalFee        float64 `json:"total_fee"`      // Tax-exclusive
+	TaxAmount       float64 `json:"tax_amount"`     // VAT on TotalFee
+	TotalWithTax    float64 `json:"total_with_tax"` // Rental fee including VAT
+	Deposit         float64 `json:"deposit"`        // Refundable security deposit
+	TotalDue        float64 `json:"total_due"`      // What the customer pays at checkout
+	InsuranceFee    float64 `json:"insurance_fee"`  // Optional damage waiver, added to TotalDue only if taken
 	IsSpecialRate   bool    `json:"is_special_rate"`
+	DiscountPercent float64 `json:"discount_percent"` // Long-term discount applied to the daily rate
 	Stock           int     `json:"stock"`
 	ETA             int     `json:"eta"` // in days
+	// Nearest warehouses with available units, only when a store is given
+	WarehouseOptions []WarehouseOption `json:"warehouse_options,omitempty"`
+}
+
+// Receipt is an itemized breakdown of a rental's charges
+type Receipt struct {
+	CollectibleID     string  `json:"collectible_id"`
+	CollectibleName   string  `json:"collectible_name"`
+	Size              Size    `json:"size"`
+	Duration          int     `json:"duration"`
+	BaseDailyRate     float64 `json:"base_daily_rate"`  // Standard rate for the size
+	RateMultiplier    float64 `json:"rate_multiplier"`  // 2 for short rentals, otherwise 1
+	DiscountPercent   float64 `json:"discount_percent"` // Long-term discount on the daily rate
+	DailyRate         float64 `json:"daily_rate"`       // Effective rate after multiplier and discount
+	Subtotal          float64 `json:"subtotal"`
+	TaxAmount         float64 `json:"tax_amount"`    // VAT on the subtotal
+	InsuranceFee      float64 `json:"insurance_fee"` // Damage waiver, if taken
+	Deposit           float64 `json:"deposit"`       // Refundable security deposit
+	LateFee           float64 `json:"late_fee"`
+	GrandTotal        float64 `json:"grand_total"`
+	Currency          string  `json:"currency"`
+	GrandTotalDisplay string  `json:"grand_total_display"` // e.g. "PHP 7,000.00"
 }
 
 // CheckoutRequest represents a checkout request
 type CheckoutRequest struct {
-	CollectibleID string        `json:"collectible_id"`
-	StoreID       string        `json:"store_id"`
-	Duration      int           `json:"duration"`
-	PaymentMethod PaymentMethod `json:"payment_method"`
-	Customer      Customer      `json:"customer"`
+	CollectibleID  string        `json:"collectible_id"`
+	StoreID        string        `json:"store_id"`
+	Duration       int           `json:"duration"`
+	PaymentMethod  PaymentMethod `json:"payment_method"`
+	Customer       Customer      `json:"customer"`
+	InsuranceOptIn bool          `json:"insurance_opt_in"` // Adds the damage waiver to the charge
 }
 
 // CheckoutResponse represents the checkout response
 type CheckoutResponse struct {
-	RentalID   string  `json:"rental_id"`
-	TotalFee   float64 `json:"total_fee"`
-	ETA        int     `json:"eta"`
-	PaymentURL string  `json:"payment_url"`
-	Message    string  `json:"message"`
+	RentalID     string  `json:"rental_id"`
+	TotalFee     float64 `json:"total_fee"`
+	TaxAmount    float64 `json:"tax_amount"`
+	TotalWithTax float64 `json:"total_with_tax"`
+	Deposit      float64 `json:"deposit"`
+	InsuranceFee float64 `json:"insurance_fee"`
+	TotalDue     float64 `json:"total_due"`
+	ETA          int     `json:"eta"`
+	PaymentURL   string  `json:"payment_url"`
+	Message      string  `json:"message"`
+}
+
+// RentalDetailsResponse is the customer-facing view of a rental.
+// Payment provider internals (session ID, customer details) are intentionally omitted.
+type RentalDetailsResponse struct {
+	RentalID        string        `json:"rental_id"`
+	CollectibleID   string        `json:"collectible_id"`
+	CollectibleName string        `json:"collectible_name"`
+	StoreID         string        `json:"store_id"`
+	StoreName       string        `json:"store_name"`
+	Duration        int           `json:"duration"`
+	DailyRate       float64       `json:"daily_rate"`
+	TotalFee        float64       `json:"total_fee"`
+	LateFee         float64       `json:"late_fee"`
+	ETA             int           `json:"eta"` // in days
+	PaymentStatus   PaymentStatus `json:"payment_status"`
+	Status          RentalStatus  `json:"status"`
+	CreatedAt       time.Time     `json:"created_at"`
+	ReturnedAt      *time.Time    `json:"returned_at,omitempty"`
 }
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// WaitlistEntry is a customer waiting to hear when an out-of-stock collectible is back
+type WaitlistEntry struct {
+	ID              string     `json:"id" dynamodbav:"id"`
+	CollectibleID   string     `json:"collectible_id" dynamodbav:"collectible_id"` // For GSI Index
+	CollectibleName string     `json:"collectible_name" dynamodbav:"collectible_name"`
+	StoreID         string     `json:"store_id" dynamodbav:"store_id"`
+	Name            string     `json:"name" dynamodbav:"name"`
+	Email           string     `json:"email" dynamodbav:"email"`
+	CreatedAt       time.Time  `json:"created_at" dynamodbav:"created_at"`
+	NotifiedAt      *time.Time `json:"notified_at,omitempty" dynamodbav:"notified_at,omitempty"` // Set once the back-in-stock email is sent
+}
+
+// WaitlistRequest is the body of a request to join a collectible's waitlist
+type WaitlistRequest struct {
+	Name    string `json:"name"`
+	Email   string `json:"email"`
+	StoreID string `json:"store_id"`
+}
@@ -1,15 +1,16 @@
 package models
 
-// StoreNode represents a brick-and-mortar store location for the warehouse logic
-// Note: This is separate from the main Store struct to keep the new design clean as requested,
-// though in a full refactor they might merge.
-type StoreNode struct {
-	ID   int
-	Name string
-}
-
-// WarehouseNode represents a warehouse that stores one collectible
+// WarehouseNode represents a warehouse that stores one collectible.
+// Distances are keyed by Store.ID; Store is the single canonical store type.
 type WarehouseNode struct {
 	ID        string
 	Distances map[string]int // Map of StoreID -> distance (km) to eliminate index-based lookup errors
 }
+
+// WarehouseOption is a warehouse with available units of a collectible that ships to a store
+type WarehouseOption struct {
+	WarehouseID string `json:"warehouse_id"`
+	Available   int    `json:"available"`
+	Distance    int    `json:"distance"` // km
+	ETADays     int    `json:"eta_days"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// WebhookEvent is the record of one inbound PayMongo webhook, stored before it is processed
+type WebhookEvent struct {
+	ID         string    `json:"id" dynamodbav:"id"` // PayMongo event ID, or a generated ID if the payload has none
+	Type       string    `json:"type" dynamodbav:"type"`
+	Payload    string    `json:"payload" dynamodbav:"payload"` // Raw request body
+	ReceivedAt time.Time `json:"received_at" dynamodbav:"received_at"`
+	Processed  bool      `json:"processed" dynamodbav:"processed"`
+	Error      string    `json:"error,omitempty" dynamodbav:"error,omitempty"`
+}
@@ -1,20 +1,89 @@
 package services
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"log"
 	"math"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/mongocollectibles/rental-system/models"
 )
 
+// DefaultReservationTimeout is how long an unconfirmed reservation is held
+// before the cleanup job releases it back to inventory.
+const DefaultReservationTimeout = 15 * time.Minute
+
+// ErrOutOfStock is returned when a collectible has too few available units anywhere
+var ErrOutOfStock = errors.New("no available units found for the selected collectible")
+
+// ErrStoreNotServed is returned when a collectible has available units, but not enough
+// of them sit at warehouses that ship to the requested store
+var ErrStoreNotServed = errors.New("no warehouse with available units serves the selected store")
+
+// ErrWarehouseExists is returned when adding a warehouse or unit whose ID is already known
+var ErrWarehouseExists = errors.New("warehouse or unit already exists")
+
+// ErrUnknownWarehouse is returned when adding a unit stocked at a warehouse the manager doesn't know
+var ErrUnknownWarehouse = errors.New("unit's warehouse is not known")
+
+// ErrReservationNotFound is returned when a rental no longer holds an unconfirmed reservation,
+// either because it expired, was released or has already been confirmed
+var ErrReservationNotFound = errors.New("reservation not found or already expired")
+
+// AllocationMode controls when a unit is firmly committed to a rental
+type AllocationMode string
+
+const (
+	// AllocationModeReserve reserves a unit at checkout and holds it for the reservation timeout
+	AllocationModeReserve AllocationMode = "reserve"
+	// AllocationModeSoftHold only soft-holds a unit at checkout for a short TTL; the real
+	// allocation happens on payment success, re-allocating if the hold has already lapsed
+	AllocationModeSoftHold AllocationMode = "soft_hold"
+)
+
+// DefaultSoftHoldTTL is how long a soft hold blocks a unit in AllocationModeSoftHold
+const DefaultSoftHoldTTL = 5 * time.Minute
+
+// Default conversion from a warehouse's distance to a store (km) into an ETA in days:
+// DefaultETAHandlingDays to pick and pack, then one day per DefaultETAKmPerDay km or part of it
+const (
+	DefaultETAKmPerDay     = 50
+	DefaultETAHandlingDays = 1
+)
+
+// collectibleShard holds the units of one collectible behind their own lock,
+// so operations on different collectibles never contend.
+type collectibleShard struct {
+	mu    sync.Mutex // Protects the units' availability and reservation fields
+	units []*models.CollectibleUnit
+}
+
 // AllocationManager handles the allocation of specific units to customers
 type AllocationManager struct {
-	inventory  []*models.CollectibleUnit
-	warehouses map[string]models.WarehouseNode
-	mu         sync.Mutex // Protects inventory from race conditions
+	indexMu   sync.RWMutex                       // Protects the indexes below; never taken while holding a shard lock
+	inventory []*models.CollectibleUnit          // Flat list in load order, for admin snapshots
+	units     map[string]*models.CollectibleUnit // UnitID -> unit; only ever grows
+	shards    map[string]*collectibleShard       // CollectibleID -> units; only ever grows
+
+	warehousesMu sync.RWMutex // Protects warehouses; may be taken inside shard locks
+	warehouses   map[string]models.WarehouseNode
+
+	reservationsMu sync.Mutex                           // Protects reservations; taken inside shard locks
+	reservations   map[string][]*models.CollectibleUnit // ReservationID -> units held for that rental
+
+	settingsMu         sync.RWMutex // Protects the settings below
+	reservationTimeout time.Duration
+	mode               AllocationMode
+	softHoldTTL        time.Duration
+	etaKmPerDay        int
+	etaHandlingDays    int
+	store              ReservationStore     // Optional; nil keeps reservations in memory only
+	inventoryStore     UnitStore            // Optional; nil keeps unit availability in memory only
+	listener           AvailabilityListener // Optional; told when units go back into stock
 }
 
 // NewAllocationManager creates a new instance
@@ -25,39 +94,519 @@ func NewAllocationManager(inventory []*models.CollectibleUnit, warehouses []mode
 		whMap[wh.ID] = wh
 	}
 
+	// Index units by collectible, one lock per collectible, and held units by rental
+	shards := make(map[string]*collectibleShard)
+	byID := make(map[string]*models.CollectibleUnit, len(inventory))
+	reservations := make(map[string][]*models.CollectibleUnit)
+	for _, unit := range inventory {
+		sh, ok := shards[unit.CollectibleID]
+		if !ok {
+			sh = &collectibleShard{}
+			shards[unit.CollectibleID] = sh
+		}
+		sh.units = append(sh.units, unit)
+		byID[unit.ID] = unit
+		if !unit.IsAvailable && unit.ReservationID != "" {
+			reservations[unit.ReservationID] = append(reservations[unit.ReservationID], unit)
+		}
+	}
+
 	return &AllocationManager{
-		inventory:  inventory,
-		warehouses: whMap,
+		inventory:          inventory,
+		units:              byID,
+		shards:             shards,
+		warehouses:         whMap,
+		reservations:       reservations,
+		reservationTimeout: DefaultReservationTimeout,
+		mode:               AllocationModeReserve,
+		softHoldTTL:        DefaultSoftHoldTTL,
+		etaKmPerDay:        DefaultETAKmPerDay,
+		etaHandlingDays:    DefaultETAHandlingDays,
+	}
+}
+
+// shard returns the units of a collectible, or nil if it has none
+func (am *AllocationManager) shard(collectibleID string) *collectibleShard {
+	am.indexMu.RLock()
+	defer am.indexMu.RUnlock()
+	return am.shards[collectibleID]
+}
+
+// allShards returns a copy of the CollectibleID -> shard index
+func (am *AllocationManager) allShards() map[string]*collectibleShard {
+	am.indexMu.RLock()
+	defer am.indexMu.RUnlock()
+	shards := make(map[string]*collectibleShard, len(am.shards))
+	for collectibleID, sh := range am.shards {
+		shards[collectibleID] = sh
+	}
+	return shards
+}
+
+// unit returns the unit with unitID, or false if there is none
+func (am *AllocationManager) unit(unitID string) (*models.CollectibleUnit, bool) {
+	am.indexMu.RLock()
+	defer am.indexMu.RUnlock()
+	unit, ok := am.units[unitID]
+	return unit, ok
+}
+
+// allUnits returns a copy of the inventory in load order
+func (am *AllocationManager) allUnits() []*models.CollectibleUnit {
+	am.indexMu.RLock()
+	defer am.indexMu.RUnlock()
+	return append([]*models.CollectibleUnit(nil), am.inventory...)
+}
+
+// warehouse returns the warehouse node with warehouseID, or false if there is none
+func (am *AllocationManager) warehouse(warehouseID string) (models.WarehouseNode, bool) {
+	am.warehousesMu.RLock()
+	defer am.warehousesMu.RUnlock()
+	wh, ok := am.warehouses[warehouseID]
+	return wh, ok
+}
+
+// HasWarehouse reports whether a warehouse is known to the manager
+func (am *AllocationManager) HasWarehouse(warehouseID string) bool {
+	_, ok := am.warehouse(warehouseID)
+	return ok
+}
+
+// AddWarehouse makes a new warehouse and its units allocatable immediately. Nothing is
+// added if the warehouse or any of the unit IDs is already known. The availability
+// listener is told about each available unit so waitlisted customers hear of new stock.
+func (am *AllocationManager) AddWarehouse(node models.WarehouseNode, units []*models.CollectibleUnit) error {
+	am.indexMu.Lock()
+	if am.HasWarehouse(node.ID) {
+		am.indexMu.Unlock()
+		return ErrWarehouseExists
+	}
+	seen := make(map[string]bool, len(units))
+	for _, unit := range units {
+		if _, ok := am.units[unit.ID]; ok || seen[unit.ID] {
+			am.indexMu.Unlock()
+			return ErrWarehouseExists
+		}
+		seen[unit.ID] = true
+	}
+
+	am.warehousesMu.Lock()
+	am.warehouses[node.ID] = node
+	am.warehousesMu.Unlock()
+
+	var added []string // Collectible ID per available unit
+	for _, unit := range units {
+		am.indexUnitLocked(unit)
+		if unit.IsAvailable {
+			added = append(added, unit.CollectibleID)
+		}
+	}
+	am.indexMu.Unlock()
+
+	log.Printf("[Allocation] Added Warehouse %s with %d unit(s)", node.ID, len(units))
+	for _, collectibleID := range added {
+		am.notifyReleased(collectibleID)
+	}
+	return nil
+}
+
+// AddWarehouseNode adds a warehouse, or replaces the store distances of a known one.
+// Units already stocked there use the new distances from their next allocation.
+func (am *AllocationManager) AddWarehouseNode(node models.WarehouseNode) {
+	am.warehousesMu.Lock()
+	defer am.warehousesMu.Unlock()
+	am.warehouses[node.ID] = node
+	log.Printf("[Allocation] Registered Warehouse %s serving %d stores", node.ID, len(node.Distances))
+}
+
+// AddUnit makes one more unit allocatable. Its warehouse must already be known (see
+// AddWarehouseNode) and its ID must be new. An available unit is reported to the
+// availability listener like a released one.
+func (am *AllocationManager) AddUnit(unit *models.CollectibleUnit) error {
+	if !am.HasWarehouse(unit.WarehouseID) {
+		return ErrUnknownWarehouse
+	}
+
+	am.indexMu.Lock()
+	if _, ok := am.units[unit.ID]; ok {
+		am.indexMu.Unlock()
+		return ErrWarehouseExists
+	}
+	am.indexUnitLocked(unit)
+	am.indexMu.Unlock()
+
+	log.Printf("[Allocation] Added Unit %s of Collectible %s at Warehouse %s", unit.ID, unit.CollectibleID, unit.WarehouseID)
+	if unit.IsAvailable {
+		am.notifyReleased(unit.CollectibleID)
+	}
+	return nil
+}
+
+// indexUnitLocked adds a unit to its collectible's shard and the unit indexes.
+// Callers must hold indexMu for writing and must not hold any shard lock.
+func (am *AllocationManager) indexUnitLocked(unit *models.CollectibleUnit) {
+	sh, ok := am.shards[unit.CollectibleID]
+	if !ok {
+		sh = &collectibleShard{}
+		am.shards[unit.CollectibleID] = sh
+	}
+	sh.mu.Lock()
+	sh.units = append(sh.units, unit)
+	if !unit.IsAvailable && unit.ReservationID != "" {
+		am.trackUnsafe(unit)
+	}
+	sh.mu.Unlock()
+	am.units[unit.ID] = unit
+	am.inventory = append(am.inventory, unit)
+}
+
+// SetReservationTimeout overrides how long unconfirmed reservations are held.
+// Non-positive values are ignored so the current timeout stays in effect.
+func (am *AllocationManager) SetReservationTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		return
+	}
+	am.settingsMu.Lock()
+	defer am.settingsMu.Unlock()
+	am.reservationTimeout = timeout
+}
+
+// ReservationTimeout returns the currently configured reservation timeout
+func (am *AllocationManager) ReservationTimeout() time.Duration {
+	am.settingsMu.RLock()
+	defer am.settingsMu.RUnlock()
+	return am.reservationTimeout
+}
+
+// SetAllocationMode switches between reserve-at-checkout and soft-hold allocation.
+// softHoldTTL is only used in AllocationModeSoftHold; non-positive values keep the current TTL.
+func (am *AllocationManager) SetAllocationMode(mode AllocationMode, softHoldTTL time.Duration) {
+	am.settingsMu.Lock()
+	defer am.settingsMu.Unlock()
+	am.mode = mode
+	if softHoldTTL > 0 {
+		am.softHoldTTL = softHoldTTL
+	}
+}
+
+// AllocationMode returns the current allocation mode
+func (am *AllocationManager) AllocationMode() AllocationMode {
+	am.settingsMu.RLock()
+	defer am.settingsMu.RUnlock()
+	return am.mode
+}
+
+// HoldTimeout returns how long an unconfirmed hold lasts in the current mode
+func (am *AllocationManager) HoldTimeout() time.Duration {
+	am.settingsMu.RLock()
+	defer am.settingsMu.RUnlock()
+	if am.mode == AllocationModeSoftHold {
+		return am.softHoldTTL
+	}
+	return am.reservationTimeout
+}
+
+// SetETAConversion sets how distances become delivery days: handlingDays before dispatch,
+// then one day per kmPerDay km or part of it. A non-positive kmPerDay or negative
+// handlingDays is ignored so the current value stays in effect.
+func (am *AllocationManager) SetETAConversion(kmPerDay, handlingDays int) {
+	am.settingsMu.Lock()
+	defer am.settingsMu.Unlock()
+	if kmPerDay > 0 {
+		am.etaKmPerDay = kmPerDay
+	}
+	if handlingDays >= 0 {
+		am.etaHandlingDays = handlingDays
+	}
+}
+
+// ETADays converts a warehouse-to-store distance in km into a delivery ETA in days
+func (am *AllocationManager) ETADays(distanceKm int) int {
+	am.settingsMu.RLock()
+	defer am.settingsMu.RUnlock()
+	if distanceKm < 0 {
+		distanceKm = 0
+	}
+	return am.etaHandlingDays + (distanceKm+am.etaKmPerDay-1)/am.etaKmPerDay
+}
+
+// reservationStore returns the configured reservation store, if any
+func (am *AllocationManager) reservationStore() ReservationStore {
+	am.settingsMu.RLock()
+	defer am.settingsMu.RUnlock()
+	return am.store
+}
+
+// SetReservationStore enables persisting reservations through store.
+// Call RestoreReservations afterwards to load holds made before a restart.
+func (am *AllocationManager) SetReservationStore(store ReservationStore) {
+	am.settingsMu.Lock()
+	defer am.settingsMu.Unlock()
+	am.store = store
+}
+
+// unitStore returns the configured unit store, if any
+func (am *AllocationManager) unitStore() UnitStore {
+	am.settingsMu.RLock()
+	defer am.settingsMu.RUnlock()
+	return am.inventoryStore
+}
+
+// SetUnitStore enables writing every availability change through to store
+func (am *AllocationManager) SetUnitStore(store UnitStore) {
+	am.settingsMu.Lock()
+	defer am.settingsMu.Unlock()
+	am.inventoryStore = store
+}
+
+// SetAvailabilityListener registers listener to be told whenever a released or expired
+// unit goes back into stock. It is called after the unit's lock is dropped.
+func (am *AllocationManager) SetAvailabilityListener(listener AvailabilityListener) {
+	am.settingsMu.Lock()
+	defer am.settingsMu.Unlock()
+	am.listener = listener
+}
+
+// notifyReleased tells the availability listener, if any, that collectibleID is back in stock
+func (am *AllocationManager) notifyReleased(collectibleID string) {
+	am.settingsMu.RLock()
+	listener := am.listener
+	am.settingsMu.RUnlock()
+	if listener != nil {
+		listener.UnitReleased(collectibleID)
+	}
+}
+
+// trackUnsafe indexes a unit under its ReservationID.
+// Callers must hold the unit's shard lock.
+func (am *AllocationManager) trackUnsafe(unit *models.CollectibleUnit) {
+	am.reservationsMu.Lock()
+	defer am.reservationsMu.Unlock()
+	am.reservations[unit.ReservationID] = append(am.reservations[unit.ReservationID], unit)
+}
+
+// untrackUnsafe removes a unit from the index under its ReservationID.
+// Callers must hold the unit's shard lock and clear ReservationID afterwards.
+func (am *AllocationManager) untrackUnsafe(unit *models.CollectibleUnit) {
+	am.reservationsMu.Lock()
+	defer am.reservationsMu.Unlock()
+	units := am.reservations[unit.ReservationID]
+	for i, u := range units {
+		if u == unit {
+			units = append(units[:i], units[i+1:]...)
+			break
+		}
+	}
+	if len(units) == 0 {
+		delete(am.reservations, unit.ReservationID)
+	} else {
+		am.reservations[unit.ReservationID] = units
+	}
+}
+
+// reservedUnits returns a copy of the units indexed under rentalID. The units' state may
+// change once the index lock is dropped, so callers must re-check ReservationID under
+// the unit's shard lock.
+func (am *AllocationManager) reservedUnits(rentalID string) []*models.CollectibleUnit {
+	am.reservationsMu.Lock()
+	defer am.reservationsMu.Unlock()
+	return append([]*models.CollectibleUnit(nil), am.reservations[rentalID]...)
+}
+
+// RestoreReservations re-applies persisted holds to the in-memory inventory.
+// Holds for units that no longer exist are skipped.
+func (am *AllocationManager) RestoreReservations() error {
+	store := am.reservationStore()
+	if store == nil {
+		return nil
+	}
+
+	reservations, err := store.LoadReservations()
+	if err != nil {
+		return err
+	}
+
+	count := 0
+	for _, res := range reservations {
+		unit, ok := am.unit(res.UnitID)
+		if !ok {
+			log.Printf("[Allocation] Skipping persisted reservation for unknown Unit %s", res.UnitID)
+			continue
+		}
+
+		sh := am.shard(unit.CollectibleID)
+		sh.mu.Lock()
+		if !unit.IsAvailable {
+			am.untrackUnsafe(unit)
+		}
+		unit.IsAvailable = false
+		unit.ReservationID = res.RentalID
+		unit.ReservedAt = res.ReservedAt
+		am.trackUnsafe(unit)
+		sh.mu.Unlock()
+		count++
+	}
+	log.Printf("[Allocation] Restored %d persisted reservations", count)
+	return nil
+}
+
+// persistUnsafe saves a unit's current hold to the reservation store, if one is set,
+// then writes the unit through to the unit store. Only the reservation store can
+// reject the hold. Callers must hold the unit's shard lock.
+func (am *AllocationManager) persistUnsafe(unit *models.CollectibleUnit) error {
+	if store := am.reservationStore(); store != nil {
+		var reservedAt time.Time
+		if unit.ReservedAt != nil {
+			reservedAt = *unit.ReservedAt
+		}
+		if err := store.SaveReservation(unit.ID, unit.ReservationID, reservedAt); err != nil {
+			return err
+		}
+	}
+	am.writeUnitUnsafe(unit)
+	return nil
+}
+
+// forgetUnsafe removes a unit's hold from the reservation store, if one is set, and
+// writes its released state through to the unit store. Failures are logged; the
+// in-memory release has already happened. Callers must hold the unit's shard lock
+// and have already cleared the unit's hold fields.
+func (am *AllocationManager) forgetUnsafe(unit *models.CollectibleUnit) {
+	if store := am.reservationStore(); store != nil {
+		if err := store.DeleteReservation(unit.ID); err != nil {
+			log.Printf("[Allocation] Warning: Failed to delete persisted reservation for Unit %s: %v", unit.ID, err)
+		}
+	}
+	am.writeUnitUnsafe(unit)
+}
+
+// writeUnitUnsafe records a unit's availability in the unit store, if one is set.
+// Failures are logged. Callers must hold the unit's shard lock.
+func (am *AllocationManager) writeUnitUnsafe(unit *models.CollectibleUnit) {
+	store := am.unitStore()
+	if store == nil {
+		return
+	}
+	if err := store.UpdateUnitAvailability(unit); err != nil {
+		log.Printf("[Allocation] Warning: Failed to persist availability for Unit %s: %v", unit.ID, err)
 	}
 }
 
 // Allocate selects the best available unit for a customer
 // filtering by collectible type and finding the nearest warehouse.
-func (am *AllocationManager) Allocate(collectibleID string, storeID string) (*models.CollectibleUnit, int, error) {
-	am.mu.Lock()
-	defer am.mu.Unlock()
+// The reserved unit is stamped with rentalID as its ReservationID.
+// The returned distance is in km; use ETADays to turn it into an ETA.
+func (am *AllocationManager) Allocate(collectibleID string, storeID string, rentalID string) (*models.CollectibleUnit, int, error) {
+	units, distances, err := am.AllocateN(collectibleID, storeID, rentalID, 1)
+	if err != nil {
+		return nil, 0, err
+	}
+	return units[0], distances[0], nil
+}
 
-	log.Printf("[Allocation] Starting allocation for Collectible: %s at Store ID: %s", collectibleID, storeID)
+// AllocateN reserves qty distinct units of a collectible, nearest warehouse first.
+// It returns the reserved units along with each unit's distance (km) to the store.
+// Reservation is all-or-nothing: if fewer than qty units are available, nothing is reserved.
+func (am *AllocationManager) AllocateN(collectibleID string, storeID string, rentalID string, qty int) ([]*models.CollectibleUnit, []int, error) {
+	if qty < 1 {
+		return nil, nil, errors.New("quantity must be at least 1")
+	}
 
-	var bestUnit *models.CollectibleUnit
-	minDistance := math.MaxInt32
-	found := false
+	log.Printf("[Allocation] Starting allocation of %d unit(s) for Collectible: %s at Store ID: %s", qty, collectibleID, storeID)
 
-	// Iterate through all units to find candidates
-	for _, unit := range am.inventory {
-		// Filter 1: Must match the requested collectible type
-		if unit.CollectibleID != collectibleID {
-			continue
+	sh := am.shard(collectibleID)
+	if sh == nil {
+		log.Printf("[Allocation] Failed: No units stocked for Collectible %s", collectibleID)
+		return nil, nil, ErrOutOfStock
+	}
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	candidates := am.findCandidatesUnsafe(sh, storeID)
+	if len(candidates) < qty {
+		log.Printf("[Allocation] Failed: Only %d of %d requested units available for Collectible %s at Store %s", len(candidates), qty, collectibleID, storeID)
+		return nil, nil, shortageErrUnsafe(sh, qty)
+	}
+
+	units := make([]*models.CollectibleUnit, 0, qty)
+	distances := make([]int, 0, qty)
+	now := time.Now()
+	holdTimeout := am.HoldTimeout()
+
+	// Reservation: Mark as unavailable immediately with timestamp
+	for _, c := range candidates[:qty] {
+		c.unit.IsAvailable = false
+		reservedAt := now
+		c.unit.ReservedAt = &reservedAt
+		c.unit.ReservationID = rentalID
+		am.trackUnsafe(c.unit)
+
+		units = append(units, c.unit)
+		distances = append(distances, c.distance)
+
+		log.Printf("[Reservation] Temporary reservation created for Unit %s (Expires in %v)", c.unit.ID, holdTimeout)
+		log.Printf("[Allocation] Success: Allocated Unit %s from Warehouse %s (Distance: %d km)", c.unit.ID, c.unit.WarehouseID, c.distance)
+	}
+
+	// Persist the holds; if any fails (e.g. another instance holds the unit), undo them all
+	for i, unit := range units {
+		if err := am.persistUnsafe(unit); err != nil {
+			log.Printf("[Allocation] Failed to persist reservation for Unit %s: %v", unit.ID, err)
+			for j, reserved := range units {
+				am.untrackUnsafe(reserved)
+				reserved.IsAvailable = true
+				reserved.ReservedAt = nil
+				reserved.ReservationID = ""
+				if j < i {
+					am.forgetUnsafe(reserved)
+				}
+			}
+			return nil, nil, fmt.Errorf("failed to reserve unit: %w", err)
 		}
+	}
+
+	return units, distances, nil
+}
+
+// shortageErrUnsafe explains why fewer than qty units could be allocated to a store:
+// ErrStoreNotServed if the shard has enough available units elsewhere, otherwise
+// ErrOutOfStock. Callers must hold sh.mu.
+func shortageErrUnsafe(sh *collectibleShard, qty int) error {
+	available := 0
+	for _, unit := range sh.units {
+		if unit.IsAvailable {
+			available++
+		}
+	}
+	if available >= qty {
+		return ErrStoreNotServed
+	}
+	return ErrOutOfStock
+}
+
+// allocationCandidate is an available unit paired with its distance to the requested store
+type allocationCandidate struct {
+	unit     *models.CollectibleUnit
+	distance int
+}
 
-		// Filter 2: Must be available
+// findCandidatesUnsafe returns the shard's available units that can serve the store,
+// sorted nearest first. Ties between equally distant warehouses go to the one with
+// more available units, then to the lower warehouse ID, so allocation is reproducible.
+// Callers must hold sh.mu.
+func (am *AllocationManager) findCandidatesUnsafe(sh *collectibleShard, storeID string) []allocationCandidate {
+	candidates := make([]allocationCandidate, 0, len(sh.units))
+	stock := make(map[string]int)
+
+	for _, unit := range sh.units {
+		// Must be available
 		if !unit.IsAvailable {
 			log.Printf("[Allocation] Skipping Unit %s (Warehouse %s): Already reserved", unit.ID, unit.WarehouseID)
 			continue
 		}
 
 		// Find the warehouse for this unit
-		warehouse, exists := am.warehouses[unit.WarehouseID]
+		warehouse, exists := am.warehouse(unit.WarehouseID)
 		if !exists {
 			log.Printf("[Allocation] Critical Error: Unit %s linked to unknown Warehouse %s", unit.ID, unit.WarehouseID)
 			continue
@@ -71,39 +620,55 @@ func (am *AllocationManager) Allocate(collectibleID string, storeID string) (*mo
 		}
 		log.Printf("[Allocation] Candidate: Unit %s (Warehouse %s) - Distance: %d km", unit.ID, unit.WarehouseID, dist)
 
-		// Select if this is the closest valid option found so far
-		if dist < minDistance {
-			minDistance = dist
-			bestUnit = unit
-			found = true
-			log.Printf("[Allocation] -> New Best Candidate: %s", unit.ID)
-		}
+		candidates = append(candidates, allocationCandidate{unit: unit, distance: dist})
+		stock[unit.WarehouseID]++
 	}
 
-	if !found {
-		log.Printf("[Allocation] Failed: No available units found for Collectible %s", collectibleID)
-		return nil, 0, errors.New("no available units found for the selected collectible")
-	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i].unit, candidates[j].unit
+		if a.WarehouseID == b.WarehouseID {
+			return a.ID < b.ID
+		}
+		return warehouseBefore(
+			warehouseRank{id: a.WarehouseID, distance: candidates[i].distance, available: stock[a.WarehouseID]},
+			warehouseRank{id: b.WarehouseID, distance: candidates[j].distance, available: stock[b.WarehouseID]},
+		)
+	})
 
-	// Reservation: Mark as unavailable immediately with timestamp
-	bestUnit.IsAvailable = false
-	now := time.Now()
-	bestUnit.ReservedAt = &now
+	return candidates
+}
 
-	log.Printf("[Reservation] Temporary reservation created for Unit %s (Expires in 10m)", bestUnit.ID)
-	log.Printf("[Allocation] Success: Allocated Unit %s from Warehouse %s (Distance: %d km)", bestUnit.ID, bestUnit.WarehouseID, minDistance)
+// warehouseRank is what allocation compares warehouses by
+type warehouseRank struct {
+	id        string
+	distance  int
+	available int
+}
 
-	return bestUnit, minDistance, nil
+// warehouseBefore reports whether warehouse a should be allocated from before b:
+// nearest first, then the one with more available units, then the lower ID
+func warehouseBefore(a, b warehouseRank) bool {
+	if a.distance != b.distance {
+		return a.distance < b.distance
+	}
+	if a.available != b.available {
+		return a.available > b.available
+	}
+	return a.id < b.id
 }
 
 // GetTotalStock returns the number of available units for a collectible
 func (am *AllocationManager) GetTotalStock(collectibleID string) int {
-	am.mu.Lock()
-	defer am.mu.Unlock()
+	sh := am.shard(collectibleID)
+	if sh == nil {
+		return 0
+	}
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
 
 	count := 0
-	for _, unit := range am.inventory {
-		if unit.CollectibleID == collectibleID && unit.IsAvailable {
+	for _, unit := range sh.units {
+		if unit.IsAvailable {
 			count++
 		}
 	}
@@ -111,173 +676,495 @@ func (am *AllocationManager) GetTotalStock(collectibleID string) int {
 	return count
 }
 
+// StockAndETA is a collectible's available unit count and its ETA (in days) to a store.
+// ETA is 0 when no available unit can ship to the store.
+type StockAndETA struct {
+	Stock int
+	ETA   int
+}
+
+// GetStockAndETA returns GetTotalStock and GetETA for a collectible in one pass
+// over its units, taking its lock once
+func (am *AllocationManager) GetStockAndETA(collectibleID string, storeID string) StockAndETA {
+	sh := am.shard(collectibleID)
+	if sh == nil {
+		return StockAndETA{}
+	}
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	return stockAndETAUnsafe(sh, am.etaDaysTo(storeID))
+}
+
+// GetStockAndETAForAll returns stock and ETA to a store for every stocked collectible,
+// keyed by collectible ID, visiting each unit once. Collectibles without units are absent.
+func (am *AllocationManager) GetStockAndETAForAll(storeID string) map[string]StockAndETA {
+	etaDays := am.etaDaysTo(storeID)
+	shards := am.allShards()
+	results := make(map[string]StockAndETA, len(shards))
+	for collectibleID, sh := range shards {
+		sh.mu.Lock()
+		results[collectibleID] = stockAndETAUnsafe(sh, etaDays)
+		sh.mu.Unlock()
+	}
+	return results
+}
+
+// etaDaysTo maps each warehouse that serves a store to its ETA in days to it
+func (am *AllocationManager) etaDaysTo(storeID string) map[string]int {
+	am.warehousesMu.RLock()
+	defer am.warehousesMu.RUnlock()
+	etaDays := make(map[string]int, len(am.warehouses))
+	for id, wh := range am.warehouses {
+		if dist, ok := wh.Distances[storeID]; ok {
+			etaDays[id] = am.ETADays(dist)
+		}
+	}
+	return etaDays
+}
+
+// stockAndETAUnsafe counts a shard's available units and finds the soonest one, given
+// each serving warehouse's ETA in days to the store. Caller must hold sh.mu.
+func stockAndETAUnsafe(sh *collectibleShard, etaDays map[string]int) StockAndETA {
+	var result StockAndETA
+	minETA := math.MaxInt32
+	for _, unit := range sh.units {
+		if !unit.IsAvailable {
+			continue
+		}
+		result.Stock++
+
+		if eta, ok := etaDays[unit.WarehouseID]; ok && eta < minETA {
+			minETA = eta
+		}
+	}
+	if minETA != math.MaxInt32 {
+		result.ETA = minETA
+	}
+	return result
+}
+
+// CountAvailable returns the number of available units per collectible
+func (am *AllocationManager) CountAvailable() map[string]int {
+	return am.countUnits(true)
+}
+
+// CountReserved returns the number of reserved units (pending or confirmed) per collectible
+func (am *AllocationManager) CountReserved() map[string]int {
+	return am.countUnits(false)
+}
+
+// countUnits tallies units per collectible whose availability matches available
+func (am *AllocationManager) countUnits(available bool) map[string]int {
+	shards := am.allShards()
+	counts := make(map[string]int, len(shards))
+	for collectibleID, sh := range shards {
+		sh.mu.Lock()
+		counts[collectibleID] = 0
+		for _, unit := range sh.units {
+			if unit.IsAvailable == available {
+				counts[collectibleID]++
+			}
+		}
+		sh.mu.Unlock()
+	}
+	return counts
+}
+
+// GetStockDetails returns per-warehouse availability of a collectible for a store, nearest first
+// with ties broken as in Allocate.
+// Warehouses that don't serve the store or have no available units are omitted.
+func (am *AllocationManager) GetStockDetails(collectibleID string, storeID string) []models.WarehouseOption {
+	sh := am.shard(collectibleID)
+	if sh == nil {
+		return []models.WarehouseOption{}
+	}
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	byWarehouse := make(map[string]*models.WarehouseOption)
+	details := []models.WarehouseOption{}
+	var order []string
+	for _, unit := range sh.units {
+		if !unit.IsAvailable {
+			continue
+		}
+		warehouse, _ := am.warehouse(unit.WarehouseID)
+		dist, ok := warehouse.Distances[storeID]
+		if !ok {
+			continue
+		}
+		d, seen := byWarehouse[unit.WarehouseID]
+		if !seen {
+			d = &models.WarehouseOption{WarehouseID: unit.WarehouseID, Distance: dist, ETADays: am.ETADays(dist)}
+			byWarehouse[unit.WarehouseID] = d
+			order = append(order, unit.WarehouseID)
+		}
+		d.Available++
+	}
+
+	for _, id := range order {
+		details = append(details, *byWarehouse[id])
+	}
+	// Same order Allocate draws from
+	sort.Slice(details, func(i, j int) bool {
+		return warehouseBefore(
+			warehouseRank{id: details[i].WarehouseID, distance: details[i].Distance, available: details[i].Available},
+			warehouseRank{id: details[j].WarehouseID, distance: details[j].Distance, available: details[j].Available},
+		)
+	})
+	return details
+}
+
 // InventorySnapshot represents a snapshot of inventory for admin
 type InventorySnapshot struct {
+	UnitID        string     `json:"unit_id"`
 	CollectibleID string     `json:"collectible_id"`
 	WarehouseID   string     `json:"warehouse_id"`
 	IsAvailable   bool       `json:"is_available"`
+	RentalID      string     `json:"rental_id,omitempty"`
 	ReservedAt    *time.Time `json:"reserved_at,omitempty"`
 }
 
 // GetAllInventory returns the full state of inventory
 func (am *AllocationManager) GetAllInventory() []InventorySnapshot {
-	am.mu.Lock()
-	defer am.mu.Unlock()
-
 	var snapshot []InventorySnapshot
-	for _, unit := range am.inventory {
-		snapshot = append(snapshot, InventorySnapshot{
-			CollectibleID: unit.CollectibleID,
-			WarehouseID:   unit.WarehouseID,
-			IsAvailable:   unit.IsAvailable,
-			ReservedAt:    unit.ReservedAt,
-		})
+	for _, unit := range am.allUnits() {
+		sh := am.shard(unit.CollectibleID)
+		sh.mu.Lock()
+		snapshot = append(snapshot, snapshotUnsafe(unit))
+		sh.mu.Unlock()
 	}
 	return snapshot
 }
 
-// ConfirmReservation marks a unit as permanently reserved (paid), preventing auto-cleanup
-func (am *AllocationManager) ConfirmReservation(collectibleID string, warehouseID string) error {
-	am.mu.Lock()
-	defer am.mu.Unlock()
+// GetReservedUnits returns every unit currently held by a rental, pending or confirmed
+func (am *AllocationManager) GetReservedUnits() []InventorySnapshot {
+	reserved := []InventorySnapshot{}
+	for _, unit := range am.allUnits() {
+		sh := am.shard(unit.CollectibleID)
+		sh.mu.Lock()
+		if !unit.IsAvailable {
+			reserved = append(reserved, snapshotUnsafe(unit))
+		}
+		sh.mu.Unlock()
+	}
+	return reserved
+}
 
-	for _, unit := range am.inventory {
-		if unit.CollectibleID == collectibleID && unit.WarehouseID == warehouseID && !unit.IsAvailable {
-			// Clear the reservation timestamp so cleanup job ignores it
+// GetUnit returns a snapshot of a single unit, or false if no unit has that ID
+func (am *AllocationManager) GetUnit(unitID string) (InventorySnapshot, bool) {
+	unit, ok := am.unit(unitID)
+	if !ok {
+		return InventorySnapshot{}, false
+	}
+	sh := am.shard(unit.CollectibleID)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	return snapshotUnsafe(unit), true
+}
+
+// snapshotUnsafe copies a unit's state. Caller must hold the unit's shard lock.
+func snapshotUnsafe(unit *models.CollectibleUnit) InventorySnapshot {
+	return InventorySnapshot{
+		UnitID:        unit.ID,
+		CollectibleID: unit.CollectibleID,
+		WarehouseID:   unit.WarehouseID,
+		IsAvailable:   unit.IsAvailable,
+		RentalID:      unit.ReservationID,
+		ReservedAt:    unit.ReservedAt,
+	}
+}
+
+// ConfirmAllocation commits the unit held for rentalID once its payment succeeds.
+// In AllocationModeSoftHold, if the soft hold already lapsed, the nearest available unit
+// for the store is allocated instead. It returns the confirmed unit and its distance (km) to the store.
+func (am *AllocationManager) ConfirmAllocation(rentalID string, collectibleID string, storeID string) (*models.CollectibleUnit, int, error) {
+	sh := am.shard(collectibleID)
+	if sh == nil {
+		return nil, 0, errors.New("no reservation found for rental")
+	}
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	for _, unit := range sh.units {
+		if unit.ReservationID == rentalID && !unit.IsAvailable {
 			unit.ReservedAt = nil
+			if err := am.persistUnsafe(unit); err != nil {
+				log.Printf("[Allocation] Warning: Failed to persist confirmation for Unit %s: %v", unit.ID, err)
+			}
 			log.Printf("[Allocation] Confirmed reservation for Unit %s (Permanent Lock)", unit.ID)
-			return nil
+			warehouse, _ := am.warehouse(unit.WarehouseID)
+			return unit, warehouse.Distances[storeID], nil
 		}
 	}
-	return errors.New("unit not found or already available")
+
+	if am.AllocationMode() != AllocationModeSoftHold {
+		return nil, 0, errors.New("no reservation found for rental")
+	}
+
+	candidates := am.findCandidatesUnsafe(sh, storeID)
+	if len(candidates) == 0 {
+		log.Printf("[Allocation] Soft hold for rental %s lapsed and no units remain for Collectible %s", rentalID, collectibleID)
+		return nil, 0, shortageErrUnsafe(sh, 1)
+	}
+
+	c := candidates[0]
+	c.unit.IsAvailable = false
+	c.unit.ReservedAt = nil
+	c.unit.ReservationID = rentalID
+	if err := am.persistUnsafe(c.unit); err != nil {
+		c.unit.IsAvailable = true
+		c.unit.ReservationID = ""
+		return nil, 0, fmt.Errorf("failed to reserve unit: %w", err)
+	}
+	am.trackUnsafe(c.unit)
+	log.Printf("[Allocation] Soft hold for rental %s lapsed; allocated Unit %s from Warehouse %s on payment", rentalID, c.unit.ID, c.unit.WarehouseID)
+	return c.unit, c.distance, nil
 }
 
-// GetETA calculates the estimated delivery time (minimum distance) for a collectible to a store
-func (am *AllocationManager) GetETA(collectibleID string, storeID string) (int, error) {
-	am.mu.Lock()
-	defer am.mu.Unlock()
+// PreviewAllocation reports which warehouse Allocate would draw a unit of the collectible
+// from for a store, and the ETA in days from it, without reserving anything
+func (am *AllocationManager) PreviewAllocation(collectibleID string, storeID string) (string, int, error) {
+	sh := am.shard(collectibleID)
+	if sh == nil {
+		return "", 0, ErrOutOfStock
+	}
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	candidates := am.findCandidatesUnsafe(sh, storeID)
+	if len(candidates) == 0 {
+		return "", 0, shortageErrUnsafe(sh, 1)
+	}
 
-	minDistance := math.MaxInt32
-	found := false
+	c := candidates[0]
+	eta := am.ETADays(c.distance)
+	log.Printf("[Allocation] Preview for %s at Store %s: Warehouse %s, %d days (%d km)", collectibleID, storeID, c.unit.WarehouseID, eta, c.distance)
+	return c.unit.WarehouseID, eta, nil
+}
 
-	for _, unit := range am.inventory {
-		// Filter: Must be correct type and available
-		if unit.CollectibleID != collectibleID || !unit.IsAvailable {
-			continue
-		}
+// GetETA returns the delivery ETA in days from the warehouse Allocate would use
+// for a store (see PreviewAllocation)
+func (am *AllocationManager) GetETA(collectibleID string, storeID string) (int, error) {
+	_, eta, err := am.PreviewAllocation(collectibleID, storeID)
+	if err != nil {
+		log.Printf("[Allocation] ETA query failed for %s: %v", collectibleID, err)
+		return 0, err
+	}
+	return eta, nil
+}
 
-		warehouse, exists := am.warehouses[unit.WarehouseID]
-		if !exists {
-			continue
+// ReleaseUnit returns a specific reserved unit to inventory, e.g. when an admin frees a
+// stuck hold. Rental flows should use ReleaseByRentalID so they only free their own unit.
+func (am *AllocationManager) ReleaseUnit(unitID string) error {
+	if unit, ok := am.unit(unitID); ok {
+		released := false
+		sh := am.shard(unit.CollectibleID)
+		sh.mu.Lock()
+		if !unit.IsAvailable {
+			am.releaseUnsafe(unit)
+			log.Printf("[Allocation] Released Unit %s from Warehouse %s back to inventory", unit.ID, unit.WarehouseID)
+			released = true
 		}
+		sh.mu.Unlock()
 
-		dist, ok := warehouse.Distances[storeID]
-		if !ok {
-			continue
+		if released {
+			am.notifyReleased(unit.CollectibleID)
+			return nil
 		}
+	}
+
+	log.Printf("[Allocation] Warning: Could not find reserved Unit %s", unitID)
+	return errors.New("unit not found or already available")
+}
 
-		if dist < minDistance {
-			minDistance = dist
-			found = true
+// ReleaseByRentalID returns every unit held for rentalID to inventory. Unlike ReleaseUnit it
+// never frees a unit held by another rental of the same collectible and warehouse.
+func (am *AllocationManager) ReleaseByRentalID(rentalID string) error {
+	var released []string // Collectible ID per released unit
+	for _, unit := range am.reservedUnits(rentalID) {
+		sh := am.shard(unit.CollectibleID)
+		sh.mu.Lock()
+		// The unit may have been released or re-reserved since the index was read
+		if !unit.IsAvailable && unit.ReservationID == rentalID {
+			am.releaseUnsafe(unit)
+			released = append(released, unit.CollectibleID)
+			log.Printf("[Allocation] Released Unit %s held for rental %s back to inventory", unit.ID, rentalID)
 		}
+		sh.mu.Unlock()
 	}
 
-	if !found {
-		log.Printf("[Allocation] ETA query failed for %s: no units available", collectibleID)
-		return 0, errors.New("no units available for ETA calculation")
+	if len(released) == 0 {
+		log.Printf("[Allocation] Warning: No reserved unit found for rental %s", rentalID)
+		return ErrReservationNotFound
 	}
+	for _, collectibleID := range released {
+		am.notifyReleased(collectibleID)
+	}
+	return nil
+}
 
-	log.Printf("[Allocation] ETA query for %s at Store %s: %d days", collectibleID, storeID, minDistance)
-	return minDistance, nil
+// releaseUnsafe puts a unit back into stock and drops its hold.
+// Callers must hold the unit's shard lock.
+func (am *AllocationManager) releaseUnsafe(unit *models.CollectibleUnit) {
+	am.untrackUnsafe(unit)
+	unit.IsAvailable = true
+	unit.ReservedAt = nil
+	unit.ReservationID = ""
+	am.forgetUnsafe(unit)
 }
 
-// ReleaseUnit marks a unit as available again (e.g., when payment fails or is cancelled)
-func (am *AllocationManager) ReleaseUnit(collectibleID string, warehouseID string) error {
-	am.mu.Lock()
-	defer am.mu.Unlock()
+// ExtendReservation restarts the hold timeout on the unit reserved for rentalID by
+// re-stamping its ReservedAt to now. Holds that have already lapsed are not revived.
+func (am *AllocationManager) ExtendReservation(rentalID string) error {
+	now := time.Now()
+	cutoff := now.Add(-am.HoldTimeout())
 
-	for _, unit := range am.inventory {
-		if unit.CollectibleID == collectibleID && unit.WarehouseID == warehouseID && !unit.IsAvailable {
-			unit.IsAvailable = true
-			log.Printf("[Allocation] Released Unit %s from Warehouse %s back to inventory", unit.ID, warehouseID)
-			return nil
-		}
+	units := am.reservedUnits(rentalID)
+	if len(units) == 0 {
+		log.Printf("[Reservation] Cannot extend hold for rental %s: no reserved unit found", rentalID)
+		return ErrReservationNotFound
 	}
 
-	log.Printf("[Allocation] Warning: Could not find unavailable unit for Collectible %s at Warehouse %s", collectibleID, warehouseID)
-	return errors.New("unit not found or already available")
+	for _, unit := range units {
+		if err := am.extendUnit(unit, rentalID, now, cutoff); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// CleanupExpiredReservations releases units that have been reserved longer than the timeout
-func (am *AllocationManager) CleanupExpiredReservations(timeout time.Duration) {
-	am.mu.Lock()
-	defer am.mu.Unlock()
+// extendUnit re-stamps one unit's hold for rentalID, provided it is still unexpired
+func (am *AllocationManager) extendUnit(unit *models.CollectibleUnit, rentalID string, now, cutoff time.Time) error {
+	sh := am.shard(unit.CollectibleID)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
 
-	cutoff := time.Now().Add(-timeout)
-	count := 0
+	// Confirmed units have no timeout; lapsed ones are left for the cleanup job
+	if unit.IsAvailable || unit.ReservationID != rentalID || unit.ReservedAt == nil || unit.ReservedAt.Before(cutoff) {
+		log.Printf("[Reservation] Cannot extend hold for rental %s: Unit %s is not in an active hold", rentalID, unit.ID)
+		return ErrReservationNotFound
+	}
+
+	previous := unit.ReservedAt
+	reservedAt := now
+	unit.ReservedAt = &reservedAt
+	if err := am.persistUnsafe(unit); err != nil {
+		unit.ReservedAt = previous
+		return fmt.Errorf("failed to extend reservation: %w", err)
+	}
+	log.Printf("[Reservation] Extended hold on Unit %s for rental %s", unit.ID, rentalID)
+	return nil
+}
+
+// CleanupExpiredReservations releases units that have been held longer than the reservation
+// timeout, or the soft-hold TTL in AllocationModeSoftHold
+func (am *AllocationManager) CleanupExpiredReservations() {
+	cutoff := time.Now().Add(-am.HoldTimeout())
+	var released []string // Collectible ID per released unit
 
-	for _, unit := range am.inventory {
-		if !unit.IsAvailable && unit.ReservedAt != nil {
-			if unit.ReservedAt.Before(cutoff) {
-				unit.IsAvailable = true
-				unit.ReservedAt = nil
-				unit.ReservationID = ""
-				count++
-				log.Printf("[Cleanup] Released expired reservation for unit %s", unit.ID)
+	for _, sh := range am.allShards() {
+		sh.mu.Lock()
+		for _, unit := range sh.units {
+			if !unit.IsAvailable && unit.ReservedAt != nil {
+				if unit.ReservedAt.Before(cutoff) {
+					am.releaseUnsafe(unit)
+					released = append(released, unit.CollectibleID)
+					log.Printf("[Cleanup] Released expired reservation for unit %s", unit.ID)
+				}
 			}
 		}
+		sh.mu.Unlock()
+	}
+	if len(released) > 0 {
+		log.Printf("[Cleanup] Released %d expired reservations", len(released))
 	}
-	if count > 0 {
-		log.Printf("[Cleanup] Released %d expired reservations", count)
+
+	for _, collectibleID := range released {
+		am.notifyReleased(collectibleID)
 	}
 }
 
-// SyncInventory updates the in-memory inventory based on active rentals from the database
+// SyncInventory updates the in-memory inventory based on active rentals from the database.
+// Each pending or completed rental claims one available unit matching its collectible and
+// warehouse, which is stamped with the rental ID so it cannot be allocated twice after a restart.
 func (am *AllocationManager) SyncInventory(activeRentals []*models.Rental) {
-	am.mu.Lock()
-	defer am.mu.Unlock()
-
 	log.Printf("[Allocation] Syncing inventory with %d active rentals...", len(activeRentals))
 	count := 0
 
 	for _, rental := range activeRentals {
 		// Only sync valid active states
-		if rental.PaymentStatus == models.PaymentFailed {
+		if rental.PaymentStatus != models.PaymentPending && rental.PaymentStatus != models.PaymentCompleted {
 			continue
 		}
+		// Returned rentals have already given their unit back
+		if rental.Status == models.RentalReturned {
+			continue
+		}
+
+		sh := am.shard(rental.CollectibleID)
+		if sh == nil {
+			continue
+		}
+		sh.mu.Lock()
+		if am.syncRentalUnsafe(sh, rental) {
+			count++
+		}
+		sh.mu.Unlock()
+	}
+	log.Printf("[Allocation] Sync completed. Marked %d units as reserved.", count)
+}
 
-		// Find the unit
-		for _, unit := range am.inventory {
-			if unit.CollectibleID == rental.CollectibleID && unit.WarehouseID == rental.WarehouseID {
-				if unit.IsAvailable {
-					unit.IsAvailable = false
-					count++
+// syncRentalUnsafe claims an available unit in the shard for a rental, unless the rental
+// already holds one (e.g. restored from the reservation store). Callers must hold sh.mu.
+func (am *AllocationManager) syncRentalUnsafe(sh *collectibleShard, rental *models.Rental) bool {
+	for _, unit := range sh.units {
+		if unit.ReservationID == rental.ID && !unit.IsAvailable {
+			return false
+		}
+	}
 
-					// If pending, give it a timestamp so it can expire if abandoned
-					// If completed, leave timestamp nil (permanent lock)
-					if rental.PaymentStatus == models.PaymentPending {
+	// Find an available unit for this rental
+	for _, unit := range sh.units {
+		if unit.WarehouseID != rental.WarehouseID || !unit.IsAvailable {
+			continue
+		}
 
-						now := time.Now()
-						unit.ReservedAt = &now
-					} else {
-						unit.ReservedAt = nil // Permanent
-					}
-					// log.Printf("[Sync] Reserved Unit %s for Rental %s (%s)", unit.ID, rental.ID, rental.PaymentStatus)
-				}
-				break
-			}
+		unit.IsAvailable = false
+		unit.ReservationID = rental.ID
+		am.trackUnsafe(unit)
+
+		// If pending, give it a timestamp so it can expire if abandoned
+		// If completed, leave timestamp nil (permanent lock)
+		if rental.PaymentStatus == models.PaymentPending {
+			now := time.Now()
+			unit.ReservedAt = &now
+		} else {
+			unit.ReservedAt = nil // Permanent
 		}
+		if err := am.persistUnsafe(unit); err != nil {
+			log.Printf("[Allocation] Warning: Failed to persist synced reservation for Unit %s: %v", unit.ID, err)
+		}
+		return true
 	}
-	log.Printf("[Allocation] Sync completed. Market %d units as reserved.", count)
+	return false
 }
 
-// StartCleanupJob starts a background goroutine to clean up expired reservations
-func (am *AllocationManager) StartCleanupJob(interval time.Duration, timeout time.Duration) {
+// StartCleanupJob starts a background goroutine to clean up expired reservations.
+// The job stops when ctx is cancelled.
+func (am *AllocationManager) StartCleanupJob(ctx context.Context, interval time.Duration) {
 	ticker := time.NewTicker(interval)
 	go func() {
-		for range ticker.C {
-			am.CleanupExpiredReservations(timeout)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				log.Println("[Allocation] Cleanup job stopped")
+				return
+			case <-ticker.C:
+				am.CleanupExpiredReservations()
+			}
 		}
 	}()
-	log.Printf("[Allocation] Started cleanup job (Interval: %v, Timeout: %v)", interval, timeout)
+	log.Printf("[Allocation] Started cleanup job (Interval: %v, Timeout: %v)", interval, am.ReservationTimeout())
 }
@@ -1,7 +1,11 @@
 package services
 
 import (
+	"errors"
+	"fmt"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/mongocollectibles/rental-system/models"
 )
@@ -28,7 +32,7 @@ func TestAllocationManager_Allocate(t *testing.T) {
 	t.Run("Allocate nearest available", func(t *testing.T) {
 		// Store S1: W2 (dist 5) is closer than W1 (dist 10)
 		// Should pick U2
-		got, _, err := am.Allocate("C1", "S1")
+		got, _, err := am.Allocate("C1", "S1", "R1")
 		if err != nil {
 			t.Fatalf("Allocate failed: %v", err)
 		}
@@ -43,19 +47,77 @@ func TestAllocationManager_Allocate(t *testing.T) {
 	t.Run("No available units (all booked or wrong type)", func(t *testing.T) {
 		// Try allocating C2. Only U3 exists.
 		// Let's allocate U3 first to make it unavailable.
-		_, _, _ = am.Allocate("C2", "S1")
+		_, _, _ = am.Allocate("C2", "S1", "R2")
 
 		// Now try allocating C2 again
-		_, _, err := am.Allocate("C2", "S1")
-		if err == nil {
-			t.Error("Expected error for no available units, got nil")
+		_, _, err := am.Allocate("C2", "S1", "R3")
+		if !errors.Is(err, ErrOutOfStock) {
+			t.Errorf("Expected ErrOutOfStock for no available units, got %v", err)
 		}
 	})
 
 	t.Run("Unknown store ID", func(t *testing.T) {
-		_, _, err := am.Allocate("C1", "UNKNOWN")
-		if err == nil {
-			t.Error("Expected error for unknown store ID, got nil")
+		// U1 is still available, it just can't ship to this store
+		_, _, err := am.Allocate("C1", "UNKNOWN", "R4")
+		if !errors.Is(err, ErrStoreNotServed) {
+			t.Errorf("Expected ErrStoreNotServed for unknown store ID, got %v", err)
+		}
+	})
+
+	t.Run("Collectible without units", func(t *testing.T) {
+		if _, _, err := am.Allocate("C9", "S1", "R5"); !errors.Is(err, ErrOutOfStock) {
+			t.Errorf("Expected ErrOutOfStock, got %v", err)
+		}
+	})
+}
+
+func TestAllocationManager_AllocateN(t *testing.T) {
+	// W1: S1:10, W2: S1:5, W3: S1:1
+	warehouses := []models.WarehouseNode{
+		{ID: "1", Distances: map[string]int{"S1": 10}},
+		{ID: "2", Distances: map[string]int{"S1": 5}},
+		{ID: "3", Distances: map[string]int{"S1": 1}},
+	}
+
+	units := []*models.CollectibleUnit{
+		{ID: "U1", CollectibleID: "C1", WarehouseID: "1", IsAvailable: true},
+		{ID: "U2", CollectibleID: "C1", WarehouseID: "2", IsAvailable: true},
+		{ID: "U3", CollectibleID: "C1", WarehouseID: "3", IsAvailable: true},
+	}
+
+	am := NewAllocationManager(units, warehouses)
+
+	t.Run("Reserves nearest units first", func(t *testing.T) {
+		got, dists, err := am.AllocateN("C1", "S1", "R1", 2)
+		if err != nil {
+			t.Fatalf("AllocateN failed: %v", err)
+		}
+		if len(got) != 2 || got[0].ID != "U3" || got[1].ID != "U2" {
+			t.Fatalf("Expected units [U3 U2], got %v", got)
+		}
+		if dists[0] != 1 || dists[1] != 5 {
+			t.Errorf("Expected distances [1 5], got %v", dists)
+		}
+		for _, u := range got {
+			if u.IsAvailable || u.ReservationID != "R1" {
+				t.Errorf("Unit %s should be reserved for R1", u.ID)
+			}
+		}
+	})
+
+	t.Run("Insufficient stock reserves nothing", func(t *testing.T) {
+		// Only U1 remains
+		if _, _, err := am.AllocateN("C1", "S1", "R2", 2); err == nil {
+			t.Fatal("Expected error when requesting more units than available")
+		}
+		if stock := am.GetTotalStock("C1"); stock != 1 {
+			t.Errorf("Expected stock to remain 1 after failed allocation, got %d", stock)
+		}
+	})
+
+	t.Run("Rejects non-positive quantity", func(t *testing.T) {
+		if _, _, err := am.AllocateN("C1", "S1", "R3", 0); err == nil {
+			t.Error("Expected error for zero quantity")
 		}
 	})
 }
@@ -78,6 +140,8 @@ func TestAllocationManager_StockAndETA(t *testing.T) {
 	}
 
 	am := NewAllocationManager(units, warehouses)
+	// One handling day, then a day per 5 km: 1 km -> 2 days, 5 and 10 km -> 3, 20 km -> 5
+	am.SetETAConversion(5, 1)
 
 	t.Run("GetTotalStock", func(t *testing.T) {
 		// C1: U1, U2 available (2)
@@ -96,23 +160,23 @@ func TestAllocationManager_StockAndETA(t *testing.T) {
 
 	t.Run("GetETA", func(t *testing.T) {
 		// C1 at Store S1
-		// Available: U1(W1, dist 1), U2(W2, dist 5) -> Min 1
-		dist, err := am.GetETA("C1", "S1")
+		// Available: U1(W1, dist 1), U2(W2, dist 5) -> Min 1 km, 2 days
+		eta, err := am.GetETA("C1", "S1")
 		if err != nil {
 			t.Fatalf("GetETA failed: %v", err)
 		}
-		if dist != 1 {
-			t.Errorf("Expected ETA 1, got %d", dist)
+		if eta != 2 {
+			t.Errorf("Expected ETA 2, got %d", eta)
 		}
 
 		// C1 at Store S2
-		// Available: U1(W1, dist 10), U2(W2, dist 20) -> Min 10
-		dist, err = am.GetETA("C1", "S2")
+		// Available: U1(W1, dist 10), U2(W2, dist 20) -> Min 10 km, 3 days
+		eta, err = am.GetETA("C1", "S2")
 		if err != nil {
 			t.Fatalf("GetETA failed: %v", err)
 		}
-		if dist != 10 {
-			t.Errorf("Expected ETA 10, got %d", dist)
+		if eta != 3 {
+			t.Errorf("Expected ETA 3, got %d", eta)
 		}
 
 		// Invalid Collectible
@@ -121,4 +185,786 @@ func TestAllocationManager_StockAndETA(t *testing.T) {
 			t.Error("Expected error for ETA on missing collectible")
 		}
 	})
+
+	t.Run("Batch matches single lookups", func(t *testing.T) {
+		all := am.GetStockAndETAForAll("S2")
+		want := map[string]StockAndETA{"C1": {Stock: 2, ETA: 3}, "C2": {Stock: 1, ETA: 3}}
+		if len(all) != len(want) {
+			t.Fatalf("Expected %v, got %v", want, all)
+		}
+		for id, w := range want {
+			if all[id] != w {
+				t.Errorf("GetStockAndETAForAll[%s] = %+v, want %+v", id, all[id], w)
+			}
+			if got := am.GetStockAndETA(id, "S2"); got != w {
+				t.Errorf("GetStockAndETA(%s) = %+v, want %+v", id, got, w)
+			}
+		}
+		// Unknown collectibles have no stock and no ETA
+		if got := am.GetStockAndETA("C3", "S1"); got != (StockAndETA{}) {
+			t.Errorf("Expected zero value for C3, got %+v", got)
+		}
+	})
+}
+
+func TestAllocationManager_ReservationTimeout(t *testing.T) {
+	warehouses := []models.WarehouseNode{
+		{ID: "1", Distances: map[string]int{"S1": 1}},
+	}
+	units := []*models.CollectibleUnit{
+		{ID: "U1", CollectibleID: "C1", WarehouseID: "1", IsAvailable: true},
+	}
+
+	am := NewAllocationManager(units, warehouses)
+
+	if got := am.ReservationTimeout(); got != DefaultReservationTimeout {
+		t.Fatalf("Expected default timeout %v, got %v", DefaultReservationTimeout, got)
+	}
+
+	// Non-positive values keep the current timeout
+	am.SetReservationTimeout(0)
+	if got := am.ReservationTimeout(); got != DefaultReservationTimeout {
+		t.Errorf("Expected timeout to stay %v, got %v", DefaultReservationTimeout, got)
+	}
+
+	if _, _, err := am.Allocate("C1", "S1", "R1"); err != nil {
+		t.Fatalf("Allocate failed: %v", err)
+	}
+
+	// Default timeout: a fresh reservation must survive cleanup
+	am.CleanupExpiredReservations()
+	if am.GetTotalStock("C1") != 0 {
+		t.Fatal("Reservation should not expire under the default timeout")
+	}
+
+	// Backdate the reservation past a short configured timeout
+	am.SetReservationTimeout(30 * time.Second)
+	past := time.Now().Add(-time.Minute)
+	units[0].ReservedAt = &past
+
+	am.CleanupExpiredReservations()
+	if am.GetTotalStock("C1") != 1 {
+		t.Error("Expected reservation to be released after configured timeout")
+	}
+}
+
+func TestAllocationManager_ExtendReservation(t *testing.T) {
+	warehouses := []models.WarehouseNode{
+		{ID: "1", Distances: map[string]int{"S1": 1}},
+	}
+	units := []*models.CollectibleUnit{
+		{ID: "U1", CollectibleID: "C1", WarehouseID: "1", IsAvailable: true},
+	}
+
+	am := NewAllocationManager(units, warehouses)
+	am.SetReservationTimeout(30 * time.Second)
+	if _, _, err := am.Allocate("C1", "S1", "R1"); err != nil {
+		t.Fatalf("Allocate failed: %v", err)
+	}
+
+	// A hold nearing its timeout is pushed back out
+	nearlyExpired := time.Now().Add(-20 * time.Second)
+	units[0].ReservedAt = &nearlyExpired
+	if err := am.ExtendReservation("R1"); err != nil {
+		t.Fatalf("ExtendReservation failed: %v", err)
+	}
+	if !units[0].ReservedAt.After(nearlyExpired) {
+		t.Error("Expected ReservedAt to be re-stamped")
+	}
+	am.CleanupExpiredReservations()
+	if am.GetTotalStock("C1") != 0 {
+		t.Error("Extended reservation should survive cleanup")
+	}
+
+	if err := am.ExtendReservation("unknown"); !errors.Is(err, ErrReservationNotFound) {
+		t.Errorf("Expected ErrReservationNotFound for unknown rental, got %v", err)
+	}
+
+	// A lapsed hold is not revived, even before cleanup runs
+	past := time.Now().Add(-time.Minute)
+	units[0].ReservedAt = &past
+	if err := am.ExtendReservation("R1"); !errors.Is(err, ErrReservationNotFound) {
+		t.Errorf("Expected ErrReservationNotFound for lapsed hold, got %v", err)
+	}
+	if !units[0].ReservedAt.Equal(past) {
+		t.Error("Lapsed hold should keep its original timestamp")
+	}
+
+	// Released units have nothing to extend
+	am.CleanupExpiredReservations()
+	if err := am.ExtendReservation("R1"); !errors.Is(err, ErrReservationNotFound) {
+		t.Errorf("Expected ErrReservationNotFound after release, got %v", err)
+	}
+}
+
+func TestAllocationManager_ReleaseByRentalID(t *testing.T) {
+	warehouses := []models.WarehouseNode{
+		{ID: "1", Distances: map[string]int{"S1": 1}},
+	}
+	// Two copies of the same collectible in one warehouse
+	units := []*models.CollectibleUnit{
+		{ID: "U1", CollectibleID: "C1", WarehouseID: "1", IsAvailable: true},
+		{ID: "U2", CollectibleID: "C1", WarehouseID: "1", IsAvailable: true},
+	}
+
+	am := NewAllocationManager(units, warehouses)
+	first, _, _ := am.Allocate("C1", "S1", "R1")
+	second, _, _ := am.Allocate("C1", "S1", "R2")
+
+	if err := am.ReleaseByRentalID("R2"); err != nil {
+		t.Fatalf("ReleaseByRentalID failed: %v", err)
+	}
+	if !second.IsAvailable || second.ReservationID != "" || second.ReservedAt != nil {
+		t.Errorf("Expected R2's unit to be released, got %+v", second)
+	}
+	if first.IsAvailable || first.ReservationID != "R1" {
+		t.Errorf("R1's unit should still be held, got %+v", first)
+	}
+
+	// Releasing twice finds nothing to release
+	if err := am.ReleaseByRentalID("R2"); !errors.Is(err, ErrReservationNotFound) {
+		t.Errorf("Expected ErrReservationNotFound on second release, got %v", err)
+	}
+
+	// Expired holds drop out of the index
+	past := time.Now().Add(-time.Hour)
+	first.ReservedAt = &past
+	am.CleanupExpiredReservations()
+	if err := am.ReleaseByRentalID("R1"); !errors.Is(err, ErrReservationNotFound) {
+		t.Errorf("Expected ErrReservationNotFound after cleanup, got %v", err)
+	}
+}
+
+func TestAllocationManager_ReleaseUnit_SameWarehouse(t *testing.T) {
+	warehouses := []models.WarehouseNode{
+		{ID: "1", Distances: map[string]int{"S1": 1}},
+	}
+	// Two copies of the same collectible in one warehouse
+	units := []*models.CollectibleUnit{
+		{ID: "U1", CollectibleID: "C1", WarehouseID: "1", IsAvailable: true},
+		{ID: "U2", CollectibleID: "C1", WarehouseID: "1", IsAvailable: true},
+	}
+
+	am := NewAllocationManager(units, warehouses)
+	first, _, _ := am.Allocate("C1", "S1", "R1")
+	second, _, _ := am.Allocate("C1", "S1", "R2")
+
+	// Releasing the second unit must leave the first rental's hold alone
+	if err := am.ReleaseUnit(second.ID); err != nil {
+		t.Fatalf("ReleaseUnit failed: %v", err)
+	}
+	if !second.IsAvailable || second.ReservationID != "" {
+		t.Errorf("Expected %s to be released, got %+v", second.ID, second)
+	}
+	if first.IsAvailable || first.ReservationID != "R1" {
+		t.Errorf("Expected %s to stay held for R1, got %+v", first.ID, first)
+	}
+
+	if err := am.ReleaseUnit(second.ID); err == nil {
+		t.Error("Expected an error releasing an available unit")
+	}
+	if err := am.ReleaseUnit("missing"); err == nil {
+		t.Error("Expected an error releasing an unknown unit")
+	}
+
+	// The released unit is no longer indexed under its old rental
+	if err := am.ReleaseByRentalID("R2"); !errors.Is(err, ErrReservationNotFound) {
+		t.Errorf("Expected ErrReservationNotFound for R2, got %v", err)
+	}
+}
+
+func TestAllocationManager_SyncInventory(t *testing.T) {
+	warehouses := []models.WarehouseNode{
+		{ID: "1", Distances: map[string]int{"S1": 1}},
+		{ID: "2", Distances: map[string]int{"S1": 2}},
+	}
+	units := []*models.CollectibleUnit{
+		{ID: "U1", CollectibleID: "C1", WarehouseID: "1", IsAvailable: true},
+		{ID: "U2", CollectibleID: "C1", WarehouseID: "1", IsAvailable: true},
+		{ID: "U3", CollectibleID: "C1", WarehouseID: "2", IsAvailable: true},
+	}
+
+	am := NewAllocationManager(units, warehouses)
+
+	am.SyncInventory([]*models.Rental{
+		{ID: "R1", CollectibleID: "C1", WarehouseID: "1", PaymentStatus: models.PaymentPending},
+		{ID: "R2", CollectibleID: "C1", WarehouseID: "1", PaymentStatus: models.PaymentCompleted},
+		{ID: "R3", CollectibleID: "C1", WarehouseID: "2", PaymentStatus: models.PaymentFailed},
+	})
+
+	// Both units in warehouse 1 are claimed, one per rental
+	if units[0].IsAvailable || units[0].ReservationID != "R1" || units[0].ReservedAt == nil {
+		t.Errorf("Expected U1 reserved (pending) for R1, got %+v", units[0])
+	}
+	if units[1].IsAvailable || units[1].ReservationID != "R2" || units[1].ReservedAt != nil {
+		t.Errorf("Expected U2 permanently reserved for R2, got %+v", units[1])
+	}
+	// Failed rentals do not hold stock
+	if !units[2].IsAvailable {
+		t.Error("Expected U3 to remain available for failed rental")
+	}
+	if stock := am.GetTotalStock("C1"); stock != 1 {
+		t.Errorf("Expected stock 1 after sync, got %d", stock)
+	}
+}
+
+func TestAllocationManager_SoftHold(t *testing.T) {
+	newManager := func(mode AllocationMode) (*AllocationManager, []*models.CollectibleUnit) {
+		warehouses := []models.WarehouseNode{
+			{ID: "1", Distances: map[string]int{"S1": 1}},
+			{ID: "2", Distances: map[string]int{"S1": 4}},
+		}
+		units := []*models.CollectibleUnit{
+			{ID: "U1", CollectibleID: "C1", WarehouseID: "1", IsAvailable: true},
+			{ID: "U2", CollectibleID: "C1", WarehouseID: "2", IsAvailable: true},
+		}
+		am := NewAllocationManager(units, warehouses)
+		am.SetAllocationMode(mode, time.Minute)
+		return am, units
+	}
+
+	t.Run("Soft hold expires after its TTL", func(t *testing.T) {
+		am, units := newManager(AllocationModeSoftHold)
+		if _, _, err := am.Allocate("C1", "S1", "R1"); err != nil {
+			t.Fatalf("Allocate failed: %v", err)
+		}
+
+		// Older than the soft-hold TTL but well within the default reservation timeout
+		past := time.Now().Add(-2 * time.Minute)
+		units[0].ReservedAt = &past
+
+		am.CleanupExpiredReservations()
+		if am.GetTotalStock("C1") != 2 {
+			t.Error("Expected soft hold to be released after its TTL")
+		}
+	})
+
+	t.Run("Payment confirms the held unit", func(t *testing.T) {
+		am, _ := newManager(AllocationModeSoftHold)
+		held, _, _ := am.Allocate("C1", "S1", "R1")
+
+		got, dist, err := am.ConfirmAllocation("R1", "C1", "S1")
+		if err != nil {
+			t.Fatalf("ConfirmAllocation failed: %v", err)
+		}
+		if got.ID != held.ID || dist != 1 || got.ReservedAt != nil {
+			t.Errorf("Expected held unit %s confirmed permanently, got %+v (dist %d)", held.ID, got, dist)
+		}
+	})
+
+	t.Run("Payment after a lapsed hold re-allocates", func(t *testing.T) {
+		am, units := newManager(AllocationModeSoftHold)
+		am.Allocate("C1", "S1", "R1")
+		past := time.Now().Add(-2 * time.Minute)
+		units[0].ReservedAt = &past
+		am.CleanupExpiredReservations()
+
+		// Another customer takes the nearest unit in the meantime
+		am.Allocate("C1", "S1", "R2")
+
+		got, dist, err := am.ConfirmAllocation("R1", "C1", "S1")
+		if err != nil {
+			t.Fatalf("ConfirmAllocation failed: %v", err)
+		}
+		if got.ID != "U2" || dist != 4 || got.ReservationID != "R1" {
+			t.Errorf("Expected U2 re-allocated to R1, got %+v (dist %d)", got, dist)
+		}
+	})
+
+	t.Run("Reserve mode does not re-allocate", func(t *testing.T) {
+		am, _ := newManager(AllocationModeReserve)
+		if _, _, err := am.ConfirmAllocation("R1", "C1", "S1"); err == nil {
+			t.Error("Expected error confirming a rental with no reservation")
+		}
+		if am.GetTotalStock("C1") != 2 {
+			t.Error("Reserve mode must not allocate on confirmation")
+		}
+	})
+}
+
+// memoryReservationStore is a ReservationStore backed by a map, optionally
+// rejecting units listed in taken as if another instance held them
+type memoryReservationStore struct {
+	saved map[string]models.Reservation
+	taken map[string]bool
+}
+
+func newMemoryReservationStore() *memoryReservationStore {
+	return &memoryReservationStore{saved: map[string]models.Reservation{}, taken: map[string]bool{}}
+}
+
+func (s *memoryReservationStore) SaveReservation(unitID string, rentalID string, reservedAt time.Time) error {
+	if s.taken[unitID] {
+		return errors.New("unit already reserved by another rental")
+	}
+	res := models.Reservation{UnitID: unitID, RentalID: rentalID}
+	if !reservedAt.IsZero() {
+		res.ReservedAt = &reservedAt
+	}
+	s.saved[unitID] = res
+	return nil
+}
+
+func (s *memoryReservationStore) DeleteReservation(unitID string) error {
+	delete(s.saved, unitID)
+	return nil
+}
+
+func (s *memoryReservationStore) LoadReservations() ([]models.Reservation, error) {
+	var out []models.Reservation
+	for _, res := range s.saved {
+		out = append(out, res)
+	}
+	return out, nil
+}
+
+func TestAllocationManager_ReservationStore(t *testing.T) {
+	warehouses := []models.WarehouseNode{
+		{ID: "1", Distances: map[string]int{"S1": 1}},
+		{ID: "2", Distances: map[string]int{"S1": 2}},
+	}
+	newUnits := func() []*models.CollectibleUnit {
+		return []*models.CollectibleUnit{
+			{ID: "U1", CollectibleID: "C1", WarehouseID: "1", IsAvailable: true},
+			{ID: "U2", CollectibleID: "C1", WarehouseID: "2", IsAvailable: true},
+		}
+	}
+
+	t.Run("Reservations survive a restart", func(t *testing.T) {
+		store := newMemoryReservationStore()
+		am := NewAllocationManager(newUnits(), warehouses)
+		am.SetReservationStore(store)
+		if _, _, err := am.Allocate("C1", "S1", "R1"); err != nil {
+			t.Fatalf("Allocate failed: %v", err)
+		}
+
+		// New manager with fresh inventory, as after a restart
+		restarted := NewAllocationManager(newUnits(), warehouses)
+		restarted.SetReservationStore(store)
+		if err := restarted.RestoreReservations(); err != nil {
+			t.Fatalf("RestoreReservations failed: %v", err)
+		}
+		if restarted.GetTotalStock("C1") != 1 {
+			t.Error("Expected restored reservation to hold one unit")
+		}
+
+		// Syncing the same rental must not claim a second unit
+		restarted.SyncInventory([]*models.Rental{{ID: "R1", CollectibleID: "C1", WarehouseID: "1", PaymentStatus: models.PaymentPending}})
+		if restarted.GetTotalStock("C1") != 1 {
+			t.Error("SyncInventory claimed a second unit for a restored rental")
+		}
+
+		restarted.ReleaseByRentalID("R1")
+		if len(store.saved) != 0 {
+			t.Errorf("Expected release to delete the persisted hold, got %+v", store.saved)
+		}
+	})
+
+	t.Run("Unit held by another instance is not double-booked", func(t *testing.T) {
+		store := newMemoryReservationStore()
+		store.taken["U1"] = true
+		am := NewAllocationManager(newUnits(), warehouses)
+		am.SetReservationStore(store)
+
+		if _, _, err := am.Allocate("C1", "S1", "R1"); err == nil {
+			t.Fatal("Expected allocation to fail when the store rejects the hold")
+		}
+		if am.GetTotalStock("C1") != 2 {
+			t.Error("Failed allocation must be rolled back in memory")
+		}
+	})
+}
+
+func TestAllocationManager_ETADays(t *testing.T) {
+	am := NewAllocationManager(nil, nil)
+
+	tests := []struct {
+		distance int
+		want     int
+	}{
+		{0, DefaultETAHandlingDays},
+		{1, DefaultETAHandlingDays + 1},
+		{DefaultETAKmPerDay, DefaultETAHandlingDays + 1},
+		{DefaultETAKmPerDay + 1, DefaultETAHandlingDays + 2},
+		{-5, DefaultETAHandlingDays},
+	}
+	for _, tt := range tests {
+		if got := am.ETADays(tt.distance); got != tt.want {
+			t.Errorf("ETADays(%d) = %d, want %d", tt.distance, got, tt.want)
+		}
+	}
+
+	am.SetETAConversion(20, 0)
+	if got := am.ETADays(45); got != 3 {
+		t.Errorf("ETADays(45) at 20 km/day = %d, want 3", got)
+	}
+
+	// Invalid values keep the current conversion
+	am.SetETAConversion(0, -1)
+	if got := am.ETADays(45); got != 3 {
+		t.Errorf("Invalid conversion should be ignored, ETADays(45) = %d", got)
+	}
+}
+
+func TestAllocationManager_GetStockDetails(t *testing.T) {
+	warehouses := []models.WarehouseNode{
+		{ID: "1", Distances: map[string]int{"S1": 10}},
+		{ID: "2", Distances: map[string]int{"S1": 3}},
+		{ID: "3", Distances: map[string]int{"S2": 1}}, // Doesn't serve S1
+	}
+	units := []*models.CollectibleUnit{
+		{ID: "U1", CollectibleID: "C1", WarehouseID: "1", IsAvailable: true},
+		{ID: "U2", CollectibleID: "C1", WarehouseID: "2", IsAvailable: true},
+		{ID: "U3", CollectibleID: "C1", WarehouseID: "2", IsAvailable: true},
+		{ID: "U4", CollectibleID: "C1", WarehouseID: "2", IsAvailable: false},
+		{ID: "U5", CollectibleID: "C1", WarehouseID: "3", IsAvailable: true},
+	}
+	am := NewAllocationManager(units, warehouses)
+
+	got := am.GetStockDetails("C1", "S1")
+	want := []models.WarehouseOption{
+		{WarehouseID: "2", Available: 2, Distance: 3, ETADays: 2},
+		{WarehouseID: "1", Available: 1, Distance: 10, ETADays: 2},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d warehouses, got %+v", len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Detail %d: expected %+v, got %+v", i, want[i], got[i])
+		}
+	}
+
+	if got := am.GetStockDetails("missing", "S1"); len(got) != 0 {
+		t.Errorf("Expected no details for unknown collectible, got %+v", got)
+	}
+}
+
+func TestAllocationManager_AllocateTieBreak(t *testing.T) {
+	// Like the seed data's central warehouse, "central" is as close to S1 as "east"
+	warehouses := []models.WarehouseNode{
+		{ID: "east", Distances: map[string]int{"S1": 3}},
+		{ID: "central", Distances: map[string]int{"S1": 3}},
+		{ID: "west", Distances: map[string]int{"S1": 3}},
+	}
+	newUnits := func() []*models.CollectibleUnit {
+		return []*models.CollectibleUnit{
+			{ID: "U1", CollectibleID: "C1", WarehouseID: "east", IsAvailable: true},
+			{ID: "U2", CollectibleID: "C1", WarehouseID: "west", IsAvailable: true},
+			{ID: "U3", CollectibleID: "C1", WarehouseID: "west", IsAvailable: true},
+			{ID: "U4", CollectibleID: "C1", WarehouseID: "central", IsAvailable: true},
+		}
+	}
+
+	// west has the most stock, then central beats east by ID; within west, U2 before U3
+	want := []string{"U2", "U4", "U1", "U3"}
+
+	for _, reversed := range []bool{false, true} {
+		units := newUnits()
+		if reversed {
+			slices.Reverse(units)
+		}
+		am := NewAllocationManager(units, warehouses)
+
+		var got []string
+		for i := range want {
+			unit, _, err := am.Allocate("C1", "S1", fmt.Sprintf("R%d", i))
+			if err != nil {
+				t.Fatalf("Allocate %d failed: %v", i, err)
+			}
+			got = append(got, unit.ID)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("reversed=%v: expected allocation order %v, got %v", reversed, want, got)
+		}
+	}
+}
+
+func TestAllocationManager_PreviewAllocation(t *testing.T) {
+	warehouses := []models.WarehouseNode{
+		{ID: "east", Distances: map[string]int{"S1": 3, "S2": 90}},
+		{ID: "west", Distances: map[string]int{"S1": 3, "S2": 40}},
+		{ID: "north", Distances: map[string]int{"S1": 80}},
+	}
+	units := []*models.CollectibleUnit{
+		{ID: "U1", CollectibleID: "C1", WarehouseID: "east", IsAvailable: true},
+		{ID: "U2", CollectibleID: "C1", WarehouseID: "west", IsAvailable: true},
+		{ID: "U3", CollectibleID: "C1", WarehouseID: "north", IsAvailable: true},
+	}
+	am := NewAllocationManager(units, warehouses)
+
+	// Draining S1 walks through the tie, then the far warehouse
+	for i := 0; i < len(units); i++ {
+		warehouseID, eta, err := am.PreviewAllocation("C1", "S1")
+		if err != nil {
+			t.Fatalf("Preview %d failed: %v", i, err)
+		}
+		if stock := am.GetTotalStock("C1"); stock != len(units)-i {
+			t.Fatalf("Preview must not reserve: expected stock %d, got %d", len(units)-i, stock)
+		}
+
+		unit, dist, err := am.Allocate("C1", "S1", fmt.Sprintf("R%d", i))
+		if err != nil {
+			t.Fatalf("Allocate %d failed: %v", i, err)
+		}
+		if unit.WarehouseID != warehouseID || am.ETADays(dist) != eta {
+			t.Errorf("Preview said %s in %d days, Allocate gave %s in %d days", warehouseID, eta, unit.WarehouseID, am.ETADays(dist))
+		}
+	}
+
+	if _, _, err := am.PreviewAllocation("C1", "S1"); !errors.Is(err, ErrOutOfStock) {
+		t.Errorf("Expected ErrOutOfStock once drained, got %v", err)
+	}
+
+	t.Run("Unserved store", func(t *testing.T) {
+		am := NewAllocationManager([]*models.CollectibleUnit{
+			{ID: "U3", CollectibleID: "C1", WarehouseID: "north", IsAvailable: true},
+		}, warehouses)
+		if _, _, err := am.PreviewAllocation("C1", "S2"); !errors.Is(err, ErrStoreNotServed) {
+			t.Errorf("Expected ErrStoreNotServed, got %v", err)
+		}
+	})
+}
+
+func TestAllocationManager_GetStockDetailsFollowsAllocation(t *testing.T) {
+	warehouses := []models.WarehouseNode{
+		{ID: "far", Distances: map[string]int{"S1": 120}},
+		{ID: "near", Distances: map[string]int{"S1": 4}},
+		{ID: "mid", Distances: map[string]int{"S1": 60}},
+		{ID: "other", Distances: map[string]int{"S2": 1}}, // Doesn't serve S1
+	}
+	units := []*models.CollectibleUnit{
+		{ID: "U1", CollectibleID: "C1", WarehouseID: "far", IsAvailable: true},
+		{ID: "U2", CollectibleID: "C1", WarehouseID: "near", IsAvailable: true},
+		{ID: "U3", CollectibleID: "C1", WarehouseID: "mid", IsAvailable: true},
+		{ID: "U4", CollectibleID: "C1", WarehouseID: "mid", IsAvailable: true},
+		{ID: "U5", CollectibleID: "C1", WarehouseID: "other", IsAvailable: true},
+	}
+	am := NewAllocationManager(units, warehouses)
+
+	got := am.GetStockDetails("C1", "S1")
+	want := []models.WarehouseOption{
+		{WarehouseID: "near", Available: 1, Distance: 4, ETADays: 2},
+		{WarehouseID: "mid", Available: 2, Distance: 60, ETADays: 3},
+		{WarehouseID: "far", Available: 1, Distance: 120, ETADays: 4},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d options, got %+v", len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Option %d: expected %+v, got %+v", i, want[i], got[i])
+		}
+	}
+
+	// Once the nearest unit is reserved, the next warehouse leads
+	if _, _, err := am.Allocate("C1", "S1", "R1"); err != nil {
+		t.Fatalf("Allocate failed: %v", err)
+	}
+	if got := am.GetStockDetails("C1", "S1"); len(got) != 2 || got[0].WarehouseID != "mid" {
+		t.Errorf("Expected mid first after near is reserved, got %+v", got)
+	}
+}
+
+func TestAllocationManager_GetReservedUnits(t *testing.T) {
+	warehouses := []models.WarehouseNode{
+		{ID: "1", Distances: map[string]int{"S1": 1}},
+		{ID: "2", Distances: map[string]int{"S1": 2}},
+	}
+	units := []*models.CollectibleUnit{
+		{ID: "U1", CollectibleID: "C1", WarehouseID: "1", IsAvailable: true},
+		{ID: "U2", CollectibleID: "C1", WarehouseID: "2", IsAvailable: true},
+	}
+	am := NewAllocationManager(units, warehouses)
+
+	if got := am.GetReservedUnits(); len(got) != 0 {
+		t.Fatalf("Expected no reserved units, got %+v", got)
+	}
+
+	if _, _, err := am.Allocate("C1", "S1", "R1"); err != nil {
+		t.Fatalf("Allocate failed: %v", err)
+	}
+
+	got := am.GetReservedUnits()
+	if len(got) != 1 {
+		t.Fatalf("Expected 1 reserved unit, got %+v", got)
+	}
+	if got[0].UnitID != "U1" || got[0].RentalID != "R1" || got[0].ReservedAt == nil {
+		t.Errorf("Unexpected reservation snapshot: %+v", got[0])
+	}
+}
+
+func TestAllocationManager_AddWarehouse(t *testing.T) {
+	warehouses := []models.WarehouseNode{{ID: "1", Distances: map[string]int{"S1": 5}}}
+	units := []*models.CollectibleUnit{{ID: "U1", CollectibleID: "C1", WarehouseID: "1", IsAvailable: true}}
+	am := NewAllocationManager(units, warehouses)
+	listener := &recordingListener{}
+	am.SetAvailabilityListener(listener)
+
+	err := am.AddWarehouse(models.WarehouseNode{ID: "2", Distances: map[string]int{"S1": 1}}, []*models.CollectibleUnit{
+		{ID: "U2", CollectibleID: "C1", WarehouseID: "2", IsAvailable: true},
+		{ID: "U3", CollectibleID: "C2", WarehouseID: "2", IsAvailable: true},
+	})
+	if err != nil {
+		t.Fatalf("AddWarehouse failed: %v", err)
+	}
+	if !am.HasWarehouse("2") || am.GetTotalStock("C1") != 2 || am.GetTotalStock("C2") != 1 {
+		t.Fatalf("Expected the new warehouse's units in stock, got C1=%d C2=%d", am.GetTotalStock("C1"), am.GetTotalStock("C2"))
+	}
+	if len(listener.released) != 2 {
+		t.Errorf("Expected the listener told about both new units, got %v", listener.released)
+	}
+
+	// The new, nearer warehouse is used straight away
+	unit, dist, err := am.Allocate("C1", "S1", "R1")
+	if err != nil || unit.ID != "U2" || dist != 1 {
+		t.Errorf("Expected U2 at distance 1, got %+v, %d (err %v)", unit, dist, err)
+	}
+	if _, ok := am.GetUnit("U3"); !ok {
+		t.Error("Expected U3 to be indexed")
+	}
+
+	t.Run("Known warehouse or unit IDs are rejected", func(t *testing.T) {
+		if err := am.AddWarehouse(models.WarehouseNode{ID: "2"}, nil); !errors.Is(err, ErrWarehouseExists) {
+			t.Errorf("Expected ErrWarehouseExists for a known warehouse, got %v", err)
+		}
+		err := am.AddWarehouse(models.WarehouseNode{ID: "3"}, []*models.CollectibleUnit{{ID: "U1", CollectibleID: "C1", WarehouseID: "3"}})
+		if !errors.Is(err, ErrWarehouseExists) {
+			t.Errorf("Expected ErrWarehouseExists for a known unit, got %v", err)
+		}
+		if am.HasWarehouse("3") {
+			t.Error("Rejected warehouse should not be added")
+		}
+	})
+}
+
+func TestAllocationManager_AddUnit(t *testing.T) {
+	am := NewAllocationManager(nil, []models.WarehouseNode{{ID: "1", Distances: map[string]int{"S1": 5}}})
+
+	if _, _, err := am.Allocate("C1", "S1", "R1"); err == nil {
+		t.Fatal("Expected allocation to fail before any unit is stocked")
+	}
+	if err := am.AddUnit(&models.CollectibleUnit{ID: "U1", CollectibleID: "C1", WarehouseID: "1", IsAvailable: true}); err != nil {
+		t.Fatalf("AddUnit failed: %v", err)
+	}
+	unit, dist, err := am.Allocate("C1", "S1", "R1")
+	if err != nil || unit.ID != "U1" || dist != 5 {
+		t.Fatalf("Expected U1 at distance 5, got %+v, %d (err %v)", unit, dist, err)
+	}
+
+	t.Run("Unit at a newly registered warehouse", func(t *testing.T) {
+		am.AddWarehouseNode(models.WarehouseNode{ID: "2", Distances: map[string]int{"S1": 2}})
+		if err := am.AddUnit(&models.CollectibleUnit{ID: "U2", CollectibleID: "C1", WarehouseID: "2", IsAvailable: true}); err != nil {
+			t.Fatalf("AddUnit failed: %v", err)
+		}
+		if eta, err := am.GetETA("C1", "S1"); err != nil || eta != 2 {
+			t.Errorf("Expected ETA 2 from the new warehouse, got %d (err %v)", eta, err)
+		}
+
+		// Re-registering a warehouse replaces its distances
+		am.AddWarehouseNode(models.WarehouseNode{ID: "2", Distances: map[string]int{"S1": 3}})
+		unit, dist, err := am.Allocate("C1", "S1", "R2")
+		if err != nil || unit.ID != "U2" || dist != 3 {
+			t.Errorf("Expected U2 at distance 3, got %+v, %d (err %v)", unit, dist, err)
+		}
+	})
+
+	t.Run("Held unit is indexed by rental", func(t *testing.T) {
+		reservedAt := time.Now()
+		held := &models.CollectibleUnit{ID: "U3", CollectibleID: "C1", WarehouseID: "1", ReservationID: "R3", ReservedAt: &reservedAt}
+		if err := am.AddUnit(held); err != nil {
+			t.Fatalf("AddUnit failed: %v", err)
+		}
+		if err := am.ReleaseByRentalID("R3"); err != nil || !held.IsAvailable {
+			t.Errorf("Expected R3's unit to be releasable, got err %v", err)
+		}
+	})
+
+	t.Run("Rejects unknown warehouses and known IDs", func(t *testing.T) {
+		if err := am.AddUnit(&models.CollectibleUnit{ID: "U9", CollectibleID: "C1", WarehouseID: "9"}); !errors.Is(err, ErrUnknownWarehouse) {
+			t.Errorf("Expected ErrUnknownWarehouse, got %v", err)
+		}
+		if err := am.AddUnit(&models.CollectibleUnit{ID: "U1", CollectibleID: "C1", WarehouseID: "1"}); !errors.Is(err, ErrWarehouseExists) {
+			t.Errorf("Expected ErrWarehouseExists for a known unit, got %v", err)
+		}
+	})
+}
+
+func TestAllocationManager_CountAvailableAndReserved(t *testing.T) {
+	warehouses := []models.WarehouseNode{
+		{ID: "1", Distances: map[string]int{"S1": 1}},
+	}
+	units := []*models.CollectibleUnit{
+		{ID: "U1", CollectibleID: "C1", WarehouseID: "1", IsAvailable: true},
+		{ID: "U2", CollectibleID: "C1", WarehouseID: "1", IsAvailable: false},
+		{ID: "U3", CollectibleID: "C1", WarehouseID: "1", IsAvailable: true},
+		{ID: "U4", CollectibleID: "C2", WarehouseID: "1", IsAvailable: false},
+	}
+	am := NewAllocationManager(units, warehouses)
+
+	available := am.CountAvailable()
+	reserved := am.CountReserved()
+
+	if available["C1"] != 2 || reserved["C1"] != 1 {
+		t.Errorf("C1: expected 2 available / 1 reserved, got %d / %d", available["C1"], reserved["C1"])
+	}
+	if available["C2"] != 0 || reserved["C2"] != 1 {
+		t.Errorf("C2: expected 0 available / 1 reserved, got %d / %d", available["C2"], reserved["C2"])
+	}
+	if _, ok := available["C2"]; !ok {
+		t.Error("Expected fully reserved collectible to be listed with 0 available")
+	}
+}
+
+// memoryUnitStore is a UnitStore that records the last written state of each unit
+type memoryUnitStore struct {
+	units map[string]models.CollectibleUnit
+}
+
+func (s *memoryUnitStore) UpdateUnitAvailability(unit *models.CollectibleUnit) error {
+	s.units[unit.ID] = *unit
+	return nil
+}
+
+func TestAllocationManager_UnitStore(t *testing.T) {
+	warehouses := []models.WarehouseNode{
+		{ID: "1", Distances: map[string]int{"S1": 1}},
+	}
+	units := []*models.CollectibleUnit{
+		{ID: "U1", CollectibleID: "C1", WarehouseID: "1", IsAvailable: true},
+	}
+
+	am := NewAllocationManager(units, warehouses)
+	store := &memoryUnitStore{units: map[string]models.CollectibleUnit{}}
+	am.SetUnitStore(store)
+
+	if _, _, err := am.Allocate("C1", "S1", "R1"); err != nil {
+		t.Fatalf("Allocate failed: %v", err)
+	}
+	if u := store.units["U1"]; u.IsAvailable || u.ReservationID != "R1" || u.ReservedAt == nil {
+		t.Errorf("Expected the hold to be written through, got %+v", u)
+	}
+
+	if _, _, err := am.ConfirmAllocation("R1", "C1", "S1"); err != nil {
+		t.Fatalf("ConfirmAllocation failed: %v", err)
+	}
+	if u := store.units["U1"]; u.IsAvailable || u.ReservedAt != nil {
+		t.Errorf("Expected the confirmed hold to be written through, got %+v", u)
+	}
+
+	if err := am.ReleaseByRentalID("R1"); err != nil {
+		t.Fatalf("ReleaseByRentalID failed: %v", err)
+	}
+	if u := store.units["U1"]; !u.IsAvailable || u.ReservationID != "" {
+		t.Errorf("Expected the release to be written through, got %+v", u)
+	}
+
+	// Expired holds are written back as available
+	am.Allocate("C1", "S1", "R2")
+	past := time.Now().Add(-time.Hour)
+	units[0].ReservedAt = &past
+	am.CleanupExpiredReservations()
+	if u := store.units["U1"]; !u.IsAvailable || u.ReservationID != "" {
+		t.Errorf("Expected the expiry to be written through, got %+v", u)
+	}
 }
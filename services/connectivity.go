@@ -0,0 +1,64 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/mongocollectibles/rental-system/models"
+)
+
+// MinStoresPerWarehouse is the minimum number of stores every warehouse must be able to ship to
+const MinStoresPerWarehouse = 3
+
+// ValidateConnectivity checks that every warehouse is connected to at least
+// MinStoresPerWarehouse stores. It returns one joined error listing every
+// under-connected warehouse, or nil if all pass.
+func ValidateConnectivity(warehouses []models.WarehouseNode) error {
+	sorted := make([]models.WarehouseNode, len(warehouses))
+	copy(sorted, warehouses)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].ID < sorted[j].ID
+	})
+
+	var errs []error
+	for _, wh := range sorted {
+		if storeCount := len(wh.Distances); storeCount < MinStoresPerWarehouse {
+			errs = append(errs, fmt.Errorf("warehouse '%s' only has %d stores connected (minimum %d required)", wh.ID, storeCount, MinStoresPerWarehouse))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ValidateDistanceMap checks a single warehouse's StoreID -> distance map against the
+// configured stores before it is registered: every store needs a non-negative distance,
+// unknown stores are rejected, and the map must reach at least MinStoresPerWarehouse
+// stores. It returns one joined error listing every problem, or nil if the map is valid.
+func ValidateDistanceMap(distances map[string]int, stores []models.Store) error {
+	known := make(map[string]bool, len(stores))
+	var errs []error
+	for _, store := range stores {
+		known[store.ID] = true
+		if _, ok := distances[store.ID]; !ok {
+			errs = append(errs, fmt.Errorf("missing distance to store '%s'", store.ID))
+		}
+	}
+
+	storeIDs := make([]string, 0, len(distances))
+	for storeID := range distances {
+		storeIDs = append(storeIDs, storeID)
+	}
+	sort.Strings(storeIDs)
+	for _, storeID := range storeIDs {
+		if !known[storeID] {
+			errs = append(errs, fmt.Errorf("unknown store '%s'", storeID))
+		} else if distances[storeID] < 0 {
+			errs = append(errs, fmt.Errorf("distance to store '%s' must not be negative", storeID))
+		}
+	}
+
+	if len(distances) < MinStoresPerWarehouse {
+		errs = append(errs, fmt.Errorf("only %d stores connected (minimum %d required)", len(distances), MinStoresPerWarehouse))
+	}
+	return errors.Join(errs...)
+}
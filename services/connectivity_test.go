@@ -0,0 +1,85 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mongocollectibles/rental-system/models"
+)
+
+func TestValidateConnectivity(t *testing.T) {
+	threeStores := map[string]int{"store-a": 1, "store-b": 2, "store-c": 3}
+	twoStores := map[string]int{"store-a": 1, "store-b": 2}
+
+	t.Run("Warehouse with 3 stores passes", func(t *testing.T) {
+		err := ValidateConnectivity([]models.WarehouseNode{{ID: "wh-1", Distances: threeStores}})
+		if err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+	})
+
+	t.Run("Warehouse with 2 stores fails", func(t *testing.T) {
+		err := ValidateConnectivity([]models.WarehouseNode{{ID: "wh-1", Distances: twoStores}})
+		if err == nil {
+			t.Fatal("Expected an error for under-connected warehouse")
+		}
+		if !strings.Contains(err.Error(), "'wh-1' only has 2 stores") {
+			t.Errorf("Unexpected error message: %v", err)
+		}
+	})
+
+	t.Run("Every under-connected warehouse is reported", func(t *testing.T) {
+		err := ValidateConnectivity([]models.WarehouseNode{
+			{ID: "wh-3", Distances: twoStores},
+			{ID: "wh-2", Distances: threeStores},
+			{ID: "wh-1", Distances: nil},
+		})
+		if err == nil {
+			t.Fatal("Expected an error")
+		}
+		msg := err.Error()
+		if !strings.Contains(msg, "'wh-1' only has 0 stores") || !strings.Contains(msg, "'wh-3' only has 2 stores") {
+			t.Errorf("Expected both wh-1 and wh-3 to be listed, got %v", msg)
+		}
+		if strings.Contains(msg, "wh-2") {
+			t.Errorf("Did not expect wh-2 to be listed, got %v", msg)
+		}
+	})
+}
+
+func TestValidateDistanceMap(t *testing.T) {
+	stores := []models.Store{{ID: "store-a"}, {ID: "store-b"}, {ID: "store-c"}}
+
+	tests := []struct {
+		name      string
+		distances map[string]int
+		wantErr   string
+	}{
+		{"Every store covered", map[string]int{"store-a": 1, "store-b": 0, "store-c": 3}, ""},
+		{"Missing store", map[string]int{"store-a": 1, "store-b": 2}, "missing distance to store 'store-c'"},
+		{"Negative distance", map[string]int{"store-a": 1, "store-b": -2, "store-c": 3}, "'store-b' must not be negative"},
+		{"Unknown store", map[string]int{"store-a": 1, "store-b": 2, "store-c": 3, "store-z": 4}, "unknown store 'store-z'"},
+		{"Empty map", nil, "only 0 stores connected"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateDistanceMap(tt.distances, stores)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	t.Run("Too few configured stores fails connectivity", func(t *testing.T) {
+		err := ValidateDistanceMap(map[string]int{"store-a": 1}, stores[:1])
+		if err == nil || !strings.Contains(err.Error(), "minimum 3 required") {
+			t.Errorf("Expected the min-connectivity rule to apply, got %v", err)
+		}
+	})
+}
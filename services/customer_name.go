@@ -0,0 +1,29 @@
+package services
+
+import (
+	"strings"
+
+	"github.com/mongocollectibles/rental-system/models"
+)
+
+// CustomerNameParts returns the customer's first and last name.
+// Explicit FirstName/LastName are used when provided; otherwise Name is split with SplitName.
+func CustomerNameParts(customer models.Customer) (string, string) {
+	if customer.FirstName != "" || customer.LastName != "" {
+		return strings.TrimSpace(customer.FirstName), strings.TrimSpace(customer.LastName)
+	}
+
+	parts := SplitName(customer.Name)
+	return parts[0], parts[1]
+}
+
+// SplitName splits a full name on its last space into [first, last].
+// It is a fallback heuristic: multi-word surnames ("de los Santos") end up mostly in the first name.
+func SplitName(name string) []string {
+	name = strings.TrimSpace(name)
+
+	if i := strings.LastIndex(name, " "); i >= 0 {
+		return []string{strings.TrimSpace(name[:i]), name[i+1:]}
+	}
+	return []string{name, ""}
+}
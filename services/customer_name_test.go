@@ -0,0 +1,51 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/mongocollectibles/rental-system/models"
+)
+
+func TestSplitName(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		wantFirst string
+		wantLast  string
+	}{
+		{"First and last", "Juan Dela", "Juan", "Dela"},
+		{"Single name", "Madonna", "Madonna", ""},
+		{"Empty input", "", "", ""},
+		{"Surrounding whitespace", "  Juan Cruz  ", "Juan", "Cruz"},
+		{"Multi-word surname splits on last space", "Maria Clara de los Santos", "Maria Clara de los", "Santos"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SplitName(tt.input)
+			if got[0] != tt.wantFirst || got[1] != tt.wantLast {
+				t.Errorf("SplitName(%q) = %q, want [%q %q]", tt.input, got, tt.wantFirst, tt.wantLast)
+			}
+		})
+	}
+}
+
+func TestCustomerNameParts(t *testing.T) {
+	t.Run("Explicit fields take precedence", func(t *testing.T) {
+		first, last := CustomerNameParts(models.Customer{
+			Name:      "Maria Clara de los Santos",
+			FirstName: "Maria Clara",
+			LastName:  "de los Santos",
+		})
+		if first != "Maria Clara" || last != "de los Santos" {
+			t.Errorf("Got %q %q, want explicit names", first, last)
+		}
+	})
+
+	t.Run("Falls back to splitting Name", func(t *testing.T) {
+		first, last := CustomerNameParts(models.Customer{Name: "Juan Dela Cruz"})
+		if first != "Juan Dela" || last != "Cruz" {
+			t.Errorf("Got %q %q, want split of Name", first, last)
+		}
+	})
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"math"
+
+	"github.com/mongocollectibles/rental-system/models"
+)
+
+// earthRadiusKm is the mean Earth radius used for great-circle distances
+const earthRadiusKm = 6371.0
+
+// ComputeHaversineDistance returns the great-circle distance in whole kilometres
+// between a warehouse and a store
+func ComputeHaversineDistance(wLat, wLng, sLat, sLng float64) int {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := toRad(sLat - wLat)
+	dLng := toRad(sLng - wLng)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(wLat))*math.Cos(toRad(sLat))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+
+	return int(math.Round(earthRadiusKm * c))
+}
+
+// BuildDistanceMapFromCoords derives a StoreID -> distance (km) map for a warehouse
+// at (lat, lng). Stores without coordinates are skipped, and entries in overrides
+// (e.g. hand-measured road distances) take precedence over computed ones.
+// A warehouse without coordinates gets only its overrides.
+func BuildDistanceMapFromCoords(lat, lng float64, stores []models.Store, overrides map[string]int) map[string]int {
+	distances := make(map[string]int, len(stores))
+
+	if hasCoords(lat, lng) {
+		for _, store := range stores {
+			if !hasCoords(store.Latitude, store.Longitude) {
+				continue
+			}
+			distances[store.ID] = ComputeHaversineDistance(lat, lng, store.Latitude, store.Longitude)
+		}
+	}
+
+	for storeID, dist := range overrides {
+		distances[storeID] = dist
+	}
+	return distances
+}
+
+// hasCoords treats (0, 0) as "not set", which is safe for locations in the Philippines
+func hasCoords(lat, lng float64) bool {
+	return lat != 0 || lng != 0
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/mongocollectibles/rental-system/models"
+)
+
+func TestComputeHaversineDistance(t *testing.T) {
+	// Manila (store-a) to Quezon City (store-b) is roughly 8 km
+	got := ComputeHaversineDistance(14.5995, 120.9842, 14.6760, 121.0437)
+	if got < 7 || got > 11 {
+		t.Errorf("Expected ~8 km, got %d", got)
+	}
+
+	if got := ComputeHaversineDistance(14.5995, 120.9842, 14.5995, 120.9842); got != 0 {
+		t.Errorf("Expected 0 km for identical points, got %d", got)
+	}
+}
+
+func TestBuildDistanceMapFromCoords(t *testing.T) {
+	stores := []models.Store{
+		{ID: "store-a", Latitude: 14.5995, Longitude: 120.9842},
+		{ID: "store-b", Latitude: 14.6760, Longitude: 121.0437},
+		{ID: "store-c"}, // no coordinates
+	}
+
+	t.Run("Computes distances for stores with coordinates", func(t *testing.T) {
+		distances := BuildDistanceMapFromCoords(14.5995, 120.9842, stores, nil)
+		if len(distances) != 2 {
+			t.Fatalf("Expected 2 entries, got %v", distances)
+		}
+		if distances["store-a"] != 0 {
+			t.Errorf("Expected 0 km to co-located store, got %d", distances["store-a"])
+		}
+		if _, ok := distances["store-c"]; ok {
+			t.Error("Expected store without coordinates to be skipped")
+		}
+	})
+
+	t.Run("Manual distances override computed ones", func(t *testing.T) {
+		distances := BuildDistanceMapFromCoords(14.5995, 120.9842, stores, map[string]int{"store-b": 42, "store-c": 9})
+		if distances["store-b"] != 42 || distances["store-c"] != 9 {
+			t.Errorf("Expected overrides to win, got %v", distances)
+		}
+	})
+
+	t.Run("Warehouse without coordinates keeps only overrides", func(t *testing.T) {
+		distances := BuildDistanceMapFromCoords(0, 0, stores, map[string]int{"store-a": 3})
+		if len(distances) != 1 || distances["store-a"] != 3 {
+			t.Errorf("Expected only the override, got %v", distances)
+		}
+	})
+}
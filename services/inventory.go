@@ -0,0 +1,49 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/mongocollectibles/rental-system/models"
+)
+
+// BuildInventory turns stored warehouse records (collectibleID -> warehouses) into the units
+// and warehouse nodes the AllocationManager works with. Each warehouse contributes Quantity
+// units with distinct IDs; the first keeps the warehouse ID so holds persisted before
+// quantities existed still match. Store distances are derived from coordinates.
+func BuildInventory(warehouses map[string][]models.Warehouse, stores []models.Store) ([]*models.CollectibleUnit, []models.WarehouseNode) {
+	var units []*models.CollectibleUnit
+	var nodes []models.WarehouseNode
+	seen := make(map[string]bool)
+
+	for collectibleID, warehouseList := range warehouses {
+		for _, wh := range warehouseList {
+			quantity := wh.Quantity
+			if quantity < 1 {
+				quantity = 1
+			}
+			for i := 0; i < quantity; i++ {
+				id := wh.ID
+				if i > 0 {
+					id = fmt.Sprintf("%s-%d", wh.ID, i+1)
+				}
+				units = append(units, &models.CollectibleUnit{
+					ID:            id,
+					CollectibleID: collectibleID,
+					WarehouseID:   wh.ID,
+					IsAvailable:   wh.Available,
+				})
+			}
+
+			// One node per physical warehouse
+			if !seen[wh.ID] {
+				// Derive distances from coordinates, with any stored distances as manual overrides
+				nodes = append(nodes, models.WarehouseNode{
+					ID:        wh.ID,
+					Distances: BuildDistanceMapFromCoords(wh.Latitude, wh.Longitude, stores, wh.Distances),
+				})
+				seen[wh.ID] = true
+			}
+		}
+	}
+	return units, nodes
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/mongocollectibles/rental-system/models"
+)
+
+func TestBuildInventory(t *testing.T) {
+	stores := []models.Store{
+		{ID: "store-a", Latitude: 14.5995, Longitude: 120.9842},
+	}
+	warehouses := map[string][]models.Warehouse{
+		"C1": {
+			{ID: "C1-north", Available: true, Quantity: 3, Latitude: 14.7000, Longitude: 121.0300},
+			{ID: "C1-south", Available: true, Quantity: 2, Latitude: 14.4200, Longitude: 121.0400},
+		},
+		"C2": {
+			// Records written before quantities existed hold a single unit
+			{ID: "C2-north", Available: true, Latitude: 14.7000, Longitude: 121.0300},
+		},
+	}
+
+	units, nodes := BuildInventory(warehouses, stores)
+	if len(units) != 6 {
+		t.Fatalf("Expected 6 units, got %d", len(units))
+	}
+	if len(nodes) != 3 {
+		t.Errorf("Expected one node per warehouse (3), got %d", len(nodes))
+	}
+
+	ids := make(map[string]bool)
+	for _, unit := range units {
+		if ids[unit.ID] {
+			t.Errorf("Duplicate unit ID %s", unit.ID)
+		}
+		ids[unit.ID] = true
+	}
+	for _, id := range []string{"C1-north", "C1-north-2", "C1-north-3", "C1-south", "C1-south-2", "C2-north"} {
+		if !ids[id] {
+			t.Errorf("Expected unit %s, got %v", id, ids)
+		}
+	}
+
+	am := NewAllocationManager(units, nodes)
+	if got := am.GetTotalStock("C1"); got != 5 {
+		t.Errorf("Expected C1 stock to sum to 5, got %d", got)
+	}
+	if got := am.GetTotalStock("C2"); got != 1 {
+		t.Errorf("Expected C2 stock of 1, got %d", got)
+	}
+
+	// Copies in the same warehouse are allocated independently
+	for i := 0; i < 3; i++ {
+		if _, _, err := am.Allocate("C1", "store-a", "R"); err != nil {
+			t.Fatalf("Allocate %d failed: %v", i+1, err)
+		}
+	}
+	if got := am.GetTotalStock("C1"); got != 2 {
+		t.Errorf("Expected 2 left after three allocations, got %d", got)
+	}
+}
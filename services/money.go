@@ -0,0 +1,15 @@
+package services
+
+import "math"
+
+// ToCentavos converts a peso amount to centavos, rounding to the nearest centavo.
+// Truncating instead can undercharge by a centavo when the float sits just below
+// the intended value (1000.9999 must become 100100, not 100099).
+func ToCentavos(amount float64) int {
+	return int(math.Round(amount * 100))
+}
+
+// RoundToCentavo rounds a peso amount to the nearest centavo
+func RoundToCentavo(amount float64) float64 {
+	return float64(ToCentavos(amount)) / 100
+}
@@ -0,0 +1,55 @@
+package services
+
+import "testing"
+
+func TestToCentavos(t *testing.T) {
+	// Each of these lands just below the intended centavo in float64,
+	// so int(amount * 100) would come out one centavo short
+	tests := []struct {
+		amount float64
+		want   int
+	}{
+		{1000.9999, 100100},
+		{0.29, 29},
+		{1.15, 115},
+		{19.99, 1999},
+		{4.35, 435},
+		{0, 0},
+		{-0.29, -29},
+	}
+	for _, tt := range tests {
+		if got := ToCentavos(tt.amount); got != tt.want {
+			t.Errorf("ToCentavos(%v) = %d, want %d", tt.amount, got, tt.want)
+		}
+	}
+}
+
+func TestRoundToCentavo(t *testing.T) {
+	tests := []struct {
+		amount float64
+		want   float64
+	}{
+		{1000.9999, 1001.00},
+		{120.004, 120.00},
+	}
+	for _, tt := range tests {
+		if got := RoundToCentavo(tt.amount); got != tt.want {
+			t.Errorf("RoundToCentavo(%v) = %v, want %v", tt.amount, got, tt.want)
+		}
+	}
+}
+
+func TestBuildCheckoutSessionRequest_RoundsToCentavos(t *testing.T) {
+	req := buildCheckoutSessionRequest(CheckoutSessionParams{BaseURL: "http://localhost:8080", RentalID: "rental-1", CollectibleName: "Figure", Duration: 7, DailyRate: 19.99, TaxAmount: 0.29})
+
+	items := req.Data.Attributes.LineItems
+	if len(items) != 2 {
+		t.Fatalf("Expected rental and VAT line items, got %d", len(items))
+	}
+	if items[0].Amount != 1999 {
+		t.Errorf("Expected daily rate of 1999 centavos, got %d", items[0].Amount)
+	}
+	if items[1].Amount != 29 {
+		t.Errorf("Expected VAT of 29 centavos, got %d", items[1].Amount)
+	}
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mongocollectibles/rental-system/models"
+)
+
+// NotificationService sends customer-facing messages about rentals.
+// Callers treat failures as non-fatal: they log them and carry on.
+type NotificationService interface {
+	SendRentalConfirmation(rental *models.Rental) error
+	SendRefundNotice(rental *models.Rental) error
+	SendBackInStock(entry *models.WaitlistEntry) error
+}
+
+// NoopNotificationService discards all notifications. It is the default when SMTP isn't configured.
+type NoopNotificationService struct{}
+
+// SendRentalConfirmation does nothing
+func (NoopNotificationService) SendRentalConfirmation(*models.Rental) error { return nil }
+
+// SendRefundNotice does nothing
+func (NoopNotificationService) SendRefundNotice(*models.Rental) error { return nil }
+
+// SendBackInStock does nothing
+func (NoopNotificationService) SendBackInStock(*models.WaitlistEntry) error { return nil }
+
+// smtpDialTimeout bounds how long a send may wait on an unreachable mail server
+const smtpDialTimeout = 10 * time.Second
+
+// SMTPNotificationService emails customers through an SMTP relay
+type SMTPNotificationService struct {
+	host     string
+	port     int
+	username string
+	password string
+	from     string
+}
+
+// NewSMTPNotificationService creates an SMTP notifier. Auth is skipped when username is empty.
+func NewSMTPNotificationService(host string, port int, username, password, from string) *SMTPNotificationService {
+	return &SMTPNotificationService{
+		host:     host,
+		port:     port,
+		username: username,
+		password: password,
+		from:     from,
+	}
+}
+
+// SendRentalConfirmation emails the customer that their rental is paid and being prepared
+func (s *SMTPNotificationService) SendRentalConfirmation(rental *models.Rental) error {
+	subject := "Your MongoCollectibles rental is confirmed"
+	body := fmt.Sprintf("Hi %s,\n\nYour payment for %s was received.\n\n"+
+		"Rental ID: %s\nDuration: %d days\nTotal paid: %s\nPickup store: %s\nEstimated ready in: %d days\n\n"+
+		"Thank you for renting with MongoCollectibles!\n",
+		rental.Customer.Name, rental.CollectibleName, rental.ID, rental.Duration, FormatPHP(rental.AmountCharged()), rental.StoreID, rental.ETA)
+	return s.send(rentalRecipient(rental), subject, body)
+}
+
+// SendRefundNotice emails the customer that their cancelled rental was refunded
+func (s *SMTPNotificationService) SendRefundNotice(rental *models.Rental) error {
+	subject := "Your MongoCollectibles refund is on its way"
+	body := fmt.Sprintf("Hi %s,\n\nYour rental of %s was cancelled and %s is being refunded "+
+		"to your original payment method.\n\nRental ID: %s\nRefund ID: %s\n",
+		rental.Customer.Name, rental.CollectibleName, FormatPHP(rental.AmountCharged()), rental.ID, rental.RefundID)
+	return s.send(rentalRecipient(rental), subject, body)
+}
+
+// SendBackInStock emails a waitlisted customer that a unit of their collectible was released
+func (s *SMTPNotificationService) SendBackInStock(entry *models.WaitlistEntry) error {
+	subject := fmt.Sprintf("%s is back in stock", entry.CollectibleName)
+	body := fmt.Sprintf("Hi %s,\n\nGood news: a unit of %s has just become available for rental.\n"+
+		"Units go to whoever checks out first, so reserve it soon if you're still interested.\n\n"+
+		"Thank you for your patience!\n",
+		entry.Name, entry.CollectibleName)
+	return s.send(entry.Email, subject, body)
+}
+
+// send delivers a plain-text email to a single recipient
+func (s *SMTPNotificationService) send(to, subject, body string) error {
+	if to == "" {
+		return fmt.Errorf("no recipient email")
+	}
+	// The recipient comes from customer input; refuse anything that could inject headers
+	if strings.ContainsAny(to, "\r\n") {
+		return fmt.Errorf("invalid recipient email %q", to)
+	}
+
+	addr := net.JoinHostPort(s.host, strconv.Itoa(s.port))
+	conn, err := net.DialTimeout("tcp", addr, smtpDialTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(smtpDialTimeout))
+
+	client, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(nil); err != nil {
+			return fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+	if s.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.username, s.password, s.host)); err != nil {
+			return fmt.Errorf("SMTP auth failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(s.from); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(buildMessage(s.from, to, subject, body)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// buildMessage formats a minimal RFC 5322 plain-text message
+func buildMessage(from, to, subject, body string) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + to + "\r\n")
+	b.WriteString("Subject: " + subject + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// rentalRecipient returns the customer email for a rental
+func rentalRecipient(rental *models.Rental) string {
+	if rental.CustomerEmail != "" {
+		return rental.CustomerEmail
+	}
+	return rental.Customer.Email
+}
@@ -0,0 +1,35 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mongocollectibles/rental-system/models"
+)
+
+func TestBuildMessage(t *testing.T) {
+	msg := string(buildMessage("shop@example.com", "juan@example.com", "Hello", "Line 1\nLine 2\n"))
+
+	for _, header := range []string{"From: shop@example.com\r\n", "To: juan@example.com\r\n", "Subject: Hello\r\n"} {
+		if !strings.Contains(msg, header) {
+			t.Errorf("Expected header %q in message:\n%s", header, msg)
+		}
+	}
+	if !strings.HasSuffix(msg, "\r\n\r\nLine 1\r\nLine 2\r\n") {
+		t.Errorf("Expected CRLF body after blank line, got %q", msg)
+	}
+}
+
+func TestSMTPNotificationService_RejectsBadRecipients(t *testing.T) {
+	// Port 0 would fail to dial; these must be rejected before any connection is attempted
+	s := NewSMTPNotificationService("localhost", 0, "", "", "shop@example.com")
+
+	if err := s.SendRentalConfirmation(&models.Rental{ID: "rental-1"}); err == nil || !strings.Contains(err.Error(), "no recipient") {
+		t.Errorf("Expected missing recipient error, got %v", err)
+	}
+
+	rental := &models.Rental{ID: "rental-1", CustomerEmail: "juan@example.com\r\nBcc: everyone@example.com"}
+	if err := s.SendRefundNotice(rental); err == nil || !strings.Contains(err.Error(), "invalid recipient") {
+		t.Errorf("Expected header injection to be rejected, got %v", err)
+	}
+}
@@ -6,25 +6,135 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/mongocollectibles/rental-system/models"
 )
 
+const (
+	// DefaultPayMongoAPIURL is the PayMongo REST API root used unless overridden
+	DefaultPayMongoAPIURL = "https://api.paymongo.com/v1"
+
+	// DefaultPaymentTimeout bounds a single PayMongo API call so a hung connection can't block checkout
+	DefaultPaymentTimeout = 10 * time.Second
+	// DefaultPaymentMaxRetries is how many times a transient PayMongo failure is retried
+	DefaultPaymentMaxRetries = 2
+)
+
+// paymentRetryBaseDelay is the first backoff between PayMongo retries; it doubles per attempt.
+// A variable so tests can shorten it.
+var paymentRetryBaseDelay = 200 * time.Millisecond
+
 // PaymentService handles PayMongo API integration
 type PaymentService struct {
-	secretKey string
-	publicKey string
-	client    *http.Client
+	secretKey  string
+	publicKey  string
+	apiBaseURL string
+	client     *http.Client
+	maxRetries int
 }
 
 // NewPaymentService creates a new payment service
 func NewPaymentService(secretKey, publicKey string) *PaymentService {
+	return NewPaymentServiceWithBaseURL(secretKey, publicKey, DefaultPayMongoAPIURL)
+}
+
+// NewPaymentServiceWithBaseURL creates a payment service that talks to the given API root
+// instead of PayMongo, e.g. an httptest server in unit tests
+func NewPaymentServiceWithBaseURL(secretKey, publicKey, apiBaseURL string) *PaymentService {
 	return &PaymentService{
-		secretKey: secretKey,
-		publicKey: publicKey,
-		client:    &http.Client{},
+		secretKey:  secretKey,
+		publicKey:  publicKey,
+		apiBaseURL: strings.TrimRight(apiBaseURL, "/"),
+		client:     &http.Client{Timeout: DefaultPaymentTimeout},
+		maxRetries: DefaultPaymentMaxRetries,
+	}
+}
+
+// SetTimeout changes the per-request timeout for PayMongo API calls.
+// Non-positive values are ignored.
+func (s *PaymentService) SetTimeout(d time.Duration) {
+	if d <= 0 {
+		return
 	}
+	s.client.Timeout = d
+}
+
+// SetMaxRetries changes how many times transient PayMongo failures are retried.
+// Negative values are ignored; zero disables retries.
+func (s *PaymentService) SetMaxRetries(n int) {
+	if n < 0 {
+		return
+	}
+	s.maxRetries = n
+}
+
+// doWithRetry sends the request built by newRequest, retrying network errors and 5xx responses
+// with exponential backoff. newRequest is called once per attempt so the body can be re-read.
+// A failed attempt may still have taken effect, so only GETs and requests carrying an
+// Idempotency-Key header are retried.
+func (s *PaymentService) doWithRetry(newRequest func() (*http.Request, error)) (*http.Response, error) {
+	delay := paymentRetryBaseDelay
+	for attempt := 0; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+
+		res, err := s.client.Do(req)
+		if err == nil && res.StatusCode < http.StatusInternalServerError {
+			return res, nil
+		}
+		retryable := req.Method == http.MethodGet || req.Header.Get("Idempotency-Key") != ""
+		if attempt >= s.maxRetries || !retryable {
+			if err != nil {
+				return nil, fmt.Errorf("failed to send request: %w", err)
+			}
+			return res, nil
+		}
+
+		if err != nil {
+			log.Printf("[Payment] PayMongo request failed (attempt %d/%d): %v", attempt+1, s.maxRetries+1, err)
+		} else {
+			log.Printf("[Payment] PayMongo returned %d (attempt %d/%d)", res.StatusCode, attempt+1, s.maxRetries+1)
+			res.Body.Close()
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// DefaultPaymentMethodTypes are offered when a checkout does not restrict payment methods
+var DefaultPaymentMethodTypes = []string{"qrph", "gcash", "paymaya", "card", "grab_pay", "dob", "dob_ubp"}
+
+// supportedPaymentMethodTypes is the set of PayMongo payment method types a checkout may request
+var supportedPaymentMethodTypes = map[string]bool{
+	"qrph":     true,
+	"gcash":    true,
+	"paymaya":  true,
+	"card":     true,
+	"grab_pay": true,
+	"dob":      true,
+	"dob_ubp":  true,
+}
+
+// resolvePaymentMethodTypes drops unknown or duplicate types and falls back to the default list if none remain
+func resolvePaymentMethodTypes(methods []string) []string {
+	var resolved []string
+	seen := make(map[string]bool)
+	for _, m := range methods {
+		if supportedPaymentMethodTypes[m] && !seen[m] {
+			seen[m] = true
+			resolved = append(resolved, m)
+		}
+	}
+	if len(resolved) == 0 {
+		return DefaultPaymentMethodTypes
+	}
+	return resolved
 }
 
 // PayMongoSessionRequest represents the request to create a checkout session
@@ -48,7 +158,7 @@ type PayMongoSessionAttributes struct {
 }
 
 type PayMongoLineItem struct {
-	Amount   int    `json:"amount"` // Amount in centavos
+	Amount   int    `json:"amount"` // Unit amount in centavos
 	Currency string `json:"currency"`
 	Name     string `json:"name"`
 	Quantity int    `json:"quantity"`
@@ -61,79 +171,220 @@ type PayMongoSessionResponse struct {
 		Attributes struct {
 			CheckoutURL string `json:"checkout_url"`
 			Status      string `json:"status"`
+			Payments    []struct {
+				ID string `json:"id"`
+			} `json:"payments"`
 		} `json:"attributes"`
 	} `json:"data"`
 }
 
+// CheckoutSessionParams describes the rental a checkout session bills for. Amounts are in pesos.
+type CheckoutSessionParams struct {
+	BaseURL         string // Public URL the success and cancel redirects are rooted at
+	RentalID        string
+	CollectibleName string
+	Duration        int // in days
+	DailyRate       float64
+	TaxAmount       float64
+	InsuranceFee    float64  // Optional damage waiver; zero when not taken
+	Deposit         float64  // Refundable deposit; zero when none is due
+	PaymentMethods  []string // Restricts the offered methods; empty means DefaultPaymentMethodTypes
+}
+
 // CreateCheckoutSession creates a checkout session via PayMongo API
-func (s *PaymentService) CreateCheckoutSession(baseURL string, amount float64, rentalID string, collectibleName string, duration int) (string, string, error) {
-	// Convert amount to centavos
+// The session is billed as DailyRate x Duration days, so its total matches CalculateRentalFee.
+// VAT, the optional damage waiver and any refundable deposit are billed as separate line items.
+func (s *PaymentService) CreateCheckoutSession(params CheckoutSessionParams) (string, string, error) {
+	requestData := buildCheckoutSessionRequest(params)
 
-	amountCentavos := int(amount * 100)
+	jsonData, err := json.Marshal(requestData)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to marshal request: %w", err)
+	}
 
-	requestData := PayMongoSessionRequest{
+	res, err := s.doWithRetry(func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", s.apiBaseURL+"/checkout_sessions", bytes.NewBuffer(jsonData))
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Add("accept", "application/json")
+		req.Header.Add("Content-Type", "application/json")
+		// A retry after a timeout must not open a second session for the same rental
+		req.Header.Add("Idempotency-Key", "checkout-session-"+params.RentalID)
+
+		// Use secret key from config
+		authKey := s.secretKey
+
+		// PayMongo requires Basic Auth with Secret Key as username and empty password
+		encodedKey := base64.StdEncoding.EncodeToString([]byte(authKey + ":"))
+		req.Header.Add("authorization", "Basic "+encodedKey)
+		return req, nil
+	})
+	if err != nil {
+		return "", "", err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusCreated {
+		return "", "", fmt.Errorf("paymongo api error (%d): %s", res.StatusCode, string(body))
+	}
+
+	var sessionResponse PayMongoSessionResponse
+	if err := json.Unmarshal(body, &sessionResponse); err != nil {
+		return "", "", fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return sessionResponse.Data.ID, sessionResponse.Data.Attributes.CheckoutURL, nil
+}
+
+// buildCheckoutSessionRequest assembles the PayMongo checkout session payload.
+// Success and cancel redirects are rooted at params.BaseURL.
+// The line item is priced per day with the rental duration as its quantity,
+// so the PayMongo receipt reads "PHP X/day x N days".
+func buildCheckoutSessionRequest(params CheckoutSessionParams) PayMongoSessionRequest {
+	// Convert daily rate to centavos
+	dailyRateCentavos := ToCentavos(params.DailyRate)
+
+	lineItems := []PayMongoLineItem{
+		{
+			Amount:   dailyRateCentavos,
+			Currency: "PHP",
+			Name:     fmt.Sprintf("%s (Daily Rental)", params.CollectibleName),
+			Quantity: params.Duration,
+		},
+	}
+	// VAT is its own line so the PayMongo receipt shows the tax separately
+	if taxCentavos := ToCentavos(params.TaxAmount); taxCentavos > 0 {
+		lineItems = append(lineItems, PayMongoLineItem{
+			Amount:   taxCentavos,
+			Currency: "PHP",
+			Name:     "VAT",
+			Quantity: 1,
+		})
+	}
+	if insuranceCentavos := ToCentavos(params.InsuranceFee); insuranceCentavos > 0 {
+		lineItems = append(lineItems, PayMongoLineItem{
+			Amount:   insuranceCentavos,
+			Currency: "PHP",
+			Name:     "Damage Waiver",
+			Quantity: 1,
+		})
+	}
+	// The deposit is kept apart from the fee so it can be refunded on its own
+	if depositCentavos := ToCentavos(params.Deposit); depositCentavos > 0 {
+		lineItems = append(lineItems, PayMongoLineItem{
+			Amount:   depositCentavos,
+			Currency: "PHP",
+			Name:     "Refundable Deposit",
+			Quantity: 1,
+		})
+	}
+
+	return PayMongoSessionRequest{
 		Data: PayMongoSessionData{
 			Attributes: PayMongoSessionAttributes{
-				LineItems: []PayMongoLineItem{
-					{
-						Amount:   amountCentavos,
-						Currency: "PHP",
-						Name:     fmt.Sprintf("%s (%d Days Rental)", collectibleName, duration),
-						Quantity: 1,
-					},
-				},
-				PaymentMethodTypes: []string{"qrph", "gcash", "paymaya", "card", "grab_pay", "dob", "dob_ubp"},
-				Description:        fmt.Sprintf("Rental for %s (%d days)", collectibleName, duration),
+				LineItems:          lineItems,
+				PaymentMethodTypes: resolvePaymentMethodTypes(params.PaymentMethods),
+				Description:        fmt.Sprintf("Rental for %s (%d days)", params.CollectibleName, params.Duration),
 				SendEmailReceipt:   true,
 				ShowDescription:    true,
 				ShowLineItems:      true,
-				SuccessUrl:         fmt.Sprintf("%s/payment/success?rental_id=%s", baseURL, rentalID),
-				CancelUrl:          fmt.Sprintf("%s/payment/failed?rental_id=%s", baseURL, rentalID),
+				SuccessUrl:         fmt.Sprintf("%s/payment/success?rental_id=%s", params.BaseURL, params.RentalID),
+				CancelUrl:          fmt.Sprintf("%s/payment/failed?rental_id=%s", params.BaseURL, params.RentalID),
 			},
 		},
 	}
+}
 
-	jsonData, err := json.Marshal(requestData)
+// PayMongoRefundRequest represents the request to refund a payment
+type PayMongoRefundRequest struct {
+	Data PayMongoRefundData `json:"data"`
+}
+
+type PayMongoRefundData struct {
+	Attributes PayMongoRefundAttributes `json:"attributes"`
+}
+
+type PayMongoRefundAttributes struct {
+	Amount    int    `json:"amount"` // Amount in centavos
+	PaymentID string `json:"payment_id"`
+	Reason    string `json:"reason"` // duplicate, fraudulent, requested_by_customer, others
+	Notes     string `json:"notes,omitempty"`
+}
+
+// PayMongoRefundResponse represents the response from creating a refund
+type PayMongoRefundResponse struct {
+	Data struct {
+		ID         string `json:"id"`
+		Attributes struct {
+			Status string `json:"status"`
+		} `json:"attributes"`
+	} `json:"data"`
+}
+
+// CreateRefund refunds part or all of a PayMongo payment and returns the provider refund ID
+func (s *PaymentService) CreateRefund(paymentID string, amountCentavos int, reason string) (string, error) {
+	if amountCentavos <= 0 {
+		return "", fmt.Errorf("refund amount must be positive")
+	}
+	if reason == "" {
+		reason = "requested_by_customer"
+	}
+
+	reqData := PayMongoRefundRequest{
+		Data: PayMongoRefundData{
+			Attributes: PayMongoRefundAttributes{
+				Amount:    amountCentavos,
+				PaymentID: paymentID,
+				Reason:    reason,
+			},
+		},
+	}
+
+	jsonData, err := json.Marshal(reqData)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to marshal request: %w", err)
+		return "", fmt.Errorf("failed to marshal refund request: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", "https://api.paymongo.com/v1/checkout_sessions", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequest("POST", s.apiBaseURL+"/refunds", bytes.NewBuffer(jsonData))
 	if err != nil {
-		return "", "", fmt.Errorf("failed to create request: %w", err)
+		return "", fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Add("accept", "application/json")
 	req.Header.Add("Content-Type", "application/json")
 
-	// Use secret key from config
 	authKey := s.secretKey
-
-	// PayMongo requires Basic Auth with Secret Key as username and empty password
 	encodedKey := base64.StdEncoding.EncodeToString([]byte(authKey + ":"))
 	req.Header.Add("authorization", "Basic "+encodedKey)
 
 	res, err := s.client.Do(req)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to send request: %w", err)
+		return "", fmt.Errorf("failed to send request: %w", err)
 	}
 	defer res.Body.Close()
 
 	body, err := io.ReadAll(res.Body)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to read response: %w", err)
+		return "", fmt.Errorf("failed to read response: %w", err)
 	}
 
 	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusCreated {
-		return "", "", fmt.Errorf("paymongo api error (%d): %s", res.StatusCode, string(body))
+		return "", fmt.Errorf("paymongo api error (%d): %s", res.StatusCode, string(body))
 	}
 
-	var sessionResponse PayMongoSessionResponse
-	if err := json.Unmarshal(body, &sessionResponse); err != nil {
-		return "", "", fmt.Errorf("failed to parse response: %w", err)
+	var refundResponse PayMongoRefundResponse
+	if err := json.Unmarshal(body, &refundResponse); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
 	}
 
-	return sessionResponse.Data.ID, sessionResponse.Data.Attributes.CheckoutURL, nil
+	return refundResponse.Data.ID, nil
 }
 
 // PayMongoCustomerRequest represents request to create a customer
@@ -161,14 +412,7 @@ type PayMongoCustomerResponse struct {
 
 // CreateCustomer creates a customer in PayMongo
 func (s *PaymentService) CreateCustomer(customer models.Customer) (string, error) {
-
-	var firstName, lastName string
-
-	nameParts := SplitName(customer.Name)
-	firstName = nameParts[0]
-	if len(nameParts) > 1 {
-		lastName = nameParts[1]
-	}
+	firstName, lastName := CustomerNameParts(customer)
 
 	reqData := PayMongoCustomerRequest{
 		Data: PayMongoCustomerData{
@@ -186,7 +430,7 @@ func (s *PaymentService) CreateCustomer(customer models.Customer) (string, error
 		return "", fmt.Errorf("failed to marshal customer request: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", "https://api.paymongo.com/v1/customers", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequest("POST", s.apiBaseURL+"/customers", bytes.NewBuffer(jsonData))
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
 	}
@@ -221,50 +465,103 @@ func (s *PaymentService) CreateCustomer(customer models.Customer) (string, error
 	return custResponse.Data.ID, nil
 }
 
-// SplitName helper
-func SplitName(name string) []string {
+// VerifyPayment verifies a payment status
+func (s *PaymentService) VerifyPayment(sessionID string) (models.PaymentStatus, error) {
+	session, err := s.getCheckoutSession(sessionID)
+	if err != nil {
+		return models.PaymentFailed, err
+	}
 
-	var first, last string
-	for i := len(name) - 1; i >= 0; i-- {
-		if name[i] == ' ' {
-			first = name[:i]
-			last = name[i+1:]
-			return []string{first, last}
-		}
+	return paymentStatusFromSession(session.Data.Attributes.Status), nil
+}
+
+// GetSessionPaymentID returns the ID of the payment made through a checkout session.
+// Refunds are issued against this payment ID, not the session ID.
+func (s *PaymentService) GetSessionPaymentID(sessionID string) (string, error) {
+	session, err := s.getCheckoutSession(sessionID)
+	if err != nil {
+		return "", err
+	}
+
+	payments := session.Data.Attributes.Payments
+	if len(payments) == 0 {
+		return "", fmt.Errorf("checkout session %s has no payments", sessionID)
 	}
-	return []string{name, ""}
+	return payments[0].ID, nil
 }
 
-// VerifyPayment verifies a payment status
-func (s *PaymentService) VerifyPayment(sessionID string) (models.PaymentStatus, error) {
-	req, err := http.NewRequest("GET", "https://api.paymongo.com/v1/checkout_sessions/"+sessionID, nil)
+// ExpireCheckoutSession closes a checkout session so the customer can no longer pay through it.
+// Expiring is safe to repeat, so the request is sent with an Idempotency-Key and may be retried.
+func (s *PaymentService) ExpireCheckoutSession(sessionID string) error {
+	res, err := s.doWithRetry(func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", s.apiBaseURL+"/checkout_sessions/"+sessionID+"/expire", nil)
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Add("accept", "application/json")
+		req.Header.Add("Idempotency-Key", "expire-"+sessionID)
+
+		authKey := s.secretKey
+		encodedKey := base64.StdEncoding.EncodeToString([]byte(authKey + ":"))
+		req.Header.Add("authorization", "Basic "+encodedKey)
+		return req, nil
+	})
 	if err != nil {
-		return models.PaymentFailed, err
+		return err
 	}
+	defer res.Body.Close()
 
-	authKey := s.secretKey
-	encodedKey := base64.StdEncoding.EncodeToString([]byte(authKey + ":"))
-	req.Header.Add("authorization", "Basic "+encodedKey)
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("paymongo api error (%d): %s", res.StatusCode, string(body))
+	}
+	return nil
+}
 
-	res, err := s.client.Do(req)
+// getCheckoutSession retrieves a checkout session from PayMongo
+func (s *PaymentService) getCheckoutSession(sessionID string) (*PayMongoSessionResponse, error) {
+	res, err := s.doWithRetry(func() (*http.Request, error) {
+		req, err := http.NewRequest("GET", s.apiBaseURL+"/checkout_sessions/"+sessionID, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		authKey := s.secretKey
+		encodedKey := base64.StdEncoding.EncodeToString([]byte(authKey + ":"))
+		req.Header.Add("authorization", "Basic "+encodedKey)
+		return req, nil
+	})
 	if err != nil {
-		return models.PaymentFailed, err
+		return nil, err
 	}
 	defer res.Body.Close()
 
 	body, err := io.ReadAll(res.Body)
 	if err != nil {
-		return models.PaymentFailed, err
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("paymongo api error (%d): %s", res.StatusCode, string(body))
 	}
 
 	var sessionResponse PayMongoSessionResponse
 	if err := json.Unmarshal(body, &sessionResponse); err != nil {
-		return models.PaymentFailed, err
+		return nil, fmt.Errorf("failed to parse response: %w", err)
 	}
+	return &sessionResponse, nil
+}
 
-	if sessionResponse.Data.Attributes.Status == "paid" {
-		return models.PaymentCompleted, nil
+// paymentStatusFromSession maps a PayMongo checkout session status to a rental payment status.
+// Unknown statuses are treated as pending so a rental is never released on a status we don't understand.
+func paymentStatusFromSession(status string) models.PaymentStatus {
+	switch status {
+	case "paid":
+		return models.PaymentCompleted
+	case "expired", "cancelled":
+		return models.PaymentFailed
+	default: // "unpaid", "active"
+		return models.PaymentPending
 	}
-
-	return models.PaymentPending, nil
 }
@@ -0,0 +1,311 @@
+package services
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mongocollectibles/rental-system/models"
+)
+
+func TestBuildCheckoutSessionRequest_RedirectURLs(t *testing.T) {
+	req := buildCheckoutSessionRequest(CheckoutSessionParams{BaseURL: "https://rentals.example.com", RentalID: "rental-1", CollectibleName: "Vintage Batman Action Figure", Duration: 7, DailyRate: 700})
+	attrs := req.Data.Attributes
+
+	if want := "https://rentals.example.com/payment/success?rental_id=rental-1"; attrs.SuccessUrl != want {
+		t.Errorf("Expected success_url %q, got %q", want, attrs.SuccessUrl)
+	}
+	if !strings.HasPrefix(attrs.CancelUrl, "https://rentals.example.com/payment/failed") {
+		t.Errorf("Expected cancel_url under configured base, got %q", attrs.CancelUrl)
+	}
+}
+
+func TestBuildCheckoutSessionRequest_LineItemMatchesRentalFee(t *testing.T) {
+	pricing := NewPricingService()
+
+	tests := []struct {
+		name     string
+		size     models.Size
+		duration int
+	}{
+		{"Special rate", models.SizeSmall, 3},
+		{"Standard rate", models.SizeMedium, 7},
+		{"Long-term discount", models.SizeLarge, 45},
+		{"Extended discount", models.SizeSmall, 120},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dailyRate, totalFee, _, _ := pricing.CalculateRentalFee(tt.size, tt.duration)
+			req := buildCheckoutSessionRequest(CheckoutSessionParams{BaseURL: "http://localhost:8080", RentalID: "rental-1", CollectibleName: "Item", Duration: tt.duration, DailyRate: dailyRate})
+
+			item := req.Data.Attributes.LineItems[0]
+			if item.Quantity != tt.duration {
+				t.Errorf("Expected quantity %d, got %d", tt.duration, item.Quantity)
+			}
+			if got, want := item.Amount*item.Quantity, int(math.Round(totalFee*100)); got != want {
+				t.Errorf("Expected amount*quantity = %d centavos, got %d", want, got)
+			}
+		})
+	}
+}
+
+func TestResolvePaymentMethodTypes(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []string
+		want  []string
+	}{
+		{"Empty falls back to default", nil, DefaultPaymentMethodTypes},
+		{"Card only", []string{"card"}, []string{"card"}},
+		{"Unknown methods are dropped", []string{"card", "bitcoin", "card"}, []string{"card"}},
+		{"Only unknown falls back to default", []string{"bitcoin"}, DefaultPaymentMethodTypes},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := resolvePaymentMethodTypes(tt.input)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("resolvePaymentMethodTypes(%v) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPaymentService_DoWithRetry(t *testing.T) {
+	original := paymentRetryBaseDelay
+	paymentRetryBaseDelay = time.Millisecond
+	defer func() { paymentRetryBaseDelay = original }()
+
+	newServer := func(failures int32) (*httptest.Server, *int32) {
+		var calls int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) <= failures {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		return srv, &calls
+	}
+
+	t.Run("Succeeds after two 500s", func(t *testing.T) {
+		srv, calls := newServer(2)
+		defer srv.Close()
+
+		s := NewPaymentService("", "")
+		res, err := s.doWithRetry(func() (*http.Request, error) {
+			return http.NewRequest(http.MethodGet, srv.URL, nil)
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("Expected 200 after retries, got %d", res.StatusCode)
+		}
+		if got := atomic.LoadInt32(calls); got != 3 {
+			t.Errorf("Expected 3 attempts, got %d", got)
+		}
+	})
+
+	t.Run("POST without an Idempotency-Key is not retried", func(t *testing.T) {
+		srv, calls := newServer(1)
+		defer srv.Close()
+
+		s := NewPaymentService("", "")
+		res, err := s.doWithRetry(func() (*http.Request, error) {
+			return http.NewRequest(http.MethodPost, srv.URL, nil)
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusInternalServerError {
+			t.Errorf("Expected the 500 to be returned, got %d", res.StatusCode)
+		}
+		if got := atomic.LoadInt32(calls); got != 1 {
+			t.Errorf("Expected a single attempt, got %d", got)
+		}
+	})
+
+	t.Run("Gives up after max retries", func(t *testing.T) {
+		srv, calls := newServer(10)
+		defer srv.Close()
+
+		s := NewPaymentService("", "")
+		s.SetMaxRetries(1)
+		res, err := s.doWithRetry(func() (*http.Request, error) {
+			return http.NewRequest(http.MethodGet, srv.URL, nil)
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusInternalServerError {
+			t.Errorf("Expected final 500 to be returned, got %d", res.StatusCode)
+		}
+		if got := atomic.LoadInt32(calls); got != 2 {
+			t.Errorf("Expected 2 attempts, got %d", got)
+		}
+	})
+}
+
+func TestPaymentService_CreateCheckoutSession(t *testing.T) {
+	var got PayMongoSessionRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/checkout_sessions" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if user, _, ok := r.BasicAuth(); !ok || user != "sk_test" {
+			t.Errorf("Expected basic auth with secret key, got %q", r.Header.Get("Authorization"))
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"data":{"id":"cs_123","attributes":{"checkout_url":"https://checkout.example/cs_123","status":"active"}}}`))
+	}))
+	defer srv.Close()
+
+	s := NewPaymentServiceWithBaseURL("sk_test", "pk_test", srv.URL)
+	id, url, err := s.CreateCheckoutSession(CheckoutSessionParams{BaseURL: "http://localhost:8080", RentalID: "rental-1", CollectibleName: "Item", Duration: 7, DailyRate: 1000, TaxAmount: 840, PaymentMethods: []string{"card"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if id != "cs_123" || url != "https://checkout.example/cs_123" {
+		t.Errorf("Unexpected session %q %q", id, url)
+	}
+	if methods := got.Data.Attributes.PaymentMethodTypes; len(methods) != 1 || methods[0] != "card" {
+		t.Errorf("Expected card-only session, got %v", methods)
+	}
+}
+
+func TestPaymentService_CreateCheckoutSessionRetry(t *testing.T) {
+	original := paymentRetryBaseDelay
+	paymentRetryBaseDelay = time.Millisecond
+	defer func() { paymentRetryBaseDelay = original }()
+
+	var keys []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		if len(keys) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"data":{"id":"cs_123","attributes":{"checkout_url":"https://checkout.example/cs_123","status":"active"}}}`))
+	}))
+	defer srv.Close()
+
+	s := NewPaymentServiceWithBaseURL("sk_test", "pk_test", srv.URL)
+	if _, _, err := s.CreateCheckoutSession(CheckoutSessionParams{RentalID: "rental-1", CollectibleName: "Item", Duration: 7, DailyRate: 1000}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// PayMongo dedupes the retry against the first attempt by its key
+	if len(keys) != 2 || keys[0] == "" || keys[0] != keys[1] {
+		t.Errorf("Expected two attempts with the same Idempotency-Key, got %q", keys)
+	}
+}
+
+func TestPaymentService_VerifyPayment(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/checkout_sessions/cs_paid" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		w.Write([]byte(`{"data":{"id":"cs_paid","attributes":{"status":"paid"}}}`))
+	}))
+	defer srv.Close()
+
+	s := NewPaymentServiceWithBaseURL("sk_test", "pk_test", srv.URL)
+	status, err := s.VerifyPayment("cs_paid")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if status != models.PaymentCompleted {
+		t.Errorf("Expected completed, got %s", status)
+	}
+}
+
+func TestPaymentService_ExpireCheckoutSession(t *testing.T) {
+	var method, path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		if path == "/checkout_sessions/cs_paid/expire" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"errors":[{"code":"resource_invalid_state"}]}`))
+			return
+		}
+		w.Write([]byte(`{"data":{"id":"cs_1","attributes":{"status":"expired"}}}`))
+	}))
+	defer srv.Close()
+
+	s := NewPaymentServiceWithBaseURL("sk_test", "pk_test", srv.URL)
+	if err := s.ExpireCheckoutSession("cs_1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if method != http.MethodPost || path != "/checkout_sessions/cs_1/expire" {
+		t.Errorf("Expected POST /checkout_sessions/cs_1/expire, got %s %s", method, path)
+	}
+
+	// A session that was already paid can't be expired
+	if err := s.ExpireCheckoutSession("cs_paid"); err == nil {
+		t.Error("Expected an error for a session that can't be expired")
+	}
+}
+
+func TestPaymentStatusFromSession(t *testing.T) {
+	tests := []struct {
+		status string
+		want   models.PaymentStatus
+	}{
+		{"paid", models.PaymentCompleted},
+		{"expired", models.PaymentFailed},
+		{"cancelled", models.PaymentFailed},
+		{"unpaid", models.PaymentPending},
+		{"active", models.PaymentPending},
+		{"", models.PaymentPending},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			if got := paymentStatusFromSession(tt.status); got != tt.want {
+				t.Errorf("paymentStatusFromSession(%q) = %s, want %s", tt.status, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildCheckoutSessionRequest_VATLineItem(t *testing.T) {
+	req := buildCheckoutSessionRequest(CheckoutSessionParams{BaseURL: "http://localhost:8080", RentalID: "rental-1", CollectibleName: "Item", Duration: 7, DailyRate: 1000, TaxAmount: 840})
+	items := req.Data.Attributes.LineItems
+	if len(items) != 2 {
+		t.Fatalf("Expected rental and VAT line items, got %+v", items)
+	}
+	if items[1].Name != "VAT" || items[1].Amount != 84000 || items[1].Quantity != 1 {
+		t.Errorf("Unexpected VAT line item: %+v", items[1])
+	}
+
+	// Tax-exempt sessions carry only the rental line
+	req = buildCheckoutSessionRequest(CheckoutSessionParams{BaseURL: "http://localhost:8080", RentalID: "rental-1", CollectibleName: "Item", Duration: 7, DailyRate: 1000})
+	if n := len(req.Data.Attributes.LineItems); n != 1 {
+		t.Errorf("Expected 1 line item without VAT, got %d", n)
+	}
+}
+
+func TestBuildCheckoutSessionRequest_DepositLineItem(t *testing.T) {
+	req := buildCheckoutSessionRequest(CheckoutSessionParams{BaseURL: "http://localhost:8080", RentalID: "rental-1", CollectibleName: "Item", Duration: 7, DailyRate: 10000, TaxAmount: 8400, Deposit: 5000})
+	items := req.Data.Attributes.LineItems
+	if len(items) != 3 {
+		t.Fatalf("Expected rental, VAT and deposit line items, got %+v", items)
+	}
+	if items[2].Name != "Refundable Deposit" || items[2].Amount != 500000 || items[2].Quantity != 1 {
+		t.Errorf("Unexpected deposit line item: %+v", items[2])
+	}
+}
@@ -1,48 +1,166 @@
 package services
 
 import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
 	"github.com/mongocollectibles/rental-system/models"
 )
 
 const (
-	MinimumRentalDays = 7
+	MinimumRentalDays     = 7
 	SpecialRateMultiplier = 2.0
+
+	// Long-term discount tiers, applied to the daily rate
+	LongTermDiscountDays    = 30
+	LongTermDiscountPercent = 10.0
+	ExtendedDiscountDays    = 90
+	ExtendedDiscountPercent = 20.0
+
+	// DefaultMaxRentalDays caps how long a single rental may run
+	DefaultMaxRentalDays = 365
+
+	// Currency is the ISO code all prices are charged in
+	Currency = "PHP"
+
+	// DefaultVATRate is the Philippine value-added tax charged on top of rental fees
+	DefaultVATRate = 0.12
+
+	// InsuranceFeePercent is the optional damage waiver's price, as a share of the rental fee
+	InsuranceFeePercent = 10.0
 )
 
+// ErrInvalidDuration is returned for rental durations shorter than one day
+var ErrInvalidDuration = errors.New("rental duration must be at least 1 day")
+
+// ErrDurationTooLong is returned for rental durations above the configured maximum
+var ErrDurationTooLong = errors.New("rental duration exceeds the maximum allowed")
+
+// depositDailyRateShare maps each size to the share of one day's base rate held as a
+// refundable security deposit. Only large, high-value items require one.
+var depositDailyRateShare = map[models.Size]float64{
+	models.SizeSmall:  0,
+	models.SizeMedium: 0,
+	models.SizeLarge:  0.5,
+}
+
 // PricingService handles rental fee calculations
-type PricingService struct{}
+type PricingService struct {
+	maxRentalDays int
+	vatRate       float64
+}
 
 // NewPricingService creates a new pricing service
 func NewPricingService() *PricingService {
-	return &PricingService{}
+	return &PricingService{
+		maxRentalDays: DefaultMaxRentalDays,
+		vatRate:       DefaultVATRate,
+	}
+}
+
+// SetVATRate overrides the VAT rate (e.g. 0.12 for 12%). Zero disables tax for
+// tax-exempt deployments; negative values are ignored.
+func (s *PricingService) SetVATRate(rate float64) {
+	if rate < 0 {
+		return
+	}
+	s.vatRate = rate
+}
+
+// VATRate returns the VAT rate applied to rental fees
+func (s *PricingService) VATRate() float64 {
+	return s.vatRate
+}
+
+// CalculateTax returns the VAT owed on a tax-exclusive amount, rounded to the centavo
+func (s *PricingService) CalculateTax(amount float64) float64 {
+	return RoundToCentavo(amount * s.vatRate)
+}
+
+// CalculateDeposit returns the refundable security deposit collected at checkout for a size.
+// It is not taxed and is refunded in full when the collectible is returned.
+func (s *PricingService) CalculateDeposit(size models.Size) float64 {
+	return RoundToCentavo(size.GetDailyRate() * depositDailyRateShare[size])
+}
+
+// CalculateInsuranceFee returns the price of the optional damage waiver for a
+// tax-exclusive rental fee, rounded to the centavo
+func (s *PricingService) CalculateInsuranceFee(totalFee float64) float64 {
+	return RoundToCentavo(totalFee * InsuranceFeePercent / 100)
+}
+
+// SetMaxRentalDays overrides the longest allowed rental.
+// Non-positive values are ignored so the current cap stays in effect.
+func (s *PricingService) SetMaxRentalDays(days int) {
+	if days <= 0 {
+		return
+	}
+	s.maxRentalDays = days
+}
+
+// MaxRentalDays returns the longest allowed rental in days
+func (s *PricingService) MaxRentalDays() int {
+	return s.maxRentalDays
+}
+
+// ValidateDuration checks that a rental duration (in days) is between 1 and MaxRentalDays
+func (s *PricingService) ValidateDuration(duration int) error {
+	if duration < 1 {
+		return ErrInvalidDuration
+	}
+	if duration > s.maxRentalDays {
+		return fmt.Errorf("%w (%d days)", ErrDurationTooLong, s.maxRentalDays)
+	}
+	return nil
 }
 
 // CalculateRentalFee calculates the total rental fee based on size and duration
-// Returns the daily rate, total fee, and whether special rate was applied
-func (s *PricingService) CalculateRentalFee(size models.Size, duration int) (dailyRate float64, totalFee float64, isSpecialRate bool) {
+// Returns the daily rate, total fee, whether special rate was applied, and any long-term discount percent
+func (s *PricingService) CalculateRentalFee(size models.Size, duration int) (dailyRate float64, totalFee float64, isSpecialRate bool, discountPercent float64) {
 	// Get base daily rate for the size
 	baseRate := size.GetDailyRate()
-	
+
 	// Determine if special rate applies (duration < minimum)
 	isSpecialRate = duration < MinimumRentalDays
-	
+
 	// Calculate daily rate
 	if isSpecialRate {
 		dailyRate = baseRate * SpecialRateMultiplier
 	} else {
 		dailyRate = baseRate
 	}
-	
+
+	// Reward long rentals with a discounted daily rate
+	discountPercent = s.LongTermDiscountPercent(duration)
+	dailyRate = dailyRate * (1 - discountPercent/100)
+
 	// Calculate total fee
 	totalFee = dailyRate * float64(duration)
-	
-	return dailyRate, totalFee, isSpecialRate
+
+	return dailyRate, totalFee, isSpecialRate, discountPercent
+}
+
+// LongTermDiscountPercent returns the discount tier (in percent) for a rental duration
+func (s *PricingService) LongTermDiscountPercent(duration int) float64 {
+	switch {
+	case duration >= ExtendedDiscountDays:
+		return ExtendedDiscountPercent
+	case duration >= LongTermDiscountDays:
+		return LongTermDiscountPercent
+	default:
+		return 0
+	}
 }
 
 // CalculateQuote generates a rental quote for a collectible
 func (s *PricingService) CalculateQuote(collectible *models.Collectible, duration int) models.RentalQuoteResponse {
-	dailyRate, totalFee, isSpecialRate := s.CalculateRentalFee(collectible.Size, duration)
-	
+	dailyRate, totalFee, isSpecialRate, discountPercent := s.CalculateRentalFee(collectible.Size, duration)
+	taxAmount := s.CalculateTax(totalFee)
+	deposit := s.CalculateDeposit(collectible.Size)
+
 	return models.RentalQuoteResponse{
 		CollectibleID:   collectible.ID,
 		CollectibleName: collectible.Name,
@@ -50,6 +168,76 @@ func (s *PricingService) CalculateQuote(collectible *models.Collectible, duratio
 		Duration:        duration,
 		DailyRate:       dailyRate,
 		TotalFee:        totalFee,
+		TaxAmount:       taxAmount,
+		TotalWithTax:    totalFee + taxAmount,
+		Deposit:         deposit,
+		TotalDue:        totalFee + taxAmount + deposit,
+		InsuranceFee:    s.CalculateInsuranceFee(totalFee),
 		IsSpecialRate:   isSpecialRate,
+		DiscountPercent: discountPercent,
+	}
+}
+
+// BuildReceipt itemizes what was charged for a rental. Amounts come from the rental as it
+// was priced at checkout, so the receipt matches the payment even if rates or VAT changed since.
+func (s *PricingService) BuildReceipt(collectible *models.Collectible, rental *models.Rental) models.Receipt {
+	multiplier := 1.0
+	if rental.Duration < MinimumRentalDays {
+		multiplier = SpecialRateMultiplier
+	}
+	grandTotal := rental.AmountCharged() + rental.LateFee
+
+	return models.Receipt{
+		CollectibleID:     collectible.ID,
+		CollectibleName:   collectible.Name,
+		Size:              collectible.Size,
+		Duration:          rental.Duration,
+		BaseDailyRate:     collectible.Size.GetDailyRate(),
+		RateMultiplier:    multiplier,
+		DiscountPercent:   s.LongTermDiscountPercent(rental.Duration),
+		DailyRate:         rental.DailyRate,
+		Subtotal:          rental.TotalFee,
+		TaxAmount:         rental.TaxAmount,
+		InsuranceFee:      rental.InsuranceFee,
+		Deposit:           rental.Deposit,
+		LateFee:           rental.LateFee,
+		GrandTotal:        grandTotal,
+		Currency:          Currency,
+		GrandTotalDisplay: FormatPHP(grandTotal),
+	}
+}
+
+// FormatPHP formats an amount as pesos with thousands separators, e.g. "PHP 12,345.60"
+func FormatPHP(amount float64) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	centavos := int64(ToCentavos(amount))
+	whole := strconv.FormatInt(centavos/100, 10)
+	for i := len(whole) - 3; i > 0; i -= 3 {
+		whole = whole[:i] + "," + whole[i:]
+	}
+	return fmt.Sprintf("%s %s%s.%02d", Currency, sign, whole, centavos%100)
+}
+
+// CalculateLateFee returns the overage owed for keeping a collectible past its due date.
+// Late days are charged at the special (2x) daily rate for the size.
+func (s *PricingService) CalculateLateFee(size models.Size, daysLate int) float64 {
+	if daysLate <= 0 {
+		return 0
+	}
+	return size.GetDailyRate() * SpecialRateMultiplier * float64(daysLate)
+}
+
+// DaysLate returns how many days past the due date (start + duration) a return happened.
+// Any partial day counts as a full late day.
+func (s *PricingService) DaysLate(startedAt time.Time, duration int, returnedAt time.Time) int {
+	dueAt := startedAt.AddDate(0, 0, duration)
+	if !returnedAt.After(dueAt) {
+		return 0
 	}
+	return int(math.Ceil(returnedAt.Sub(dueAt).Hours() / 24))
 }
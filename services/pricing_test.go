@@ -0,0 +1,275 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mongocollectibles/rental-system/models"
+)
+
+func TestPricingService_CalculateRentalFee_Discounts(t *testing.T) {
+	s := NewPricingService()
+
+	tests := []struct {
+		name         string
+		duration     int
+		wantRate     float64
+		wantDiscount float64
+		wantSpecial  bool
+	}{
+		{"Short rental pays special rate", 3, 2000, 0, true},
+		{"Standard rental", 7, 1000, 0, false},
+		{"29 days has no discount", 29, 1000, 0, false},
+		{"30 days gets 10% off", 30, 900, 10, false},
+		{"89 days gets 10% off", 89, 900, 10, false},
+		{"90 days gets 20% off", 90, 800, 20, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, total, special, discount := s.CalculateRentalFee(models.SizeSmall, tt.duration)
+			if rate != tt.wantRate {
+				t.Errorf("daily rate = %.2f, want %.2f", rate, tt.wantRate)
+			}
+			if total != tt.wantRate*float64(tt.duration) {
+				t.Errorf("total = %.2f, want %.2f", total, tt.wantRate*float64(tt.duration))
+			}
+			if special != tt.wantSpecial {
+				t.Errorf("special = %v, want %v", special, tt.wantSpecial)
+			}
+			if discount != tt.wantDiscount {
+				t.Errorf("discount = %.0f%%, want %.0f%%", discount, tt.wantDiscount)
+			}
+		})
+	}
+}
+
+func TestPricingService_CalculateLateFee(t *testing.T) {
+	s := NewPricingService()
+
+	tests := []struct {
+		name     string
+		size     models.Size
+		daysLate int
+		want     float64
+	}{
+		{"Small 1 day", models.SizeSmall, 1, 2000},
+		{"Medium 2 days", models.SizeMedium, 2, 20000},
+		{"Large 3 days", models.SizeLarge, 3, 60000}, // 10000 base x 2 x 3
+		{"Zero days", models.SizeLarge, 0, 0},
+		{"Negative days", models.SizeMedium, -4, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.CalculateLateFee(tt.size, tt.daysLate); got != tt.want {
+				t.Errorf("CalculateLateFee(%s, %d) = %.2f, want %.2f", tt.size, tt.daysLate, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPricingService_DaysLate(t *testing.T) {
+	s := NewPricingService()
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		returned time.Time
+		want     int
+	}{
+		{"Early", start.AddDate(0, 0, 5), 0},
+		{"Exactly on due date", start.AddDate(0, 0, 7), 0},
+		{"One hour late counts as a day", start.AddDate(0, 0, 7).Add(time.Hour), 1},
+		{"Three days late", start.AddDate(0, 0, 10), 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.DaysLate(start, 7, tt.returned); got != tt.want {
+				t.Errorf("DaysLate = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPricingService_ValidateDuration(t *testing.T) {
+	s := NewPricingService()
+
+	tests := []struct {
+		duration int
+		wantErr  bool
+	}{
+		{-1, true},
+		{0, true},
+		{1, false},
+		{7, false},
+		{DefaultMaxRentalDays, false},
+		{DefaultMaxRentalDays + 1, true},
+	}
+
+	for _, tt := range tests {
+		err := s.ValidateDuration(tt.duration)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ValidateDuration(%d) error = %v, wantErr %v", tt.duration, err, tt.wantErr)
+		}
+	}
+
+	s.SetMaxRentalDays(30)
+	if err := s.ValidateDuration(31); !errors.Is(err, ErrDurationTooLong) {
+		t.Errorf("Expected ErrDurationTooLong above configured cap, got %v", err)
+	}
+	s.SetMaxRentalDays(0)
+	if s.MaxRentalDays() != 30 {
+		t.Errorf("Non-positive cap should be ignored, got %d", s.MaxRentalDays())
+	}
+}
+
+func TestPricingService_BuildReceipt(t *testing.T) {
+	s := NewPricingService()
+	collectible := &models.Collectible{ID: "col-003", Name: "Life-Size Iron Man Suit", Size: models.SizeLarge}
+
+	t.Run("Short rental shows the multiplier and the deposit", func(t *testing.T) {
+		r := s.BuildReceipt(collectible, &models.Rental{Duration: 3, DailyRate: 20000, TotalFee: 60000, TaxAmount: 7200, Deposit: 50000})
+		if r.BaseDailyRate != 10000 || r.RateMultiplier != 2 || r.DailyRate != 20000 {
+			t.Errorf("Unexpected rate breakdown: %+v", r)
+		}
+		if r.Subtotal != 60000 || r.TaxAmount != 7200 || r.Deposit != 50000 || r.GrandTotal != 117200 {
+			t.Errorf("Expected 60000 subtotal, 7200 VAT, 50000 deposit, 117200 total, got %+v", r)
+		}
+		if r.Currency != "PHP" || r.GrandTotalDisplay != "PHP 117,200.00" {
+			t.Errorf("Unexpected currency display: %s %q", r.Currency, r.GrandTotalDisplay)
+		}
+	})
+
+	t.Run("Discount and late fee are itemized", func(t *testing.T) {
+		r := s.BuildReceipt(collectible, &models.Rental{Duration: 30, DailyRate: 9000, TotalFee: 270000, TaxAmount: 32400, LateFee: 40000})
+		if r.RateMultiplier != 1 || r.DiscountPercent != 10 || r.DailyRate != 9000 {
+			t.Errorf("Unexpected rate breakdown: %+v", r)
+		}
+		if r.Subtotal != 270000 || r.TaxAmount != 32400 || r.LateFee != 40000 || r.GrandTotal != 342400 {
+			t.Errorf("Unexpected totals: %+v", r)
+		}
+	})
+
+	t.Run("Amounts are the ones charged at checkout", func(t *testing.T) {
+		// Priced under an older 10% VAT; the receipt must not recompute it at today's rate
+		s := NewPricingService()
+		s.SetVATRate(0.15)
+		r := s.BuildReceipt(collectible, &models.Rental{Duration: 7, DailyRate: 10000, TotalFee: 70000, TaxAmount: 7000})
+		if r.TaxAmount != 7000 || r.GrandTotal != 77000 {
+			t.Errorf("Expected the stored 7000 VAT and 77000 total, got %+v", r)
+		}
+	})
+}
+
+func TestFormatPHP(t *testing.T) {
+	tests := []struct {
+		amount float64
+		want   string
+	}{
+		{0, "PHP 0.00"},
+		{999.5, "PHP 999.50"},
+		{1000, "PHP 1,000.00"},
+		{1234567.891, "PHP 1,234,567.89"},
+		{-2500, "PHP -2,500.00"},
+	}
+	for _, tt := range tests {
+		if got := FormatPHP(tt.amount); got != tt.want {
+			t.Errorf("FormatPHP(%v) = %q, want %q", tt.amount, got, tt.want)
+		}
+	}
+}
+
+func TestPricingService_CalculateTax(t *testing.T) {
+	s := NewPricingService()
+
+	tests := []struct {
+		name   string
+		amount float64
+		want   float64
+	}{
+		{"Whole pesos", 7000, 840},
+		{"Rounds half a centavo up", 0.125, 0.02}, // 0.015 -> 0.02
+		{"Rounds down below half", 10.01, 1.2},    // 1.2012 -> 1.20
+		{"Rounds up above half", 10.05, 1.21},     // 1.206 -> 1.21
+		{"Discounted long rental", 270000, 32400}, // 30 days large at 10% off
+		{"Odd fractional fee", 1234.56, 148.15},   // 148.1472 -> 148.15
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.CalculateTax(tt.amount); got != tt.want {
+				t.Errorf("CalculateTax(%v) = %v, want %v", tt.amount, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("Zero rate disables tax", func(t *testing.T) {
+		s := NewPricingService()
+		s.SetVATRate(0)
+		if got := s.CalculateTax(7000); got != 0 {
+			t.Errorf("Expected no tax, got %v", got)
+		}
+	})
+
+	t.Run("Negative rate is ignored", func(t *testing.T) {
+		s := NewPricingService()
+		s.SetVATRate(-0.5)
+		if s.VATRate() != DefaultVATRate {
+			t.Errorf("Expected default rate to remain, got %v", s.VATRate())
+		}
+	})
+}
+
+func TestPricingService_CalculateDeposit(t *testing.T) {
+	s := NewPricingService()
+
+	tests := []struct {
+		size models.Size
+		want float64
+	}{
+		{models.SizeSmall, 0},
+		{models.SizeMedium, 0},
+		{models.SizeLarge, 5000}, // Half of one day at 10,000
+		{models.Size("XL"), 0},
+	}
+	for _, tt := range tests {
+		if got := s.CalculateDeposit(tt.size); got != tt.want {
+			t.Errorf("CalculateDeposit(%s) = %v, want %v", tt.size, got, tt.want)
+		}
+	}
+
+	t.Run("Quote includes deposit in total due", func(t *testing.T) {
+		quote := s.CalculateQuote(&models.Collectible{ID: "col-003", Size: models.SizeLarge}, 7)
+		// 70,000 fee + 8,400 VAT + 5,000 deposit
+		if quote.Deposit != 5000 || quote.TotalWithTax != 78400 || quote.TotalDue != 83400 {
+			t.Errorf("Unexpected quote totals: %+v", quote)
+		}
+	})
+}
+
+func TestPricingService_CalculateInsuranceFee(t *testing.T) {
+	s := NewPricingService()
+
+	if got := s.CalculateInsuranceFee(7000); got != 700 {
+		t.Errorf("CalculateInsuranceFee(7000) = %v, want 700", got)
+	}
+	if got := s.CalculateInsuranceFee(1234.56); got != 123.46 {
+		t.Errorf("CalculateInsuranceFee(1234.56) = %v, want 123.46", got)
+	}
+
+	t.Run("Quote offers the waiver without charging it", func(t *testing.T) {
+		quote := s.CalculateQuote(&models.Collectible{ID: "col-001", Size: models.SizeSmall}, 7)
+		if quote.InsuranceFee != 700 || quote.TotalDue != 7840 {
+			t.Errorf("Expected a 700 waiver outside the 7840 total due, got %+v", quote)
+		}
+	})
+
+	t.Run("Receipt includes a taken waiver", func(t *testing.T) {
+		r := s.BuildReceipt(&models.Collectible{ID: "col-001", Size: models.SizeSmall}, &models.Rental{Duration: 7, DailyRate: 1000, TotalFee: 7000, TaxAmount: 840, InsuranceFee: 700})
+		if r.InsuranceFee != 700 || r.GrandTotal != 8540 {
+			t.Errorf("Unexpected receipt totals: %+v", r)
+		}
+	})
+}
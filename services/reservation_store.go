@@ -0,0 +1,26 @@
+package services
+
+import (
+	"time"
+
+	"github.com/mongocollectibles/rental-system/models"
+)
+
+// ReservationStore persists unit reservations so they survive restarts and are
+// visible to other instances sharing the same inventory.
+type ReservationStore interface {
+	// SaveReservation records that unitID is held by rentalID. A zero reservedAt marks a
+	// confirmed (paid) hold. It must fail if a different rental already holds the unit.
+	SaveReservation(unitID string, rentalID string, reservedAt time.Time) error
+	// DeleteReservation removes the hold on unitID, if any
+	DeleteReservation(unitID string) error
+	// LoadReservations returns every persisted hold
+	LoadReservations() ([]models.Reservation, error)
+}
+
+// UnitStore persists the availability of inventory units so the full inventory state,
+// not just the holds, survives restarts and is shared between instances.
+type UnitStore interface {
+	// UpdateUnitAvailability records unit's IsAvailable, ReservedAt and ReservationID
+	UpdateUnitAvailability(unit *models.CollectibleUnit) error
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	"github.com/mongocollectibles/rental-system/models"
+)
+
+// WaitlistStore persists waitlist entries. data.Repository implements it.
+type WaitlistStore interface {
+	// GetWaitlistByCollectible returns every entry for a collectible, notified or not
+	GetWaitlistByCollectible(collectibleID string) ([]*models.WaitlistEntry, error)
+	UpdateWaitlistEntry(entry *models.WaitlistEntry) error
+}
+
+// AvailabilityListener is told when a unit of a collectible goes back into stock
+type AvailabilityListener interface {
+	UnitReleased(collectibleID string)
+}
+
+// WaitlistService emails waitlisted customers when a collectible is back in stock,
+// one customer per released unit, oldest entry first
+type WaitlistService struct {
+	store    WaitlistStore
+	notifier NotificationService
+}
+
+// NewWaitlistService creates a waitlist service that sends through notifier
+func NewWaitlistService(store WaitlistStore, notifier NotificationService) *WaitlistService {
+	return &WaitlistService{
+		store:    store,
+		notifier: notifier,
+	}
+}
+
+// NotifyNext emails the customer who has waited longest for a collectible and marks
+// their entry notified. It returns nil, nil if nobody is waiting. If the email fails
+// the entry stays pending so the next release retries it.
+func (s *WaitlistService) NotifyNext(collectibleID string) (*models.WaitlistEntry, error) {
+	entries, err := s.store.GetWaitlistByCollectible(collectibleID)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []*models.WaitlistEntry
+	for _, entry := range entries {
+		if entry.NotifiedAt == nil {
+			pending = append(pending, entry)
+		}
+	}
+	if len(pending) == 0 {
+		return nil, nil
+	}
+	sort.SliceStable(pending, func(i, j int) bool {
+		return pending[i].CreatedAt.Before(pending[j].CreatedAt)
+	})
+
+	next := pending[0]
+	if err := s.notifier.SendBackInStock(next); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	next.NotifiedAt = &now
+	if err := s.store.UpdateWaitlistEntry(next); err != nil {
+		return nil, err
+	}
+	return next, nil
+}
+
+// UnitReleased notifies the next waitlisted customer. Failures are logged, not returned,
+// since the release itself has already succeeded.
+func (s *WaitlistService) UnitReleased(collectibleID string) {
+	entry, err := s.NotifyNext(collectibleID)
+	if err != nil {
+		log.Printf("[Waitlist] Warning: Failed to notify waitlist for %s: %v", collectibleID, err)
+		return
+	}
+	if entry != nil {
+		log.Printf("[Waitlist] Notified %s that %s is back in stock", entry.Email, collectibleID)
+	}
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mongocollectibles/rental-system/models"
+)
+
+// fakeWaitlistStore keeps waitlist entries in a slice
+type fakeWaitlistStore struct {
+	entries []*models.WaitlistEntry
+}
+
+func (s *fakeWaitlistStore) GetWaitlistByCollectible(collectibleID string) ([]*models.WaitlistEntry, error) {
+	var matches []*models.WaitlistEntry
+	for _, e := range s.entries {
+		if e.CollectibleID == collectibleID {
+			matches = append(matches, e)
+		}
+	}
+	return matches, nil
+}
+
+func (s *fakeWaitlistStore) UpdateWaitlistEntry(entry *models.WaitlistEntry) error {
+	for i, e := range s.entries {
+		if e.ID == entry.ID {
+			s.entries[i] = entry
+			return nil
+		}
+	}
+	return errors.New("waitlist entry not found")
+}
+
+// recordingNotifier records back-in-stock emails and fails them when err is set
+type recordingNotifier struct {
+	NoopNotificationService
+	sent []string
+	err  error
+}
+
+func (n *recordingNotifier) SendBackInStock(entry *models.WaitlistEntry) error {
+	if n.err != nil {
+		return n.err
+	}
+	n.sent = append(n.sent, entry.Email)
+	return nil
+}
+
+// recordingListener records the collectibles reported back in stock
+type recordingListener struct {
+	released []string
+}
+
+func (l *recordingListener) UnitReleased(collectibleID string) {
+	l.released = append(l.released, collectibleID)
+}
+
+func TestWaitlistService_NotifyNext(t *testing.T) {
+	now := time.Now()
+	notified := now.Add(-time.Minute)
+	store := &fakeWaitlistStore{entries: []*models.WaitlistEntry{
+		{ID: "w-3", CollectibleID: "C1", Email: "newest@example.com", CreatedAt: now},
+		{ID: "w-1", CollectibleID: "C1", Email: "done@example.com", CreatedAt: now.Add(-3 * time.Hour), NotifiedAt: &notified},
+		{ID: "w-2", CollectibleID: "C1", Email: "oldest@example.com", CreatedAt: now.Add(-2 * time.Hour)},
+		{ID: "w-4", CollectibleID: "C2", Email: "other@example.com", CreatedAt: now.Add(-4 * time.Hour)},
+	}}
+	notifier := &recordingNotifier{}
+	s := NewWaitlistService(store, notifier)
+
+	t.Run("Failed email leaves the entry pending", func(t *testing.T) {
+		notifier.err = errors.New("smtp down")
+		defer func() { notifier.err = nil }()
+
+		if _, err := s.NotifyNext("C1"); err == nil {
+			t.Fatal("Expected the send error to be returned")
+		}
+		if store.entries[2].NotifiedAt != nil {
+			t.Error("Entry must stay pending after a failed send")
+		}
+	})
+
+	// Already-notified entries are skipped; the oldest pending one goes first
+	for _, want := range []string{"oldest@example.com", "newest@example.com"} {
+		entry, err := s.NotifyNext("C1")
+		if err != nil {
+			t.Fatalf("NotifyNext failed: %v", err)
+		}
+		if entry == nil || entry.Email != want || entry.NotifiedAt == nil {
+			t.Fatalf("Expected %s notified, got %+v", want, entry)
+		}
+	}
+
+	if entry, err := s.NotifyNext("C1"); entry != nil || err != nil {
+		t.Errorf("Expected nobody left to notify, got %+v, %v", entry, err)
+	}
+	if len(notifier.sent) != 2 {
+		t.Errorf("Expected 2 emails, got %v", notifier.sent)
+	}
+}
+
+func TestAllocationManager_AvailabilityListener(t *testing.T) {
+	warehouses := []models.WarehouseNode{
+		{ID: "1", Distances: map[string]int{"S1": 1}},
+	}
+	units := []*models.CollectibleUnit{
+		{ID: "U1", CollectibleID: "C1", WarehouseID: "1", IsAvailable: true},
+		{ID: "U2", CollectibleID: "C2", WarehouseID: "1", IsAvailable: true},
+	}
+	am := NewAllocationManager(units, warehouses)
+	listener := &recordingListener{}
+	am.SetAvailabilityListener(listener)
+
+	am.Allocate("C1", "S1", "R1")
+	am.Allocate("C2", "S1", "R2")
+
+	// A failed release (nothing held) is not reported
+	am.ReleaseUnit("missing")
+	if err := am.ReleaseUnit("U1"); err != nil {
+		t.Fatalf("ReleaseUnit failed: %v", err)
+	}
+	if len(listener.released) != 1 || listener.released[0] != "C1" {
+		t.Fatalf("Expected C1 reported after release, got %v", listener.released)
+	}
+
+	// Expired reservations are reported too
+	past := time.Now().Add(-time.Hour)
+	units[1].ReservedAt = &past
+	am.CleanupExpiredReservations()
+	if len(listener.released) != 2 || listener.released[1] != "C2" {
+		t.Errorf("Expected C2 reported after cleanup, got %v", listener.released)
+	}
+}
@@ -231,6 +231,15 @@ function updateQuote(dailyRate, duration) {
         isSpecial = true;
     }
 
+    // Long-term discount tiers (mirrors PricingService)
+    let discountPercent = 0;
+    if (duration >= 90) {
+        discountPercent = 20;
+    } else if (duration >= 30) {
+        discountPercent = 10;
+    }
+    finalRate *= (1 - discountPercent / 100);
+
     const total = finalRate * duration;
 
     // DOM Elements
@@ -241,7 +250,7 @@ function updateQuote(dailyRate, duration) {
     const specialNotice = document.getElementById('specialRateNotice');
     const quoteSummary = document.getElementById('quoteSummary');
 
-    if (quoteDaily) quoteDaily.textContent = `₱${finalRate.toFixed(2)}`;
+    if (quoteDaily) quoteDaily.textContent = `₱${finalRate.toFixed(2)}${discountPercent > 0 ? ` (${discountPercent}% off)` : ''}`;
     if (quoteDuration) quoteDuration.textContent = `${duration} days`;
     if (quoteTotal) quoteTotal.textContent = `₱${total.toFixed(2)}`;
 
@@ -6,6 +6,19 @@ if (proceedBtn) {
     proceedBtn.addEventListener('click', handleCheckout);
 }
 
+// One Idempotency-Key per distinct checkout payload, so a resubmitted
+// form replays the same rental instead of allocating another unit
+const checkoutIdempotencyKeys = {};
+
+function getIdempotencyKey(payload) {
+    if (!checkoutIdempotencyKeys[payload]) {
+        checkoutIdempotencyKeys[payload] = (window.crypto && crypto.randomUUID)
+            ? crypto.randomUUID()
+            : `${Date.now()}-${Math.random().toString(16).slice(2)}`;
+    }
+    return checkoutIdempotencyKeys[payload];
+}
+
 async function handleCheckout() {
     console.log("Handle Checkout Started - v2");
 
@@ -45,10 +58,14 @@ async function handleCheckout() {
     proceedBtn.textContent = 'Preparing Payment...';
 
     try {
+        const payload = JSON.stringify(checkoutData);
         const response = await fetch(`${API_BASE}/rentals/checkout`, {
             method: 'POST',
-            headers: { 'Content-Type': 'application/json' },
-            body: JSON.stringify(checkoutData)
+            headers: {
+                'Content-Type': 'application/json',
+                'Idempotency-Key': getIdempotencyKey(payload)
+            },
+            body: payload
         });
 
         const data = await response.json();